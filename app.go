@@ -26,37 +26,89 @@ type App struct {
 	UdpServer     *control.FuncUdpServer
 	UdpClient     *control.FuncUdpClient
 	UdpServerConn *control.UdpServerConn
+	WsServer      *control.FuncWsServer
+	WsClient      *control.FuncWsClient
 	Message       *control.Message
+	Cert          *control.FuncCert
+	AutoReply     *control.FuncAutoReply
+	Replay        *control.FuncReplay
+	Automation    *control.FuncAutomation
+	Scenario      *control.FuncScenario
+	Script        *control.FuncScript
+	Events        *control.FanoutSink // 各功能模块的事件经此转发给窗口前端及其他接收方
 	Db            *sql.DB
 	ctx           context.Context
 }
 
 func NewApp() *App {
-	return &App{
+	app := &App{
 		TcpServer: &control.FuncTcpServer{
 			Servers: make(map[int]control.NetListener),
-			Conn:    make(map[string]control.ServerConn),
+			Conn:    make(map[int]control.ServerConn),
 			// 其他初始化...
 		},
 		TcpClient: &control.FuncTcpClient{
 			Connections:     make(map[int]net.Conn),
 			ClientReadTasks: make(map[int]*control.ClientReadTask),
 			ScheduledTasks:  make(map[int]*control.ScheduledTask),
+			Reconnecting:    make(map[int]chan struct{}),
 		},
 		TcpServerConn: &control.TcpServerConn{},
 		UdpServer: &control.FuncUdpServer{
 			Servers: make(map[int]control.NetListenerUdp),
-			Conn:    make(map[string]control.ServerConnUdp),
+			Conn:    make(map[int]control.ServerConnUdp),
 			Wg:      sync.WaitGroup{},
 		},
 		UdpClient: &control.FuncUdpClient{
 			Connections:     make(map[int]net.Conn),
 			ClientReadTasks: make(map[int]*control.ClientReadUdpTask),
 			ScheduledTasks:  make(map[int]*control.ScheduledUdpTask),
+			Reconnecting:    make(map[int]chan struct{}),
 		},
 		UdpServerConn: &control.UdpServerConn{},
-		Message:       &control.Message{},
+		WsServer: &control.FuncWsServer{
+			Servers: make(map[int]control.WsListener),
+			Conn:    make(map[int]*control.WsConn),
+		},
+		WsClient: &control.FuncWsClient{
+			Connections: make(map[int]*control.WsConn),
+		},
+		Message:   &control.Message{},
+		Cert:      &control.FuncCert{},
+		AutoReply: &control.FuncAutoReply{},
+		Script:    &control.FuncScript{},
+	}
+	app.Replay = &control.FuncReplay{
+		TcpClient: app.TcpClient,
+		UdpClient: app.UdpClient,
+		TcpServer: app.TcpServer,
+		UdpServer: app.UdpServer,
+	}
+	app.Events = control.NewFanoutSink()
+	app.Automation = &control.FuncAutomation{
+		Events:    app.Events,
+		TcpClient: app.TcpClient,
+		UdpClient: app.UdpClient,
+		TcpServer: app.TcpServer,
+		UdpServer: app.UdpServer,
+		Message:   app.Message,
 	}
+	app.Scenario = &control.FuncScenario{
+		Events:    app.Events,
+		TcpClient: app.TcpClient,
+		UdpClient: app.UdpClient,
+		TcpServer: app.TcpServer,
+		UdpServer: app.UdpServer,
+	}
+	app.TcpClient.Events = app.Events
+	app.TcpServer.Events = app.Events
+	app.UdpClient.Events = app.Events
+	app.UdpServer.Events = app.Events
+	app.WsClient.Events = app.Events
+	app.WsServer.Events = app.Events
+	app.Message.Events = app.Events
+	app.Replay.Events = app.Events
+	return app
 }
 
 func (app *App) startup(ctx context.Context) {
@@ -66,14 +118,7 @@ func (app *App) startup(ctx context.Context) {
 	// 获取数据库文件路径
 	dbPath := getAppDataPath()
 
-	// 检查数据库文件是否存在
-	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-		// 如果数据库文件不存在，创建并初始化
-		createDatabase(dbPath)
-	}
-
-	// 开数据库
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := openDatabase(dbPath)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -88,6 +133,12 @@ func (app *App) startup(ctx context.Context) {
 		log.Fatal(err)
 	}
 
+	app.setContext(ctx)
+	app.Events.Add(control.WailsSink{Ctx: ctx})
+}
+
+// setContext 设置各功能模块的运行时 context
+func (app *App) setContext(ctx context.Context) {
 	app.ctx = ctx
 	app.TcpClient.Ctx = app.ctx
 	app.TcpServer.Ctx = app.ctx
@@ -96,6 +147,31 @@ func (app *App) startup(ctx context.Context) {
 	app.UdpClient.Ctx = app.ctx
 	app.UdpServer.Ctx = app.ctx
 	app.UdpServerConn.Ctx = app.ctx
+	app.WsServer.Ctx = app.ctx
+	app.WsClient.Ctx = app.ctx
+	app.Cert.Ctx = app.ctx
+	app.AutoReply.Ctx = app.ctx
+	app.Replay.Ctx = app.ctx
+	app.Automation.Ctx = app.ctx
+	app.Scenario.Ctx = app.ctx
+	app.Script.Ctx = app.ctx
+}
+
+// openDatabase 打开数据库（如果不存在则会创建），执行未应用的迁移，升级前自动备份数据库
+func openDatabase(dbPath string) (*sql.DB, error) {
+	// 确保数据库目录存在
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("创建数据库目录失败: %v", err)
+	}
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := models.Migrate(db, dbPath); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
 func (app *App) SetDB() error {
@@ -109,6 +185,12 @@ func (app *App) SetDB() error {
 	app.UdpClient.Db = app.Db
 	app.UdpServer.Db = app.Db
 	app.UdpServerConn.Db = app.Db
+	app.WsServer.Db = app.Db
+	app.WsClient.Db = app.Db
+	app.AutoReply.Db = app.Db
+	app.Replay.Db = app.Db
+	app.Scenario.Db = app.Db
+	app.Script.Db = app.Db
 	return nil
 }
 
@@ -145,27 +227,3 @@ func getAppDataPath() string {
 	}
 	return dbPath
 }
-
-// 创建数据库并初始化表格
-func createDatabase(dbPath string) {
-	// 确保数据库目录存在
-	dir := filepath.Dir(dbPath)
-	err := os.MkdirAll(dir, 0755)
-	if err != nil {
-		log.Fatal("Failed to create directory:", err)
-	}
-
-	// 打开数据库文件（如果不存在则会创建）
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
-
-	// 初始化数据库表
-	if err := models.InitDB(db); err != nil {
-		log.Fatal(err)
-	}
-
-	fmt.Println("Database created and initialized successfully.")
-}
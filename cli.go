@@ -0,0 +1,672 @@
+package main
+
+import (
+	"bufio"
+	"connectivity/control"
+	"connectivity/models"
+	"connectivity/types"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// cliCommand 命令行子命令
+type cliCommand struct {
+	usage string
+	run   func(s *cliSession, args []string) error
+}
+
+// cliCommands 不打开窗口、直接驱动 control 包的子命令
+var cliCommands = map[string]cliCommand{
+	"tcp-client": {"连接 TCP 服务端，发送 -send/-file/标准输入的内容并打印收到的数据", func(s *cliSession, args []string) error { return s.runClient("tcp", args) }},
+	"udp-client": {"向 UDP 服务端发送 -send/-file/标准输入的内容并打印收到的数据", func(s *cliSession, args []string) error { return s.runClient("udp", args) }},
+	"tcp-server": {"启动 TCP 服务端，打印连接与收到的数据，标准输入的每一行广播到全部连接", func(s *cliSession, args []string) error { return s.runServer("tcp", args) }},
+	"udp-server": {"启动 UDP 服务端，打印连接与收到的数据，标准输入的每一行广播到全部连接", func(s *cliSession, args []string) error { return s.runServer("udp", args) }},
+	"replay":     {"通过 TCP/UDP 客户端回放抓包会话或消息记录", (*cliSession).runReplay},
+	"export":     {"导出消息记录为 CSV、JSON Lines、文本或 pcapng 文件", (*cliSession).runExport},
+	"api":        {"启动本地 HTTP/WebSocket 自动化接口，直到中断", (*cliSession).runAPI},
+	"scenario":   {"执行 JSON/YAML 测试场景，未通过时退出码为 1", (*cliSession).runScenario},
+}
+
+// isCLICommand 判断启动参数是否为命令行子命令，其他参数（如 macOS 的 -psn_*）仍启动窗口
+func isCLICommand(arg string) bool {
+	if _, ok := cliCommands[arg]; ok {
+		return true
+	}
+	return arg == "help" || arg == "-h" || arg == "--help"
+}
+
+// runCLI 执行子命令并返回进程退出码
+func runCLI(args []string) int {
+	name := args[0]
+	command, ok := cliCommands[name]
+	if !ok {
+		printCLIUsage(os.Stdout)
+		return 0
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	dbPath := fs.String("db", "", "数据库文件路径，默认与窗口程序共用")
+	output := fs.String("output", "text", "事件输出格式: text/json")
+	s := &cliSession{flags: fs, out: os.Stdout, in: os.Stdin}
+	// 各子命令在同一个 FlagSet 上注册自己的参数后再解析
+	s.parse = func(rest []string) error {
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		switch *output {
+		case "text":
+		case "json":
+			s.json = true
+		default:
+			return fmt.Errorf("不支持的输出格式: %s", *output)
+		}
+		return s.open(*dbPath)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	s.ctx = ctx
+
+	err := command.run(s, args[1:])
+	s.close()
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+func printCLIUsage(w io.Writer) {
+	fmt.Fprintln(w, "用法: connectivity <子命令> [参数]，不带子命令时启动窗口程序")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "子命令:")
+	for _, name := range []string{"tcp-client", "udp-client", "tcp-server", "udp-server", "replay", "export", "api", "scenario"} {
+		fmt.Fprintf(w, "  %-11s %s\n", name, cliCommands[name].usage)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "使用 connectivity <子命令> -h 查看子命令参数")
+}
+
+// cliSession 一次命令行运行，持有与窗口程序相同的功能模块，事件打印到标准输出
+type cliSession struct {
+	flags *flag.FlagSet
+	parse func(args []string) error
+	ctx   context.Context
+	app   *App
+	in    io.Reader
+
+	mu      sync.Mutex
+	out     io.Writer
+	json    bool
+	onEvent func(name string, data interface{}) // 打印后回调，用于等待断开或回放结束
+
+	sink       *control.ChanSink
+	removeSink func()
+	consumed   chan struct{} // 事件打印协程退出时关闭
+}
+
+// open 打开数据库并初始化各功能模块，事件经 ChanSink 按顺序打印
+func (s *cliSession) open(dbPath string) error {
+	if dbPath == "" {
+		dbPath = getAppDataPath()
+	}
+	db, err := openDatabase(dbPath)
+	if err != nil {
+		return err
+	}
+	s.app = NewApp()
+	if err := s.app.loadServerConfigs(db); err != nil {
+		return err
+	}
+	if err := s.app.SetDB(); err != nil {
+		return err
+	}
+	s.app.setContext(s.ctx)
+	sink := control.NewChanSink(256)
+	s.removeSink = s.app.Events.Add(sink)
+	s.consumed = make(chan struct{})
+	go func() {
+		defer close(s.consumed)
+		for event := range sink.C {
+			if event.Name == control.LogErrorEvent {
+				s.logError(event.Data.(string))
+				continue
+			}
+			s.emit(event.Name, event.Data)
+		}
+	}()
+	s.sink = sink
+	return nil
+}
+
+// close 停止接收事件，打印完已收到的事件后关闭数据库
+func (s *cliSession) close() {
+	if s.app == nil {
+		return
+	}
+	if s.sink != nil {
+		s.removeSink()
+		close(s.sink.C)
+		<-s.consumed
+	}
+	if s.app.Db != nil {
+		s.app.Db.Close()
+	}
+}
+
+func (s *cliSession) emit(name string, data interface{}) {
+	s.mu.Lock()
+	if s.json {
+		line, err := json.Marshal(map[string]interface{}{"event": name, "data": data})
+		if err == nil {
+			fmt.Fprintf(s.out, "%s\n", line)
+		}
+	} else {
+		fmt.Fprintln(s.out, formatCLIEvent(name, data))
+	}
+	onEvent := s.onEvent
+	s.mu.Unlock()
+	if onEvent != nil {
+		onEvent(name, data)
+	}
+}
+
+// setOnEvent 设置事件回调，事件打印协程会并发读取
+func (s *cliSession) setOnEvent(onEvent func(name string, data interface{})) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onEvent = onEvent
+}
+
+func (s *cliSession) logError(message string) {
+	fmt.Fprintf(os.Stderr, "错误: %s\n", message)
+}
+
+// report 打印操作结果，失败时返回错误
+func (s *cliSession) report(action string, result types.ConnectResult) error {
+	if !result.Success {
+		return fmt.Errorf("%s: %s", action, result.Message)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.json {
+		line, err := json.Marshal(map[string]interface{}{"event": "result", "action": action, "message": result.Message, "data": result.Data})
+		if err == nil {
+			fmt.Fprintf(s.out, "%s\n", line)
+		}
+		return nil
+	}
+	fmt.Fprintf(s.out, "%s: %s\n", action, result.Message)
+	return nil
+}
+
+// formatCLIEvent 事件的文本格式: 时间 事件名 类型 标识 方向: 内容
+func formatCLIEvent(name string, data interface{}) string {
+	now := time.Now().Format("2006-01-02 15:04:05")
+	switch event := data.(type) {
+	case types.ServerEvent:
+		line := fmt.Sprintf("[%s] %s %s #%d", now, name, event.Type, event.ServerId)
+		if event.Message == nil {
+			return line
+		}
+		if event.Message.Timestamp != "" {
+			line = fmt.Sprintf("[%s] %s %s #%d", event.Message.Timestamp, name, event.Type, event.ServerId)
+		}
+		if event.Message.ConnID != "" {
+			line += " 连接 " + event.Message.ConnID
+		}
+		if event.Message.Direction != "" {
+			line += " " + event.Message.Direction
+		}
+		return line + ": " + event.Message.Content
+	case types.ReplayEvent:
+		line := fmt.Sprintf("[%s] %s %s #%d %d/%d", now, name, event.Type, event.ReplayID, event.Sent, event.Total)
+		if event.Message != "" {
+			line += ": " + event.Message
+		}
+		return line
+	case types.ScenarioStepResult:
+		result := "通过"
+		if !event.Passed {
+			result = "失败"
+		}
+		line := fmt.Sprintf("[%s] %s %s %s %s %dms", now, name, event.Path, event.Action, result, event.DurationMs)
+		if event.Iteration > 0 {
+			line = fmt.Sprintf("[%s] %s %s(第 %d 次) %s %s %dms", now, name, event.Path, event.Iteration, event.Action, result, event.DurationMs)
+		}
+		return line + ": " + event.Message
+	}
+	return fmt.Sprintf("[%s] %s %v", now, name, data)
+}
+
+// cliEndpoint 客户端或服务端的定位参数
+type cliEndpoint struct {
+	id       *int
+	host     *string
+	port     *int
+	encoding *string
+}
+
+func (s *cliSession) endpointFlags(defaultHost string) cliEndpoint {
+	return cliEndpoint{
+		id:       s.flags.Int("id", 0, "使用已保存的客户端或服务端"),
+		host:     s.flags.String("host", defaultHost, "地址"),
+		port:     s.flags.Int("port", 0, "端口"),
+		encoding: s.flags.String("encoding", "utf-8", "新建时使用的字符编码"),
+	}
+}
+
+// resolveClient 返回 -id 指定的客户端，否则复用地址相同的已保存客户端，没有时新建
+func (s *cliSession) resolveClient(protocol string, ep cliEndpoint) (int, error) {
+	if *ep.id != 0 {
+		client, err := models.FindServerClientOne(s.app.Db, *ep.id)
+		if err != nil {
+			return 0, fmt.Errorf("客户端不存在: %d", *ep.id)
+		}
+		if client.Type != protocol {
+			return 0, fmt.Errorf("客户端 %d 不是 %s 客户端", *ep.id, protocol)
+		}
+		return client.ID, nil
+	}
+	if *ep.host == "" || *ep.port == 0 {
+		return 0, errors.New("需要指定 -id 或 -host 与 -port")
+	}
+	find := func() (int, error) {
+		return models.FindServerClientByAddr(s.app.Db, protocol, *ep.host, *ep.port)
+	}
+	if id, err := find(); err != nil || id != 0 {
+		return id, err
+	}
+	if err := models.AddServerClient(s.app.Db, types.ServerClient{
+		Remark:   "命令行",
+		Host:     *ep.host,
+		Port:     *ep.port,
+		Status:   "offline",
+		Type:     protocol,
+		Encoding: *ep.encoding,
+	}); err != nil {
+		return 0, fmt.Errorf("添加客户端失败: %v", err)
+	}
+	return find()
+}
+
+// resolveServer 返回 -id 指定的服务端，否则复用监听地址相同的已保存服务端，没有时新建
+func (s *cliSession) resolveServer(protocol string, ep cliEndpoint) (int, error) {
+	if *ep.id != 0 {
+		server, err := models.FindServerOne(s.app.Db, *ep.id)
+		if err != nil {
+			return 0, fmt.Errorf("服务端不存在: %d", *ep.id)
+		}
+		if server.Type != protocol {
+			return 0, fmt.Errorf("服务端 %d 不是 %s 服务端", *ep.id, protocol)
+		}
+		return server.ID, nil
+	}
+	if *ep.port == 0 {
+		return 0, errors.New("需要指定 -id 或 -port")
+	}
+	find := func() (int, error) {
+		return models.FindServerByAddr(s.app.Db, protocol, *ep.host, *ep.port)
+	}
+	if id, err := find(); err != nil || id != 0 {
+		return id, err
+	}
+	if err := models.AddServer(s.app.Db, types.Server{
+		Remark:   "命令行",
+		Host:     *ep.host,
+		Port:     *ep.port,
+		Status:   "stopped",
+		Type:     protocol,
+		Encoding: *ep.encoding,
+	}); err != nil {
+		return 0, fmt.Errorf("添加服务端失败: %v", err)
+	}
+	return find()
+}
+
+// readLines 逐行读取标准输入，去掉行尾换行；读取在单独的协程中进行，中断时不必等待标准输入结束
+func (s *cliSession) readLines(send func(line string) error) error {
+	lines := make(chan string)
+	done := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(s.in)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			select {
+			case lines <- strings.TrimSuffix(scanner.Text(), "\r"):
+			case <-s.ctx.Done():
+				return
+			}
+		}
+		done <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case err := <-done:
+			return err
+		case line := <-lines:
+			if err := send(line); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// wait 等待 d 时间、中断信号或 done 关闭，d 为 0 时一直等待
+func (s *cliSession) wait(d time.Duration, done <-chan struct{}) {
+	var timeout <-chan time.Time
+	if d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-s.ctx.Done():
+	case <-timeout:
+	case <-done:
+	}
+}
+
+// runClient 连接客户端，依次发送 -send、-file 与 -stdin 的内容，之后等待 -wait 时间或连接断开
+func (s *cliSession) runClient(protocol string, args []string) error {
+	ep := s.endpointFlags("")
+	send := s.flags.String("send", "", "连接后发送的内容")
+	input := s.flags.String("input", control.InputText, "-send 与标准输入的输入方式: text/hex/base64/escape")
+	file := s.flags.String("file", "", "连接后按原始字节发送的文件")
+	stdin := s.flags.Bool("stdin", false, "将标准输入的每一行作为一条消息发送")
+	wait := s.flags.Duration("wait", 0, "发送完成后继续接收的时间，0 表示直到中断或连接断开")
+	if err := s.parse(args); err != nil {
+		return err
+	}
+	clientID, err := s.resolveClient(protocol, ep)
+	if err != nil {
+		return err
+	}
+
+	connect, disconnect, sendMessage := s.app.TcpClient.ConnectTCPClient, s.app.TcpClient.DisconnectTCPClient, s.app.TcpClient.SendMessage
+	if protocol == "udp" {
+		connect, disconnect, sendMessage = s.app.UdpClient.ConnectUdpClient, s.app.UdpClient.DisconnectUdpClient, s.app.UdpClient.SendMessage
+	}
+
+	disconnected := make(chan struct{})
+	var once sync.Once
+	s.setOnEvent(func(name string, data interface{}) {
+		if event, ok := data.(types.ServerEvent); ok && name == "client_event" && event.Type == "disconnected" && event.ServerId == clientID {
+			once.Do(func() { close(disconnected) })
+		}
+	})
+	if err := s.report("连接", connect(clientID)); err != nil {
+		return err
+	}
+	defer disconnect(clientID)
+
+	if *send != "" {
+		if err := s.report("发送", sendMessage(clientID, *send, *input)); err != nil {
+			return err
+		}
+	}
+	if *file != "" {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return fmt.Errorf("读取文件失败: %v", err)
+		}
+		if err := s.report("发送文件", sendMessage(clientID, base64.StdEncoding.EncodeToString(data), control.InputBase64)); err != nil {
+			return err
+		}
+	}
+	if *stdin {
+		if err := s.readLines(func(line string) error {
+			return s.report("发送", sendMessage(clientID, line, *input))
+		}); err != nil {
+			return err
+		}
+	}
+	s.wait(*wait, disconnected)
+	return nil
+}
+
+// runServer 启动服务端并打印事件，-stdin 时将每一行广播到全部连接，直到 -wait 时间到或中断
+func (s *cliSession) runServer(protocol string, args []string) error {
+	ep := s.endpointFlags("0.0.0.0")
+	input := s.flags.String("input", control.InputText, "标准输入的输入方式: text/hex/base64/escape")
+	stdin := s.flags.Bool("stdin", false, "将标准输入的每一行广播到全部连接")
+	wait := s.flags.Duration("wait", 0, "运行时间，0 表示直到中断")
+	if err := s.parse(args); err != nil {
+		return err
+	}
+	serverID, err := s.resolveServer(protocol, ep)
+	if err != nil {
+		return err
+	}
+
+	start, stop, broadcast := s.app.TcpServer.StartTCPServer, s.app.TcpServer.StopTCPServer, s.app.TcpServer.BroadcastMessage
+	if protocol == "udp" {
+		start, stop, broadcast = s.app.UdpServer.StartUdpServer, s.app.UdpServer.StopUdpServer, s.app.UdpServer.BroadcastMessage
+	}
+	if err := s.report("启动", start(serverID)); err != nil {
+		return err
+	}
+	defer stop(serverID)
+
+	deadline := make(chan struct{})
+	if *wait > 0 {
+		timer := time.AfterFunc(*wait, func() { close(deadline) })
+		defer timer.Stop()
+	}
+	if *stdin {
+		go func() {
+			err := s.readLines(func(line string) error {
+				result := broadcast(serverID, line, *input, "")
+				if !result.Success {
+					s.logError(result.Message)
+					return nil
+				}
+				return s.report("广播", result)
+			})
+			if err != nil {
+				s.logError(fmt.Sprintf("读取标准输入失败: %v", err))
+			}
+		}()
+	}
+	s.wait(0, deadline)
+	return nil
+}
+
+// runReplay 连接 TCP/UDP 客户端后回放抓包会话（-pcap）或消息记录（-log-client/-log-server），回放结束后退出；
+// 只指定 -pcap 时列出其中的会话
+func (s *cliSession) runReplay(args []string) error {
+	target := s.flags.String("target", control.ReplayTCPClient, "回放目标: tcp-client/udp-client")
+	ep := s.endpointFlags("")
+	pcap := s.flags.String("pcap", "", "抓包文件")
+	flowID := s.flags.Int("flow", 0, "回放的会话标识")
+	side := s.flags.String("side", "a", "模拟的一端: a 或 b")
+	logClient := s.flags.Int("log-client", 0, "回放该客户端记录中发出的消息")
+	logServer := s.flags.Int("log-server", 0, "回放该服务端记录中发出的消息")
+	logConn := s.flags.Int("log-conn", 0, "来源服务端连接")
+	since := s.flags.String("since", "", "消息记录起始时间")
+	until := s.flags.String("until", "", "消息记录结束时间")
+	timing := s.flags.String("timing", control.TimingOriginal, "发送节奏: original/interval/fast，interval 仅用于消息记录")
+	speed := s.flags.Float64("speed", 1, "original 节奏下的速度倍数")
+	interval := s.flags.Int("interval", 0, "interval 节奏下的发送间隔（毫秒）")
+	waitReply := s.flags.Bool("wait-reply", false, "每次发送后等待回复")
+	replyTimeout := s.flags.Int("reply-timeout", 0, "等待回复的超时（毫秒）")
+	linger := s.flags.Duration("linger", 0, "回放结束后继续接收的时间")
+	if err := s.parse(args); err != nil {
+		return err
+	}
+
+	var capture types.PcapCapture
+	if *pcap != "" {
+		result := s.app.Replay.OpenPcap(*pcap)
+		if err := s.report("加载抓包", result); err != nil {
+			return err
+		}
+		capture = result.Data.(types.PcapCapture)
+		if *flowID == 0 {
+			if !s.json {
+				for _, flow := range capture.Flows {
+					fmt.Fprintf(s.out, "#%d %s %s -> %s A:%d包/%d字节 B:%d包/%d字节 %s\n", flow.ID, flow.Protocol, flow.AddrA, flow.AddrB, flow.PacketsA, flow.BytesA, flow.PacketsB, flow.BytesB, flow.Start)
+				}
+			}
+			return nil
+		}
+	} else if *logClient == 0 && *logServer == 0 {
+		return errors.New("需要指定 -pcap 或 -log-client/-log-server")
+	}
+
+	protocol := "tcp"
+	switch *target {
+	case control.ReplayTCPClient:
+	case control.ReplayUDPClient:
+		protocol = "udp"
+	default:
+		return fmt.Errorf("命令行只支持通过客户端回放: %s", *target)
+	}
+	clientID, err := s.resolveClient(protocol, ep)
+	if err != nil {
+		return err
+	}
+	connect, disconnect := s.app.TcpClient.ConnectTCPClient, s.app.TcpClient.DisconnectTCPClient
+	if protocol == "udp" {
+		connect, disconnect = s.app.UdpClient.ConnectUdpClient, s.app.UdpClient.DisconnectUdpClient
+	}
+
+	// 回放在后台进行，结束事件可能早于 StartPcapReplay 返回，先登记回调再开始
+	finished := make(chan types.ReplayEvent, 1)
+	s.setOnEvent(func(name string, data interface{}) {
+		if event, ok := data.(types.ReplayEvent); ok && name == "replay_event" {
+			switch event.Type {
+			case "finished", "stopped", "error":
+				select {
+				case finished <- event:
+				default:
+				}
+			}
+		}
+	})
+	if err := s.report("连接", connect(clientID)); err != nil {
+		return err
+	}
+	defer disconnect(clientID)
+
+	replayTarget := types.ReplayTarget{Type: *target, ID: clientID}
+	var result types.ConnectResult
+	if *pcap != "" {
+		result = s.app.Replay.StartPcapReplay(types.PcapReplay{CaptureID: capture.ID, FlowID: *flowID, Side: *side, Timing: *timing, Speed: *speed, Target: replayTarget})
+	} else {
+		result = s.app.Replay.StartLogReplay(types.LogReplay{
+			ClientID:       *logClient,
+			ServerID:       *logServer,
+			ConnID:         *logConn,
+			Since:          *since,
+			Until:          *until,
+			Timing:         *timing,
+			Speed:          *speed,
+			IntervalMs:     *interval,
+			WaitReply:      *waitReply,
+			ReplyTimeoutMs: *replyTimeout,
+			Target:         replayTarget,
+		})
+	}
+	if err := s.report("回放", result); err != nil {
+		return err
+	}
+	replayID := result.Data.(int)
+
+	select {
+	case event := <-finished:
+		if event.Type == "error" {
+			return errors.New(event.Message)
+		}
+	case <-s.ctx.Done():
+		s.app.Replay.StopReplay(replayID)
+		return nil
+	}
+	if *linger > 0 {
+		s.wait(*linger, nil)
+	}
+	return nil
+}
+
+// runExport 导出消息记录到 -o 指定的文件
+func (s *cliSession) runExport(args []string) error {
+	clientID := s.flags.Int("client", 0, "导出该客户端的消息")
+	serverID := s.flags.Int("server", 0, "导出该服务端的消息")
+	connID := s.flags.Int("conn", 0, "只导出该服务端连接的消息")
+	format := s.flags.String("format", control.ExportCSV, "导出格式: csv/jsonl/text/pcapng")
+	payloadEncoding := s.flags.String("payload-encoding", control.InputBase64, "jsonl 载荷编码: base64/hex")
+	path := s.flags.String("o", "", "导出文件路径")
+	if err := s.parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return errors.New("需要指定 -o 导出文件路径")
+	}
+	return s.report("导出", s.app.Message.ExportMessages(types.MessageExport{
+		ClientID:        *clientID,
+		ServerID:        *serverID,
+		ConnID:          *connID,
+		Format:          *format,
+		PayloadEncoding: *payloadEncoding,
+		Path:            *path,
+	}))
+}
+
+// runAPI 启动自动化接口并等待中断，令牌与地址打印到标准输出
+func (s *cliSession) runAPI(args []string) error {
+	port := s.flags.Int("port", 0, "监听端口，仅绑定 127.0.0.1，默认 17890")
+	token := s.flags.String("token", "", "访问令牌，默认随机生成")
+	if err := s.parse(args); err != nil {
+		return err
+	}
+	if err := s.report("自动化接口", s.app.Automation.StartAutomation(types.AutomationConfig{Port: *port, Token: *token})); err != nil {
+		return err
+	}
+	defer s.app.Automation.StopAutomation()
+	if !s.json {
+		status := s.app.Automation.GetAutomationStatus().Data.(types.AutomationStatus)
+		fmt.Fprintf(s.out, "令牌: %s\n", status.Token)
+	}
+	s.wait(0, nil)
+	return nil
+}
+
+// runScenario 执行 -file 指定的场景，步骤结果以 scenario_event 打印
+func (s *cliSession) runScenario(args []string) error {
+	path := s.flags.String("file", "", "场景文件路径，JSON 或 YAML")
+	if err := s.parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return errors.New("需要指定 -file 场景文件")
+	}
+	loaded := s.app.Scenario.LoadScenario(*path)
+	if !loaded.Success {
+		return errors.New(loaded.Message)
+	}
+	result := s.app.Scenario.RunScenario(loaded.Data.(types.Scenario))
+	if err := s.report("场景", result); err != nil {
+		return err
+	}
+	if report := result.Data.(types.ScenarioReport); !report.Passed {
+		return errors.New(result.Message)
+	}
+	return nil
+}
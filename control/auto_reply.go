@@ -0,0 +1,375 @@
+package control
+
+import (
+	"bytes"
+	"connectivity/models"
+	"connectivity/types"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 自动应答匹配方式
+const (
+	MatchExact  = "exact"
+	MatchPrefix = "prefix"
+	MatchRegex  = "regex"
+	MatchHex    = "hex"
+)
+
+// 自动应答触发方式
+const (
+	ReplyAlways = "always"
+	ReplyOnce   = "once"
+)
+
+type FuncAutoReply struct {
+	mu  sync.Mutex
+	Ctx context.Context
+	Db  *sql.DB
+}
+
+// AddAutoReplyRule 添加自动应答规则
+func (a *FuncAutoReply) AddAutoReplyRule(rule types.AutoReplyRule) types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := compileAutoReplyRule(rule); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("规则配置错误: %v", err),
+		}
+	}
+	if err := models.AddAutoReplyRule(a.Db, rule); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("添加规则失败: %v", err),
+		}
+	}
+	autoReplyRules.invalidate()
+	return types.ConnectResult{
+		Success: true,
+		Message: "添加规则成功",
+	}
+}
+
+// UpdateAutoReplyRule 更新自动应答规则，对已建立的连接立即生效
+func (a *FuncAutoReply) UpdateAutoReplyRule(rule types.AutoReplyRule) types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := compileAutoReplyRule(rule); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("规则配置错误: %v", err),
+		}
+	}
+	if err := models.UpdateAutoReplyRule(a.Db, rule); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("更新规则失败: %v", err),
+		}
+	}
+	autoReplyRules.invalidate()
+	return types.ConnectResult{
+		Success: true,
+		Message: "更新规则成功",
+	}
+}
+
+// DeleteAutoReplyRule 删除自动应答规则
+func (a *FuncAutoReply) DeleteAutoReplyRule(id int) types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := models.DeleteAutoReplyRule(a.Db, id); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("删除规则失败: %v", err),
+		}
+	}
+	autoReplyRules.invalidate()
+	return types.ConnectResult{
+		Success: true,
+		Message: "删除规则成功",
+	}
+}
+
+// GetAutoReplyRules 获取服务端的全部自动应答规则
+func (a *FuncAutoReply) GetAutoReplyRules(serverID int) types.ConnectResult {
+	rules, err := models.GetAutoReplyRules(a.Db, serverID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取规则失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "获取规则成功",
+		Data:    rules,
+	}
+}
+
+// TestAutoReplyRule 使用样例数据测试规则，命中时返回渲染后的应答内容
+func (a *FuncAutoReply) TestAutoReplyRule(rule types.AutoReplyRule, input string, inputMethod string) types.ConnectResult {
+	matcher, err := compileAutoReplyRule(rule)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("规则配置错误: %v", err),
+		}
+	}
+	// 按规则所属服务端的字符编码转换文本，与连接上的实际应答一致
+	var charset string
+	if server, err := models.FindServerOne(a.Db, rule.ServerID); err == nil {
+		charset = server.Encoding
+	}
+	data, err := encodePayloadCharset(input, inputMethod, charset)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("数据格式错误: %v", err),
+		}
+	}
+	response, ok, err := matcher.match(data, charset)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("生成应答失败: %v", err),
+		}
+	}
+	if !ok {
+		return types.ConnectResult{
+			Success: true,
+			Message: "未匹配",
+		}
+	}
+	display := detectDisplayMethodCharset(response, charset)
+	return types.ConnectResult{
+		Success: true,
+		Message: "匹配成功",
+		Data: map[string]interface{}{
+			"payload": response,
+			"content": renderPayloadCharset(response, display, charset),
+		},
+	}
+}
+
+// autoReplyMatcher 编译后的应答规则
+type autoReplyMatcher struct {
+	rule     types.AutoReplyRule
+	pattern  []byte
+	wildcard []bool // hex 模式中 ?? 所在位置
+	re       *regexp.Regexp
+}
+
+func compileAutoReplyRule(rule types.AutoReplyRule) (*autoReplyMatcher, error) {
+	m := &autoReplyMatcher{rule: rule}
+	var err error
+
+	switch rule.MatchType {
+	case MatchExact, MatchPrefix:
+		if m.pattern, err = EncodePayload(rule.Pattern, rule.PatternInput); err != nil {
+			return nil, fmt.Errorf("匹配内容格式错误: %v", err)
+		}
+	case MatchRegex:
+		if m.re, err = regexp.Compile(rule.Pattern); err != nil {
+			return nil, fmt.Errorf("正则表达式错误: %v", err)
+		}
+	case MatchHex:
+		if m.pattern, m.wildcard, err = parseHexPattern(rule.Pattern); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的匹配方式: %s", rule.MatchType)
+	}
+
+	switch rule.Mode {
+	case "", ReplyAlways, ReplyOnce:
+	default:
+		return nil, fmt.Errorf("不支持的触发方式: %s", rule.Mode)
+	}
+	if rule.DelayMs < 0 {
+		return nil, errors.New("延迟不能为负数")
+	}
+
+	if m.re == nil {
+		if _, err = EncodePayload(rule.Response, rule.ResponseInput); err != nil {
+			return nil, fmt.Errorf("应答内容格式错误: %v", err)
+		}
+	}
+	return m, nil
+}
+
+// parseHexPattern 解析十六进制匹配模式，?? 表示任意字节
+func parseHexPattern(pattern string) ([]byte, []bool, error) {
+	fields := strings.Fields(pattern)
+	if len(fields) == 1 && len(fields[0]) > 2 {
+		// 未分隔的写法，如 AA55??01
+		compact := fields[0]
+		if len(compact)%2 != 0 {
+			return nil, nil, errors.New("十六进制模式长度必须为偶数")
+		}
+		fields = nil
+		for i := 0; i < len(compact); i += 2 {
+			fields = append(fields, compact[i:i+2])
+		}
+	}
+	if len(fields) == 0 {
+		return nil, nil, errors.New("十六进制模式不能为空")
+	}
+
+	values := make([]byte, len(fields))
+	wildcard := make([]bool, len(fields))
+	for i, field := range fields {
+		if field == "??" {
+			wildcard[i] = true
+			continue
+		}
+		b, err := EncodePayload(field, InputHex)
+		if err != nil || len(b) != 1 {
+			return nil, nil, fmt.Errorf("十六进制模式格式错误: %s", field)
+		}
+		values[i] = b[0]
+	}
+	return values, wildcard, nil
+}
+
+// match 匹配数据，命中时返回应答内容，文本应答按 charset 转换
+func (m *autoReplyMatcher) match(data []byte, charset string) ([]byte, bool, error) {
+	var ok bool
+	switch m.rule.MatchType {
+	case MatchExact:
+		ok = bytes.Equal(data, m.pattern)
+	case MatchPrefix:
+		ok = bytes.HasPrefix(data, m.pattern)
+	case MatchHex:
+		ok = len(data) >= len(m.pattern)
+		for i := 0; ok && i < len(m.pattern); i++ {
+			ok = m.wildcard[i] || data[i] == m.pattern[i]
+		}
+	case MatchRegex:
+		return m.expand(data, charset)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	response, err := encodePayloadCharset(m.rule.Response, m.rule.ResponseInput, charset)
+	return response, true, err
+}
+
+// expand 以正则分组展开应答模板。文本应答先将模板转换为目标编码，
+// 分组引用的是收到的原始字节，展开后无需再次转换
+func (m *autoReplyMatcher) expand(data []byte, charset string) ([]byte, bool, error) {
+	submatch := m.re.FindSubmatchIndex(data)
+	if submatch == nil {
+		return nil, false, nil
+	}
+	switch strings.ToLower(m.rule.ResponseInput) {
+	case InputHex, InputBase64, InputEscape:
+		template := m.re.Expand(nil, []byte(m.rule.Response), data, submatch)
+		response, err := EncodePayload(string(template), m.rule.ResponseInput)
+		return response, true, err
+	}
+	template, err := encodeText(m.rule.Response, charset)
+	if err != nil {
+		return nil, true, err
+	}
+	return m.re.Expand(nil, template, data, submatch), true, nil
+}
+
+// autoReplyCache 按服务端缓存已编译的启用规则，规则变更时整体失效
+type autoReplyCache struct {
+	mu    sync.Mutex
+	rules map[int][]*autoReplyMatcher
+}
+
+var autoReplyRules = &autoReplyCache{rules: make(map[int][]*autoReplyMatcher)}
+
+func (c *autoReplyCache) get(db *sql.DB, serverID int) ([]*autoReplyMatcher, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if matchers, ok := c.rules[serverID]; ok {
+		return matchers, nil
+	}
+	rules, err := models.GetAutoReplyRules(db, serverID)
+	if err != nil {
+		return nil, err
+	}
+	var matchers []*autoReplyMatcher
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		matcher, err := compileAutoReplyRule(rule)
+		if err != nil {
+			continue
+		}
+		matchers = append(matchers, matcher)
+	}
+	c.rules[serverID] = matchers
+	return matchers, nil
+}
+
+func (c *autoReplyCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = make(map[int][]*autoReplyMatcher)
+}
+
+// autoReplySession 单个连接的应答状态，记录 once 规则是否已触发
+type autoReplySession struct {
+	serverID int
+	charset  string               // 服务端的字符编码，文本应答按此编码发送和记录
+	checksum types.ChecksumConfig // 服务端的校验配置，应答与普通发送一样追加校验值
+	fired    map[int]bool
+}
+
+func newAutoReplySession(server types.Server) *autoReplySession {
+	return &autoReplySession{
+		serverID: server.ID,
+		charset:  server.Encoding,
+		checksum: server.Checksum,
+		fired:    make(map[int]bool),
+	}
+}
+
+// match 按优先级匹配第一条命中的规则，未命中时返回 nil，命中时返回追加校验值后的应答
+func (s *autoReplySession) match(db *sql.DB, data []byte) (*types.AutoReplyRule, []byte, error) {
+	matchers, err := autoReplyRules.get(db, s.serverID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, matcher := range matchers {
+		if matcher.rule.Mode == ReplyOnce && s.fired[matcher.rule.ID] {
+			continue
+		}
+		response, ok, err := matcher.match(data, s.charset)
+		if !ok {
+			continue
+		}
+		if err != nil {
+			return &matcher.rule, nil, err
+		}
+		s.fired[matcher.rule.ID] = true
+		payload, err := appendChecksum(response, s.checksum)
+		return &matcher.rule, payload, err
+	}
+	return nil, nil, nil
+}
+
+// scheduleAutoReply 按规则延迟执行应答，无延迟时同步执行以保证应答顺序
+func scheduleAutoReply(rule *types.AutoReplyRule, reply func()) {
+	if rule.DelayMs <= 0 {
+		reply()
+		return
+	}
+	time.AfterFunc(time.Duration(rule.DelayMs)*time.Millisecond, reply)
+}
@@ -0,0 +1,100 @@
+package control
+
+import (
+	"connectivity/types"
+	"testing"
+)
+
+func TestAutoReplyMatch(t *testing.T) {
+	cases := []struct {
+		rule  types.AutoReplyRule
+		input string
+		want  string
+		match bool
+	}{
+		{types.AutoReplyRule{MatchType: MatchExact, Pattern: "PING", Response: "PONG"}, "PING", "PONG", true},
+		{types.AutoReplyRule{MatchType: MatchExact, Pattern: "PING", Response: "PONG"}, "PING1", "", false},
+		{types.AutoReplyRule{MatchType: MatchPrefix, Pattern: `AT\r`, PatternInput: InputEscape, Response: "OK"}, "AT\r\n", "OK", true},
+		{types.AutoReplyRule{MatchType: MatchHex, Pattern: "AA 55 ?? 01", Response: "06", ResponseInput: InputHex}, "\xAA\x55\x07\x01\xFF", "\x06", true},
+		{types.AutoReplyRule{MatchType: MatchHex, Pattern: "AA55??01", Response: "06", ResponseInput: InputHex}, "\xAA\x56\x07\x01", "", false},
+		{types.AutoReplyRule{MatchType: MatchRegex, Pattern: `^GET (\w+)`, Response: "VALUE $1=42"}, "GET temp", "VALUE temp=42", true},
+	}
+	for _, c := range cases {
+		matcher, err := compileAutoReplyRule(c.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, ok, err := matcher.match([]byte(c.input), CharsetUTF8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != c.match || (ok && string(got) != c.want) {
+			t.Fatalf("rule %+v input %q: got %q %v", c.rule, c.input, got, ok)
+		}
+	}
+}
+
+func TestAutoReplyInvalidRule(t *testing.T) {
+	for _, rule := range []types.AutoReplyRule{
+		{MatchType: "contains", Pattern: "a"},
+		{MatchType: MatchRegex, Pattern: "("},
+		{MatchType: MatchHex, Pattern: "AA5"},
+		{MatchType: MatchExact, Pattern: "a", Mode: "twice"},
+		{MatchType: MatchExact, Pattern: "a", Response: "zz", ResponseInput: InputHex},
+	} {
+		if _, err := compileAutoReplyRule(rule); err == nil {
+			t.Fatalf("规则 %+v 应返回错误", rule)
+		}
+	}
+}
+
+func TestAutoReplySessionOnce(t *testing.T) {
+	autoReplyRules.mu.Lock()
+	matcher, _ := compileAutoReplyRule(types.AutoReplyRule{ID: 1, MatchType: MatchExact, Pattern: "hi", Response: "hello", Mode: ReplyOnce})
+	autoReplyRules.rules[-1] = []*autoReplyMatcher{matcher}
+	autoReplyRules.mu.Unlock()
+	defer autoReplyRules.invalidate()
+
+	session := newAutoReplySession(types.Server{ID: -1})
+	if rule, _, _ := session.match(nil, []byte("hi")); rule == nil {
+		t.Fatal("首次应命中")
+	}
+	if rule, _, _ := session.match(nil, []byte("hi")); rule != nil {
+		t.Fatal("once 规则不应再次触发")
+	}
+	if rule, _, _ := newAutoReplySession(types.Server{ID: -1}).match(nil, []byte("hi")); rule == nil {
+		t.Fatal("新连接应重新触发")
+	}
+}
+
+func TestAutoReplySessionChecksum(t *testing.T) {
+	autoReplyRules.mu.Lock()
+	matcher, _ := compileAutoReplyRule(types.AutoReplyRule{ID: 1, MatchType: MatchExact, Pattern: "hi", Response: "01 03", ResponseInput: InputHex})
+	autoReplyRules.rules[-1] = []*autoReplyMatcher{matcher}
+	autoReplyRules.mu.Unlock()
+	defer autoReplyRules.invalidate()
+
+	session := newAutoReplySession(types.Server{ID: -1, Checksum: types.ChecksumConfig{Algorithm: ChecksumSum8, Append: true}})
+	_, payload, err := session.match(nil, []byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != "\x01\x03\x04" {
+		t.Fatalf("payload = % X", payload)
+	}
+}
+
+func TestAutoReplyCharset(t *testing.T) {
+	exact, _ := compileAutoReplyRule(types.AutoReplyRule{MatchType: MatchExact, Pattern: "hi", Response: "你好"})
+	got, ok, err := exact.match([]byte("hi"), CharsetGBK)
+	if err != nil || !ok || string(got) != "\xC4\xE3\xBA\xC3" {
+		t.Fatalf("exact: % X %v %v", got, ok, err)
+	}
+
+	// 分组引用收到的原始字节，模板文本按目标编码转换
+	regex, _ := compileAutoReplyRule(types.AutoReplyRule{MatchType: MatchRegex, Pattern: `^GET (\w+)`, Response: "值 $1"})
+	got, ok, err = regex.match([]byte("GET temp"), CharsetGBK)
+	if err != nil || !ok || string(got) != "\xD6\xB5 temp" {
+		t.Fatalf("regex: % X %v %v", got, ok, err)
+	}
+}
@@ -0,0 +1,446 @@
+package control
+
+import (
+	"connectivity/models"
+	"connectivity/types"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultAutomationPort 自动化接口的默认端口
+const defaultAutomationPort = 17890
+
+// automationEventBuffer 每个事件流缓存的事件数，脚本读取过慢时丢弃新事件，不阻塞收发
+const automationEventBuffer = 256
+
+// automationMaxBody 请求体大小上限
+const automationMaxBody = 16 << 20
+
+// FuncAutomation 仅监听 127.0.0.1 的 HTTP/WebSocket 自动化接口，供测试脚本在窗口运行时调用客户端、服务端与消息查询功能。
+// 接口返回与绑定方法相同的 ConnectResult，操作失败时 HTTP 状态码仍为 200，由 success 字段区分
+type FuncAutomation struct {
+	mu        sync.Mutex
+	Ctx       context.Context
+	Events    *FanoutSink
+	TcpClient *FuncTcpClient
+	UdpClient *FuncUdpClient
+	TcpServer *FuncTcpServer
+	UdpServer *FuncUdpServer
+	Message   *Message
+
+	server *http.Server
+	stop   chan struct{} // 停止时关闭，用于结束事件流
+	addr   string
+	token  string
+}
+
+// automationSend 发送与广播请求
+type automationSend struct {
+	ConnID      int    `json:"conn_id"`      // 服务端连接，仅用于服务端发送
+	Message     string `json:"message"`      // 发送内容
+	InputMethod string `json:"input_method"` // 输入方式: text/hex/base64/escape，为空时按文本发送
+	Filter      string `json:"filter"`       // 广播的 IP/CIDR 过滤，逗号分隔
+}
+
+// automationEvent 事件流中的一条消息，与 Wails 前端收到的事件名和数据相同
+type automationEvent struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// StartAutomation 启动自动化接口，返回监听地址与访问令牌
+func (a *FuncAutomation) StartAutomation(config types.AutomationConfig) types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.server != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: "自动化接口已运行",
+			Data:    a.status(),
+		}
+	}
+
+	port := config.Port
+	if port == 0 {
+		port = defaultAutomationPort
+	}
+	if port < 0 || port > 65535 {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("端口无效: %d", port),
+		}
+	}
+	token := config.Token
+	if token == "" {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return types.ConnectResult{
+				Success: false,
+				Message: fmt.Sprintf("生成令牌失败: %v", err),
+			}
+		}
+		token = hex.EncodeToString(buf)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("启动失败: %v", err),
+		}
+	}
+	stop := make(chan struct{})
+	server := &http.Server{
+		Handler:           a.handler(token, stop),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logError(a.Events, fmt.Sprintf("自动化接口已停止: %v", err))
+		}
+	}()
+
+	a.server, a.stop, a.addr, a.token = server, stop, listener.Addr().String(), token
+	return types.ConnectResult{
+		Success: true,
+		Message: "自动化接口已启动: http://" + a.addr,
+		Data:    a.status(),
+	}
+}
+
+// StopAutomation 停止自动化接口并断开事件流
+func (a *FuncAutomation) StopAutomation() types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.server == nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: "自动化接口未运行",
+		}
+	}
+	close(a.stop)
+	err := a.server.Close()
+	a.server, a.stop, a.addr, a.token = nil, nil, "", ""
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("停止失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "自动化接口已停止",
+	}
+}
+
+// GetAutomationStatus 获取自动化接口的运行状态
+func (a *FuncAutomation) GetAutomationStatus() types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return types.ConnectResult{
+		Success: true,
+		Data:    a.status(),
+	}
+}
+
+func (a *FuncAutomation) status() types.AutomationStatus {
+	return types.AutomationStatus{Running: a.server != nil, Addr: a.addr, Token: a.token}
+}
+
+// handler 自动化接口的路由，所有请求都需要携带令牌
+func (a *FuncAutomation) handler(token string, stop <-chan struct{}) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/{protocol}/clients", a.listClients)
+	mux.HandleFunc("POST /api/{protocol}/clients", a.addClient)
+	mux.HandleFunc("POST /api/{protocol}/clients/{id}/connect", a.clientAction)
+	mux.HandleFunc("POST /api/{protocol}/clients/{id}/disconnect", a.clientAction)
+	mux.HandleFunc("POST /api/{protocol}/clients/{id}/send", a.clientSend)
+	mux.HandleFunc("GET /api/{protocol}/servers", a.listServers)
+	mux.HandleFunc("POST /api/{protocol}/servers", a.addServer)
+	mux.HandleFunc("POST /api/{protocol}/servers/{id}/start", a.serverAction)
+	mux.HandleFunc("POST /api/{protocol}/servers/{id}/stop", a.serverAction)
+	mux.HandleFunc("POST /api/{protocol}/servers/{id}/send", a.serverSend)
+	mux.HandleFunc("POST /api/{protocol}/servers/{id}/broadcast", a.serverSend)
+	mux.HandleFunc("POST /api/messages/query", a.queryMessages)
+	mux.HandleFunc("GET /api/events", a.streamEvents(stop))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			given = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeAutomationError(w, http.StatusUnauthorized, "令牌无效")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, automationMaxBody)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func writeAutomationResult(w http.ResponseWriter, status int, result types.ConnectResult) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+func writeAutomationError(w http.ResponseWriter, status int, message string) {
+	writeAutomationResult(w, status, types.ConnectResult{Success: false, Message: message})
+}
+
+// automationRequest 解析路径中的协议与标识以及 JSON 请求体，body 为 nil 时不读取请求体
+func automationRequest(w http.ResponseWriter, r *http.Request, body interface{}) (protocol string, id int, ok bool) {
+	protocol = r.PathValue("protocol")
+	if protocol != "tcp" && protocol != "udp" {
+		writeAutomationError(w, http.StatusNotFound, fmt.Sprintf("不支持的协议: %s", protocol))
+		return "", 0, false
+	}
+	if raw := r.PathValue("id"); raw != "" {
+		var err error
+		if id, err = strconv.Atoi(raw); err != nil {
+			writeAutomationError(w, http.StatusBadRequest, fmt.Sprintf("标识无效: %s", raw))
+			return "", 0, false
+		}
+	}
+	if body != nil {
+		if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+			writeAutomationError(w, http.StatusBadRequest, fmt.Sprintf("请求体格式错误: %v", err))
+			return "", 0, false
+		}
+	}
+	return protocol, id, true
+}
+
+func (a *FuncAutomation) listClients(w http.ResponseWriter, r *http.Request) {
+	protocol, _, ok := automationRequest(w, r, nil)
+	if !ok {
+		return
+	}
+	if protocol == "udp" {
+		writeAutomationResult(w, http.StatusOK, a.UdpClient.GetAllUdpClients())
+		return
+	}
+	writeAutomationResult(w, http.StatusOK, a.TcpClient.GetAllTCPClients())
+}
+
+// addClient 添加客户端，成功时返回新客户端的完整配置（含 id）
+func (a *FuncAutomation) addClient(w http.ResponseWriter, r *http.Request) {
+	var config types.ServerClient
+	protocol, _, ok := automationRequest(w, r, &config)
+	if !ok {
+		return
+	}
+	config.Type = protocol
+	var result types.ConnectResult
+	if protocol == "udp" {
+		result = a.UdpClient.AddUdpClient(config)
+	} else {
+		result = a.TcpClient.AddTCPClient(config)
+	}
+	if result.Success {
+		if id, err := models.FindServerClientByAddr(a.Message.Db, protocol, config.Host, config.Port); err == nil && id != 0 {
+			result.Data, _ = models.FindServerClientOne(a.Message.Db, id)
+		}
+	}
+	writeAutomationResult(w, http.StatusOK, result)
+}
+
+func (a *FuncAutomation) clientAction(w http.ResponseWriter, r *http.Request) {
+	protocol, id, ok := automationRequest(w, r, nil)
+	if !ok {
+		return
+	}
+	connect := strings.HasSuffix(r.URL.Path, "/connect")
+	var result types.ConnectResult
+	switch {
+	case protocol == "udp" && connect:
+		result = a.UdpClient.ConnectUdpClient(id)
+	case protocol == "udp":
+		result = a.UdpClient.DisconnectUdpClient(id)
+	case connect:
+		result = a.TcpClient.ConnectTCPClient(id)
+	default:
+		result = a.TcpClient.DisconnectTCPClient(id)
+	}
+	writeAutomationResult(w, http.StatusOK, result)
+}
+
+func (a *FuncAutomation) clientSend(w http.ResponseWriter, r *http.Request) {
+	var req automationSend
+	protocol, id, ok := automationRequest(w, r, &req)
+	if !ok {
+		return
+	}
+	if protocol == "udp" {
+		writeAutomationResult(w, http.StatusOK, a.UdpClient.SendMessage(id, req.Message, req.InputMethod))
+		return
+	}
+	writeAutomationResult(w, http.StatusOK, a.TcpClient.SendMessage(id, req.Message, req.InputMethod))
+}
+
+func (a *FuncAutomation) listServers(w http.ResponseWriter, r *http.Request) {
+	protocol, _, ok := automationRequest(w, r, nil)
+	if !ok {
+		return
+	}
+	if protocol == "udp" {
+		writeAutomationResult(w, http.StatusOK, a.UdpServer.GetAllUdpServers())
+		return
+	}
+	writeAutomationResult(w, http.StatusOK, a.TcpServer.GetAllTCPServers())
+}
+
+// addServer 添加服务端，成功时返回新服务端的完整配置（含 id）
+func (a *FuncAutomation) addServer(w http.ResponseWriter, r *http.Request) {
+	var config types.Server
+	protocol, _, ok := automationRequest(w, r, &config)
+	if !ok {
+		return
+	}
+	config.Type = protocol
+	var result types.ConnectResult
+	if protocol == "udp" {
+		result = a.UdpServer.AddUdpServer(config)
+	} else {
+		result = a.TcpServer.AddTCPServer(config)
+	}
+	if result.Success {
+		if id, err := models.FindServerByAddr(a.Message.Db, protocol, config.Host, config.Port); err == nil && id != 0 {
+			result.Data, _ = models.FindServerOne(a.Message.Db, id)
+		}
+	}
+	writeAutomationResult(w, http.StatusOK, result)
+}
+
+func (a *FuncAutomation) serverAction(w http.ResponseWriter, r *http.Request) {
+	protocol, id, ok := automationRequest(w, r, nil)
+	if !ok {
+		return
+	}
+	start := strings.HasSuffix(r.URL.Path, "/start")
+	var result types.ConnectResult
+	switch {
+	case protocol == "udp" && start:
+		result = a.UdpServer.StartUdpServer(id)
+	case protocol == "udp":
+		result = a.UdpServer.StopUdpServer(id)
+	case start:
+		result = a.TcpServer.StartTCPServer(id)
+	default:
+		result = a.TcpServer.StopTCPServer(id)
+	}
+	writeAutomationResult(w, http.StatusOK, result)
+}
+
+// serverSend 向指定连接发送（send）或向全部连接广播（broadcast）
+func (a *FuncAutomation) serverSend(w http.ResponseWriter, r *http.Request) {
+	var req automationSend
+	protocol, id, ok := automationRequest(w, r, &req)
+	if !ok {
+		return
+	}
+	broadcast := strings.HasSuffix(r.URL.Path, "/broadcast")
+	var result types.ConnectResult
+	switch {
+	case protocol == "udp" && broadcast:
+		result = a.UdpServer.BroadcastMessage(id, req.Message, req.InputMethod, req.Filter)
+	case protocol == "udp":
+		result = a.UdpServer.SendMessageEncoded(id, req.ConnID, req.Message, req.InputMethod)
+	case broadcast:
+		result = a.TcpServer.BroadcastMessage(id, req.Message, req.InputMethod, req.Filter)
+	default:
+		result = a.TcpServer.SendMessageEncoded(id, req.ConnID, req.Message, req.InputMethod)
+	}
+	writeAutomationResult(w, http.StatusOK, result)
+}
+
+func (a *FuncAutomation) queryMessages(w http.ResponseWriter, r *http.Request) {
+	var query types.MessageQuery
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		writeAutomationError(w, http.StatusBadRequest, fmt.Sprintf("请求体格式错误: %v", err))
+		return
+	}
+	writeAutomationResult(w, http.StatusOK, a.Message.QueryMessages(query))
+}
+
+// streamSink 将事件转发给一个 WebSocket 事件流，缓冲区满时丢弃
+type streamSink struct {
+	events chan automationEvent
+	names  map[string]bool // 只转发的事件名，为空时全部转发
+}
+
+func (s *streamSink) Emit(name string, data interface{}) {
+	if len(s.names) > 0 && !s.names[name] {
+		return
+	}
+	select {
+	case s.events <- automationEvent{Event: name, Data: data}:
+	default:
+	}
+}
+
+func (s *streamSink) LogError(message string) {
+	s.Emit(LogErrorEvent, message)
+}
+
+// streamEvents 以 WebSocket 推送事件，每条消息为 {"event": 事件名, "data": 数据}，
+// events 查询参数为逗号分隔的事件名，如 client_event,server_event
+func (a *FuncAutomation) streamEvents(stop <-chan struct{}) http.HandlerFunc {
+	// 请求已通过令牌校验，不再限制来源
+	upgrader := &websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	return func(w http.ResponseWriter, r *http.Request) {
+		sink := &streamSink{events: make(chan automationEvent, automationEventBuffer), names: map[string]bool{}}
+		for _, name := range strings.Split(r.URL.Query().Get("events"), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				sink.names[name] = true
+			}
+		}
+		// 升级前订阅，握手完成后发生的事件不会遗漏
+		remove := a.Events.Add(sink)
+		defer remove()
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		// 读取并丢弃客户端消息，连接关闭时结束推送
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := ws.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		for {
+			select {
+			case event := <-sink.events:
+				ws.SetWriteDeadline(time.Now().Add(5 * time.Second))
+				if err := ws.WriteJSON(event); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			case <-stop:
+				ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "automation stopped"), time.Now().Add(time.Second))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package control
+
+import (
+	"connectivity/types"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const testAutomationToken = "secret"
+
+func newTestAutomation(t *testing.T) (*FuncAutomation, *httptest.Server) {
+	db := openMessageDB(t)
+	events := NewFanoutSink()
+	a := &FuncAutomation{
+		Events: events,
+		TcpServer: &FuncTcpServer{
+			Servers: make(map[int]NetListener),
+			Conn:    make(map[int]ServerConn),
+			Events:  events,
+			Db:      db,
+		},
+		Message: &Message{Db: db, Events: events},
+	}
+	stop := make(chan struct{})
+	server := httptest.NewServer(a.handler(testAutomationToken, stop))
+	t.Cleanup(func() {
+		close(stop)
+		server.Close()
+	})
+	return a, server
+}
+
+// callAutomation 发送带令牌的请求并解析 ConnectResult
+func callAutomation(t *testing.T, server *httptest.Server, method string, path string, body string) (int, types.ConnectResult) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAutomationToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result types.ConnectResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestAutomationToken(t *testing.T) {
+	_, server := newTestAutomation(t)
+	resp, err := http.Get(server.URL + "/api/tcp/servers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status without token = %d", resp.StatusCode)
+	}
+	resp, err = http.Get(server.URL + "/api/tcp/servers?token=" + testAutomationToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status with query token = %d", resp.StatusCode)
+	}
+	if status, _ := callAutomation(t, server, http.MethodGet, "/api/ws/servers", ""); status != http.StatusNotFound {
+		t.Fatalf("unknown protocol status = %d", status)
+	}
+	if status, _ := callAutomation(t, server, http.MethodPost, "/api/tcp/servers", "{"); status != http.StatusBadRequest {
+		t.Fatalf("bad body status = %d", status)
+	}
+}
+
+func TestAutomationServerAndEvents(t *testing.T) {
+	_, server := newTestAutomation(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	_, result := callAutomation(t, server, http.MethodPost, "/api/tcp/servers", `{"host":"127.0.0.1","port":`+strconv.Itoa(port)+`}`)
+	if !result.Success {
+		t.Fatal(result.Message)
+	}
+	serverID := int(result.Data.(map[string]interface{})["id"].(float64))
+	path := "/api/tcp/servers/" + strconv.Itoa(serverID)
+	if _, result := callAutomation(t, server, http.MethodPost, path+"/start", ""); !result.Success {
+		t.Fatal(result.Message)
+	}
+	defer callAutomation(t, server, http.MethodPost, path+"/stop", "")
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/events?events=server_event&token="+testAutomationToken, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	var mu sync.Mutex
+	var received []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var event struct {
+				Event string            `json:"event"`
+				Data  types.ServerEvent `json:"data"`
+			}
+			if err := ws.ReadJSON(&event); err != nil {
+				return
+			}
+			mu.Lock()
+			received = append(received, event.Event+"/"+event.Data.Type)
+			mu.Unlock()
+			if event.Data.Type == "data_received" {
+				return
+			}
+		}
+	}()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for events")
+	}
+	mu.Lock()
+	if strings.Join(received, ",") != "server_event/connection_status,server_event/data_received" {
+		t.Fatalf("events = %v", received)
+	}
+	mu.Unlock()
+
+	if _, result := callAutomation(t, server, http.MethodPost, path+"/broadcast", `{"message":"pong"}`); !result.Success {
+		t.Fatal(result.Message)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 4)
+	if _, err := conn.Read(buf); err != nil || string(buf) != "pong" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+
+	_, result = callAutomation(t, server, http.MethodPost, "/api/messages/query", `{"server_id":`+strconv.Itoa(serverID)+`}`)
+	if !result.Success {
+		t.Fatal(result.Message)
+	}
+	messages := result.Data.(map[string]interface{})["messages"].([]interface{})
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(messages))
+	}
+}
@@ -0,0 +1,80 @@
+package control
+
+import (
+	"connectivity/types"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// broadcastWriteTimeout 广播时单个连接的写超时，避免慢连接阻塞其余连接
+const broadcastWriteTimeout = 5 * time.Second
+
+// addrFilter 按 IP 或 CIDR 过滤广播目标
+type addrFilter []*net.IPNet
+
+// parseAddrFilter 解析逗号或空白分隔的 IP/CIDR 列表，为空时匹配全部地址
+func parseAddrFilter(filter string) (addrFilter, error) {
+	var nets addrFilter
+	for _, item := range strings.FieldsFunc(filter, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\n'
+	}) {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("无效的 IP 地址: %s", item)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的网段: %s", item)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func (f addrFilter) match(ip net.IP) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, ipNet := range f {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcastSummary 汇总各连接的发送结果
+func broadcastSummary(results []types.BroadcastResult) types.ConnectResult {
+	if len(results) == 0 {
+		return types.ConnectResult{
+			Success: false,
+			Message: "没有匹配的在线连接",
+			Data:    results,
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Port < results[j].Port
+	})
+	failed := 0
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+	return types.ConnectResult{
+		Success: failed == 0,
+		Message: fmt.Sprintf("广播完成: 成功 %d，失败 %d", len(results)-failed, failed),
+		Data:    results,
+	}
+}
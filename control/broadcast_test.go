@@ -0,0 +1,49 @@
+package control
+
+import (
+	"connectivity/types"
+	"net"
+	"testing"
+)
+
+func TestParseAddrFilter(t *testing.T) {
+	filter, err := parseAddrFilter("192.168.1.0/24, 10.0.0.5 ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{
+		"192.168.1.20": true,
+		"192.168.2.1":  false,
+		"10.0.0.5":     true,
+		"10.0.0.6":     false,
+		"::1":          true,
+	} {
+		if got := filter.match(net.ParseIP(ip)); got != want {
+			t.Fatalf("%s: got %v", ip, got)
+		}
+	}
+
+	empty, _ := parseAddrFilter("")
+	if !empty.match(net.ParseIP("8.8.8.8")) {
+		t.Fatal("空过滤应匹配全部地址")
+	}
+	if _, err := parseAddrFilter("300.1.1.1"); err == nil {
+		t.Fatal("无效地址应返回错误")
+	}
+}
+
+func TestBroadcastSummary(t *testing.T) {
+	if broadcastSummary(nil).Success {
+		t.Fatal("无连接时应失败")
+	}
+	result := broadcastSummary([]types.BroadcastResult{
+		{Port: 2, Success: false, Error: "closed"},
+		{Port: 1, Success: true},
+	})
+	if result.Success || result.Message != "广播完成: 成功 1，失败 1" {
+		t.Fatalf("result = %+v", result)
+	}
+	if results := result.Data.([]types.BroadcastResult); results[0].Port != 1 {
+		t.Fatalf("结果应按端口排序: %+v", results)
+	}
+}
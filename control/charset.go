@@ -0,0 +1,131 @@
+package control
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+// 字符编码，决定文本的发送编码和接收数据的显示解码，原始字节始终保留
+const (
+	CharsetUTF8    = "utf-8"
+	CharsetGBK     = "gbk"
+	CharsetGB18030 = "gb18030"
+	CharsetUTF16LE = "utf-16le"
+	CharsetUTF16BE = "utf-16be"
+	CharsetLatin1  = "latin1"
+)
+
+// normalizeCharset 统一编码名称，空值视为 utf-8
+func normalizeCharset(name string) string {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "utf-8", "utf8":
+		return CharsetUTF8
+	case "gbk", "cp936":
+		return CharsetGBK
+	case "gb18030":
+		return CharsetGB18030
+	case "utf-16le", "utf16le":
+		return CharsetUTF16LE
+	case "utf-16be", "utf16be":
+		return CharsetUTF16BE
+	case "latin1", "latin-1", "iso-8859-1":
+		return CharsetLatin1
+	}
+	return name
+}
+
+// lookupCharset 返回编码实现，utf-8 返回 nil 表示无需转换
+func lookupCharset(name string) (encoding.Encoding, error) {
+	switch normalizeCharset(name) {
+	case CharsetUTF8:
+		return nil, nil
+	case CharsetGBK:
+		return simplifiedchinese.GBK, nil
+	case CharsetGB18030:
+		return simplifiedchinese.GB18030, nil
+	case CharsetUTF16LE:
+		return xunicode.UTF16(xunicode.LittleEndian, xunicode.IgnoreBOM), nil
+	case CharsetUTF16BE:
+		return xunicode.UTF16(xunicode.BigEndian, xunicode.IgnoreBOM), nil
+	case CharsetLatin1:
+		return charmap.ISO8859_1, nil
+	}
+	return nil, fmt.Errorf("不支持的字符编码: %s", name)
+}
+
+func validateCharset(name string) error {
+	_, err := lookupCharset(name)
+	return err
+}
+
+// encodeText 将文本转换为指定编码的字节
+func encodeText(text string, charset string) ([]byte, error) {
+	enc, err := lookupCharset(charset)
+	if err != nil {
+		return nil, err
+	}
+	if enc == nil {
+		return []byte(text), nil
+	}
+	data, err := enc.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		return nil, fmt.Errorf("文本无法转换为 %s 编码: %v", normalizeCharset(charset), err)
+	}
+	return data, nil
+}
+
+// decodeText 按指定编码解码字节，无法解码的字节替换为 U+FFFD
+func decodeText(data []byte, charset string) string {
+	enc, err := lookupCharset(charset)
+	if err != nil || enc == nil {
+		return strings.ToValidUTF8(string(data), "�")
+	}
+	text, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return strings.ToValidUTF8(string(data), "�")
+	}
+	return string(text)
+}
+
+// detectDisplayMethodCharset 按字符编码选择默认显示方式，解码后均为可读字符时显示为 text，否则为 hex
+func detectDisplayMethodCharset(data []byte, charset string) string {
+	enc, err := lookupCharset(charset)
+	if err != nil || enc == nil {
+		return detectDisplayMethod(data)
+	}
+	text, err := enc.NewDecoder().Bytes(data)
+	if err != nil || !utf8.Valid(text) {
+		return DisplayHex
+	}
+	for _, r := range string(text) {
+		if r == utf8.RuneError || (!unicode.IsPrint(r) && !unicode.IsSpace(r)) {
+			return DisplayHex
+		}
+	}
+	return DisplayText
+}
+
+// renderPayloadCharset 按显示方式渲染原始字节，文本显示时按字符编码解码
+func renderPayloadCharset(data []byte, displayMethod string, charset string) string {
+	switch strings.ToLower(displayMethod) {
+	case DisplayHex, DisplayHexDump, DisplayEscape:
+		return RenderPayload(data, displayMethod)
+	}
+	return decodeText(data, charset)
+}
+
+// encodePayloadCharset 解析用户输入，文本输入按字符编码转换，其他输入方式与 EncodePayload 相同
+func encodePayloadCharset(input string, inputMethod string, charset string) ([]byte, error) {
+	switch strings.ToLower(inputMethod) {
+	case InputHex, InputBase64, InputEscape:
+		return EncodePayload(input, inputMethod)
+	}
+	return encodeText(input, charset)
+}
@@ -0,0 +1,82 @@
+package control
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeTextGBK(t *testing.T) {
+	data, err := encodeText("你好", CharsetGBK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte{0xC4, 0xE3, 0xBA, 0xC3}) {
+		t.Fatalf("gbk = % X", data)
+	}
+	if got := decodeText(data, "GBK"); got != "你好" {
+		t.Fatalf("decode = %q", got)
+	}
+	if got := detectDisplayMethodCharset(data, CharsetGBK); got != DisplayText {
+		t.Fatalf("display = %s", got)
+	}
+	if got := detectDisplayMethodCharset(data, CharsetUTF8); got != DisplayHex {
+		t.Fatalf("utf-8 display = %s", got)
+	}
+}
+
+func TestEncodeTextCharsets(t *testing.T) {
+	cases := []struct {
+		charset string
+		text    string
+		want    []byte
+	}{
+		{"", "A", []byte("A")},
+		{CharsetUTF16LE, "A中", []byte{0x41, 0x00, 0x2D, 0x4E}},
+		{CharsetUTF16BE, "A中", []byte{0x00, 0x41, 0x4E, 0x2D}},
+		{CharsetLatin1, "é", []byte{0xE9}},
+		{CharsetGB18030, "€", []byte{0xA2, 0xE3}},
+	}
+	for _, c := range cases {
+		got, err := encodeText(c.text, c.charset)
+		if err != nil || !bytes.Equal(got, c.want) {
+			t.Fatalf("%s: % X, %v", c.charset, got, err)
+		}
+		if back := decodeText(got, c.charset); back != c.text {
+			t.Fatalf("%s: decode = %q", c.charset, back)
+		}
+	}
+
+	if _, err := encodeText("中", CharsetLatin1); err == nil {
+		t.Fatal("latin1 无法表示的字符应报错")
+	}
+	if err := validateCharset("big5"); err == nil {
+		t.Fatal("不支持的编码应校验失败")
+	}
+}
+
+func TestRenderPayloadCharset(t *testing.T) {
+	data := []byte{0xC4, 0xE3}
+	if got := renderPayloadCharset(data, DisplayText, CharsetGBK); got != "你" {
+		t.Fatalf("text = %q", got)
+	}
+	if got := renderPayloadCharset(data, DisplayHex, CharsetGBK); got != RenderPayload(data, DisplayHex) {
+		t.Fatalf("hex = %q", got)
+	}
+}
+
+func TestRenderTemplateCharset(t *testing.T) {
+	got, err := renderTemplate("中{{seq}}{{len:u8}}文", InputText, templateContext{Seq: 1, Charset: CharsetGBK})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0xD6, 0xD0, '1', 0x02, 0xCE, 0xC4}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got % X, want % X", got, want)
+	}
+
+	// 十六进制输入不受字符编码影响
+	got, err = renderTemplate("41 42", InputHex, templateContext{Charset: CharsetUTF16LE})
+	if err != nil || !bytes.Equal(got, []byte("AB")) {
+		t.Fatalf("hex = % X, %v", got, err)
+	}
+}
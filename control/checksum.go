@@ -0,0 +1,185 @@
+package control
+
+import (
+	"bytes"
+	"connectivity/types"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"hash/crc32"
+)
+
+// 校验算法
+const (
+	ChecksumSum8        = "sum8"         // 字节累加和
+	ChecksumXor         = "xor"          // 字节异或
+	ChecksumLRC         = "lrc"          // 纵向冗余校验，累加和取补
+	ChecksumCRC8        = "crc8"         // CRC-8/SMBUS，多项式 0x07
+	ChecksumCRC16Modbus = "crc16_modbus" // CRC-16/MODBUS，默认低字节在前
+	ChecksumCRC16CCITT  = "crc16_ccitt"  // CRC-16/CCITT-FALSE，初值 0xFFFF
+	ChecksumCRC16XModem = "crc16_xmodem" // CRC-16/XMODEM，初值 0
+	ChecksumCRC32       = "crc32"        // CRC-32/IEEE
+	ChecksumAdler32     = "adler32"      // Adler-32
+)
+
+// 接收校验结果
+const (
+	ChecksumOK       = "ok"
+	ChecksumMismatch = "mismatch"
+)
+
+type checksumAlgorithm struct {
+	size   int  // 校验值字节数
+	little bool // 默认是否低字节在前
+	sum    func(data []byte) uint32
+}
+
+var checksumAlgorithms = map[string]checksumAlgorithm{
+	ChecksumSum8:        {1, false, sum8},
+	ChecksumXor:         {1, false, xor8},
+	ChecksumLRC:         {1, false, func(data []byte) uint32 { return -sum8(data) & 0xFF }},
+	ChecksumCRC8:        {1, false, crc8},
+	ChecksumCRC16Modbus: {2, true, func(data []byte) uint32 { return uint32(crc16Modbus(data)) }},
+	ChecksumCRC16CCITT:  {2, false, func(data []byte) uint32 { return uint32(crc16CCITT(data, 0xFFFF)) }},
+	ChecksumCRC16XModem: {2, false, func(data []byte) uint32 { return uint32(crc16CCITT(data, 0)) }},
+	ChecksumCRC32:       {4, false, crc32.ChecksumIEEE},
+	ChecksumAdler32:     {4, false, adler32.Checksum},
+}
+
+// checksumBytes 计算校验值并按字节序编码，endian 为空时使用算法的默认字节序
+func checksumBytes(algorithm string, endian string, data []byte) ([]byte, error) {
+	alg, ok := checksumAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("不支持的校验算法: %s", algorithm)
+	}
+	little := alg.little
+	switch endian {
+	case "":
+	case "little", "le":
+		little = true
+	case "big", "be":
+		little = false
+	default:
+		return nil, fmt.Errorf("不支持的字节序: %s", endian)
+	}
+	out := make([]byte, alg.size)
+	putUint(out, uint64(alg.sum(data)), little)
+	return out, nil
+}
+
+// validateChecksumConfig 校验配置，未启用追加和校验时不做检查
+func validateChecksumConfig(config types.ChecksumConfig) error {
+	if !config.Append && !config.Verify {
+		return nil
+	}
+	if config.Offset < 0 {
+		return errors.New("校验起始偏移不能为负数")
+	}
+	_, err := checksumBytes(config.Algorithm, config.Endian, nil)
+	return err
+}
+
+// appendChecksum 发送前在载荷末尾追加校验值，校验范围从 Offset 开始
+func appendChecksum(payload []byte, config types.ChecksumConfig) ([]byte, error) {
+	if !config.Append {
+		return payload, nil
+	}
+	if config.Offset > len(payload) {
+		return nil, fmt.Errorf("校验起始偏移 %d 超出数据长度 %d", config.Offset, len(payload))
+	}
+	sum, err := checksumBytes(config.Algorithm, config.Endian, payload[config.Offset:])
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte(nil), payload...), sum...), nil
+}
+
+// verifyChecksum 校验接收帧末尾的校验值，未启用时返回空字符串
+func verifyChecksum(frame []byte, config types.ChecksumConfig) string {
+	if !config.Verify {
+		return ""
+	}
+	alg, ok := checksumAlgorithms[config.Algorithm]
+	if !ok || len(frame) < config.Offset+alg.size {
+		return ChecksumMismatch
+	}
+	body := frame[:len(frame)-alg.size]
+	sum, err := checksumBytes(config.Algorithm, config.Endian, body[config.Offset:])
+	if err != nil || !bytes.Equal(sum, frame[len(body):]) {
+		return ChecksumMismatch
+	}
+	return ChecksumOK
+}
+
+func sum8(data []byte) uint32 {
+	var s byte
+	for _, b := range data {
+		s += b
+	}
+	return uint32(s)
+}
+
+func xor8(data []byte) uint32 {
+	var s byte
+	for _, b := range data {
+		s ^= b
+	}
+	return uint32(s)
+}
+
+// crc8 CRC-8/SMBUS，多项式 0x07，初值 0
+func crc8(data []byte) uint32 {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return uint32(crc)
+}
+
+// crc16Modbus CRC-16/MODBUS，多项式 0xA001（反射），初值 0xFFFF
+func crc16Modbus(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// crc16CCITT 多项式 0x1021 的非反射 CRC-16，初值 0xFFFF 为 CCITT-FALSE，0 为 XMODEM
+func crc16CCITT(data []byte, init uint16) uint16 {
+	crc := init
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// encodeOutgoing 渲染发送目标的载荷模板并按字符编码转换文本，再按配置追加校验值
+func encodeOutgoing(key string, message string, inputMethod string, charset string, checksum types.ChecksumConfig) ([]byte, error) {
+	payload, err := renderPayload(key, message, inputMethod, charset)
+	if err != nil {
+		return nil, err
+	}
+	return appendChecksum(payload, checksum)
+}
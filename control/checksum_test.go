@@ -0,0 +1,80 @@
+package control
+
+import (
+	"bytes"
+	"connectivity/types"
+	"testing"
+)
+
+func TestChecksumCheckValues(t *testing.T) {
+	// 各算法对 "123456789" 的标准校验值（大端表示）
+	cases := map[string][]byte{
+		ChecksumSum8:        {0xDD},
+		ChecksumXor:         {0x31},
+		ChecksumLRC:         {0x23},
+		ChecksumCRC8:        {0xF4},
+		ChecksumCRC16Modbus: {0x4B, 0x37},
+		ChecksumCRC16CCITT:  {0x29, 0xB1},
+		ChecksumCRC16XModem: {0x31, 0xC3},
+		ChecksumCRC32:       {0xCB, 0xF4, 0x39, 0x26},
+		ChecksumAdler32:     {0x09, 0x1E, 0x01, 0xDE},
+	}
+	for algorithm, want := range cases {
+		got, err := checksumBytes(algorithm, "big", []byte("123456789"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: % X, want % X", algorithm, got, want)
+		}
+	}
+
+	// Modbus 默认低字节在前
+	if got, _ := checksumBytes(ChecksumCRC16Modbus, "", []byte("123456789")); !bytes.Equal(got, []byte{0x37, 0x4B}) {
+		t.Fatalf("modbus default: % X", got)
+	}
+	if _, err := checksumBytes("md5", "", nil); err == nil {
+		t.Fatal("不支持的算法应报错")
+	}
+}
+
+func TestAppendAndVerifyChecksum(t *testing.T) {
+	config := types.ChecksumConfig{Algorithm: ChecksumSum8, Offset: 1, Append: true, Verify: true}
+	frame, err := appendChecksum([]byte{0x7E, 0x01, 0x02}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(frame, []byte{0x7E, 0x01, 0x02, 0x03}) {
+		t.Fatalf("frame: % X", frame)
+	}
+	if got := verifyChecksum(frame, config); got != ChecksumOK {
+		t.Fatalf("verify = %s", got)
+	}
+	frame[2] = 0x05
+	if got := verifyChecksum(frame, config); got != ChecksumMismatch {
+		t.Fatalf("verify = %s", got)
+	}
+	if got := verifyChecksum([]byte{0x7E}, config); got != ChecksumMismatch {
+		t.Fatalf("过短的帧应校验失败: %s", got)
+	}
+	if got := verifyChecksum(frame, types.ChecksumConfig{Algorithm: ChecksumSum8}); got != "" {
+		t.Fatalf("未启用时应为空: %s", got)
+	}
+
+	if _, err := appendChecksum([]byte{1}, types.ChecksumConfig{Algorithm: ChecksumSum8, Offset: 2, Append: true}); err == nil {
+		t.Fatal("偏移超出长度应报错")
+	}
+	if err := validateChecksumConfig(types.ChecksumConfig{Algorithm: ChecksumCRC32, Endian: "middle", Verify: true}); err == nil {
+		t.Fatal("无效字节序应报错")
+	}
+}
+
+func TestTemplateChecksumPlaceholder(t *testing.T) {
+	got, err := renderTemplate("123456789{{crc32:le}}", InputText, templateContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got[9:], []byte{0x26, 0x39, 0xF4, 0xCB}) {
+		t.Fatalf("crc32: % X", got)
+	}
+}
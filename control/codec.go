@@ -0,0 +1,246 @@
+package control
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 输入方式
+const (
+	InputText   = "text"   // 原样发送文本
+	InputHex    = "hex"    // 十六进制，支持空格、逗号及 0x 前缀
+	InputBase64 = "base64" // Base64
+	InputEscape = "escape" // C 风格转义，如 \r\n、\x7E、\0
+)
+
+// 显示方式
+const (
+	DisplayText    = "text"    // 按文本解码
+	DisplayHex     = "hex"     // 空格分隔的十六进制
+	DisplayHexDump = "hexdump" // 带偏移和 ASCII 列的十六进制转储
+	DisplayEscape  = "escape"  // ASCII，不可见字符转义
+)
+
+// EncodePayload 按输入方式将用户输入解析为待发送的原始字节
+func EncodePayload(input string, inputMethod string) ([]byte, error) {
+	switch strings.ToLower(inputMethod) {
+	case InputHex:
+		return parseHex(input)
+	case InputBase64:
+		return parseBase64(input)
+	case InputEscape:
+		return parseEscape(input)
+	default:
+		return []byte(input), nil
+	}
+}
+
+// RenderPayload 按显示方式渲染原始字节
+func RenderPayload(data []byte, displayMethod string) string {
+	switch strings.ToLower(displayMethod) {
+	case DisplayHex:
+		return formatHex(data)
+	case DisplayHexDump:
+		return formatHexDump(data)
+	case DisplayEscape:
+		return formatEscape(data)
+	default:
+		return strings.ToValidUTF8(string(data), "�")
+	}
+}
+
+// detectDisplayMethod 为接收到的数据选择默认显示方式：可读文本显示为 text，否则为 hex
+func detectDisplayMethod(data []byte) string {
+	if !utf8.Valid(data) {
+		return DisplayHex
+	}
+	for _, r := range string(data) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return DisplayHex
+		}
+	}
+	return DisplayText
+}
+
+func parseHex(input string) ([]byte, error) {
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ',' || r == ';' || r == ':' || r == '-'
+	})
+	var out []byte
+	for _, field := range fields {
+		if strings.HasPrefix(field, "0x") || strings.HasPrefix(field, "0X") {
+			field = field[2:]
+		}
+		if len(field) == 1 {
+			field = "0" + field
+		}
+		b, err := hex.DecodeString(field)
+		if err != nil {
+			return nil, fmt.Errorf("无效的十六进制数据 %q", field)
+		}
+		out = append(out, b...)
+	}
+	return out, nil
+}
+
+func parseBase64(input string) ([]byte, error) {
+	input = strings.Join(strings.Fields(input), "")
+	encodings := []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding}
+	for _, enc := range encodings {
+		if data, err := enc.DecodeString(input); err == nil {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("无效的 Base64 数据")
+}
+
+func parseEscape(input string) ([]byte, error) {
+	out := make([]byte, 0, len(input))
+	for i := 0; i < len(input); i++ {
+		c := input[i]
+		if c != '\\' {
+			out = append(out, c)
+			continue
+		}
+		i++
+		if i >= len(input) {
+			return nil, fmt.Errorf("转义序列不完整")
+		}
+		switch c = input[i]; c {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'a':
+			out = append(out, '\a')
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'v':
+			out = append(out, '\v')
+		case 'e':
+			out = append(out, 0x1B)
+		case '\\', '\'', '"', '?':
+			out = append(out, c)
+		case 'x':
+			end := i + 1
+			for end < len(input) && end < i+3 && isHexDigit(input[end]) {
+				end++
+			}
+			if end == i+1 {
+				return nil, fmt.Errorf("无效的转义序列 \\x")
+			}
+			v, _ := strconv.ParseUint(input[i+1:end], 16, 8)
+			out = append(out, byte(v))
+			i = end - 1
+		case 'u':
+			if i+5 > len(input) {
+				return nil, fmt.Errorf("无效的转义序列 \\u")
+			}
+			v, err := strconv.ParseUint(input[i+1:i+5], 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("无效的转义序列 \\u%s", input[i+1:i+5])
+			}
+			out = utf8.AppendRune(out, rune(v))
+			i += 4
+		default:
+			if c >= '0' && c <= '7' {
+				end := i
+				for end < len(input) && end < i+3 && input[end] >= '0' && input[end] <= '7' {
+					end++
+				}
+				v, err := strconv.ParseUint(input[i:end], 8, 16)
+				if err != nil || v > 0xFF {
+					return nil, fmt.Errorf("无效的八进制转义 \\%s", input[i:end])
+				}
+				out = append(out, byte(v))
+				i = end - 1
+				continue
+			}
+			return nil, fmt.Errorf("未知的转义序列 \\%c", c)
+		}
+	}
+	return out, nil
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func formatHex(data []byte) string {
+	var b strings.Builder
+	for i, c := range data {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%02X", c)
+	}
+	return b.String()
+}
+
+func formatHexDump(data []byte) string {
+	var b strings.Builder
+	for offset := 0; offset < len(data); offset += 16 {
+		end := offset + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		fmt.Fprintf(&b, "%08X  ", offset)
+		for i := offset; i < offset+16; i++ {
+			if i < end {
+				fmt.Fprintf(&b, "%02X ", data[i])
+			} else {
+				b.WriteString("   ")
+			}
+			if i == offset+7 {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(" |")
+		for _, c := range data[offset:end] {
+			if c >= 0x20 && c < 0x7F {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteString("|")
+		if end < len(data) {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+func formatEscape(data []byte) string {
+	var b strings.Builder
+	for _, c := range data {
+		switch c {
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case 0:
+			b.WriteString(`\0`)
+		case '\\':
+			b.WriteString(`\\`)
+		default:
+			if c >= 0x20 && c < 0x7F {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, `\x%02X`, c)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package control
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodePayload(t *testing.T) {
+	cases := []struct {
+		input  string
+		method string
+		want   []byte
+	}{
+		{"01 02 FF", InputHex, []byte{0x01, 0x02, 0xFF}},
+		{"0x01,0x02, 0xff", InputHex, []byte{0x01, 0x02, 0xFF}},
+		{"0102ff", InputHex, []byte{0x01, 0x02, 0xFF}},
+		{"AQL/", InputBase64, []byte{0x01, 0x02, 0xFF}},
+		{`AT\r\n\x7E\0\101`, InputEscape, []byte("AT\r\n\x7E\x00A")},
+		{"01 02", InputText, []byte("01 02")},
+	}
+	for _, c := range cases {
+		got, err := EncodePayload(c.input, c.method)
+		if err != nil {
+			t.Fatalf("%s(%q): %v", c.method, c.input, err)
+		}
+		if !bytes.Equal(got, c.want) {
+			t.Fatalf("%s(%q) = % X, want % X", c.method, c.input, got, c.want)
+		}
+	}
+
+	if _, err := EncodePayload("0G", InputHex); err == nil {
+		t.Fatal("expected error for invalid hex")
+	}
+}
+
+func TestRenderPayload(t *testing.T) {
+	data := []byte("A\x00\xFF\r\n")
+	if got := RenderPayload(data, DisplayHex); got != "41 00 FF 0D 0A" {
+		t.Fatalf("hex = %q", got)
+	}
+	if got := RenderPayload(data, DisplayEscape); got != `A\0\xFF\r\n` {
+		t.Fatalf("escape = %q", got)
+	}
+	if got := detectDisplayMethod(data); got != DisplayHex {
+		t.Fatalf("detect = %q", got)
+	}
+	if got := detectDisplayMethod([]byte("你好\r\n")); got != DisplayText {
+		t.Fatalf("detect = %q", got)
+	}
+}
@@ -0,0 +1,115 @@
+package control
+
+import (
+	"context"
+	"sync"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// EventSink 接收推送给前端的事件与错误日志，各功能模块通过 Events 字段注入，为 nil 时丢弃
+type EventSink interface {
+	Emit(name string, data interface{})
+	LogError(message string)
+}
+
+// emitEvent 推送事件，sink 为 nil 时不推送
+func emitEvent(sink EventSink, name string, data interface{}) {
+	if sink != nil {
+		sink.Emit(name, data)
+	}
+}
+
+// logError 记录错误日志，sink 为 nil 时不记录
+func logError(sink EventSink, message string) {
+	if sink != nil {
+		sink.LogError(message)
+	}
+}
+
+// WailsSink 将事件推送到 Wails 前端，Ctx 必须是 Wails 生命周期回调传入的 context
+type WailsSink struct {
+	Ctx context.Context
+}
+
+func (w WailsSink) Emit(name string, data interface{}) {
+	runtime.EventsEmit(w.Ctx, name, data)
+}
+
+func (w WailsSink) LogError(message string) {
+	runtime.LogError(w.Ctx, message)
+}
+
+// LogErrorEvent ChanSink 中错误日志的事件名，Data 为日志内容
+const LogErrorEvent = "log_error"
+
+// Event 通过 ChanSink 传递的事件
+type Event struct {
+	Name string
+	Data interface{}
+}
+
+// ChanSink 将事件和错误日志按顺序写入通道，用于测试与命令行。通道写满时发送方阻塞，消费者需持续读取
+type ChanSink struct {
+	C chan Event
+}
+
+// NewChanSink 创建缓冲区大小为 size 的 ChanSink
+func NewChanSink(size int) *ChanSink {
+	return &ChanSink{C: make(chan Event, size)}
+}
+
+func (c *ChanSink) Emit(name string, data interface{}) {
+	c.C <- Event{Name: name, Data: data}
+}
+
+func (c *ChanSink) LogError(message string) {
+	c.C <- Event{Name: LogErrorEvent, Data: message}
+}
+
+// FanoutSink 将事件转发给多个 EventSink，可在运行中增删接收方
+type FanoutSink struct {
+	mu    sync.RWMutex
+	sinks []EventSink
+}
+
+// NewFanoutSink 创建转发到 sinks 的 FanoutSink
+func NewFanoutSink(sinks ...EventSink) *FanoutSink {
+	return &FanoutSink{sinks: sinks}
+}
+
+// Add 添加接收方，返回的函数用于移除。移除返回后不会再有事件发往该接收方
+func (f *FanoutSink) Add(sink EventSink) (remove func()) {
+	f.mu.Lock()
+	f.sinks = append(f.sinks, sink)
+	f.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			for i, s := range f.sinks {
+				if s == sink {
+					f.sinks = append(f.sinks[:i:i], f.sinks[i+1:]...)
+					return
+				}
+			}
+		})
+	}
+}
+
+func (f *FanoutSink) Emit(name string, data interface{}) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, sink := range f.sinks {
+		sink.Emit(name, data)
+	}
+}
+
+func (f *FanoutSink) LogError(message string) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, sink := range f.sinks {
+		sink.LogError(message)
+	}
+}
@@ -0,0 +1,98 @@
+package control
+
+import (
+	"connectivity/models"
+	"connectivity/types"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFanoutSink(t *testing.T) {
+	a, b := NewChanSink(4), NewChanSink(4)
+	fanout := NewFanoutSink(a)
+	removeB := fanout.Add(b)
+
+	fanout.Emit("client_event", 1)
+	fanout.LogError("添加消息失败")
+	removeB()
+	removeB()
+	fanout.Emit("server_event", 2)
+
+	want := []Event{{"client_event", 1}, {LogErrorEvent, "添加消息失败"}, {"server_event", 2}}
+	for i, w := range want {
+		if got := <-a.C; got != w {
+			t.Fatalf("a[%d] = %v, want %v", i, got, w)
+		}
+	}
+	for i, w := range want[:2] {
+		if got := <-b.C; got != w {
+			t.Fatalf("b[%d] = %v, want %v", i, got, w)
+		}
+	}
+	if len(b.C) != 0 {
+		t.Fatalf("removed sink still receives events: %v", <-b.C)
+	}
+
+	// 未注入时丢弃
+	emitEvent(nil, "client_event", nil)
+	logError(nil, "ignored")
+}
+
+// nextServerEvent 读取下一条 server_event，跳过错误日志
+func nextServerEvent(t *testing.T, sink *ChanSink) types.ServerEvent {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event := <-sink.C:
+			if event.Name == "server_event" {
+				return event.Data.(types.ServerEvent)
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for server_event")
+		}
+	}
+}
+
+func TestTCPServerEventsWithoutWails(t *testing.T) {
+	db := openMessageDB(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	if err := models.AddServer(db, types.Server{Host: "127.0.0.1", Port: port, Status: "stopped", Type: "tcp"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sink := NewChanSink(16)
+	server := &FuncTcpServer{
+		Servers: make(map[int]NetListener),
+		Conn:    make(map[int]ServerConn),
+		Events:  sink,
+		Db:      db,
+	}
+	if resp := server.StartTCPServer(1); !resp.Success {
+		t.Fatal(resp.Message)
+	}
+	defer server.StopTCPServer(1)
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if event := nextServerEvent(t, sink); event.Type != "connection_status" || event.ServerId != 1 {
+		t.Fatalf("first event = %+v", event)
+	}
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	event := nextServerEvent(t, sink)
+	if event.Type != "data_received" || string(event.Message.Payload) != "hello" {
+		t.Fatalf("data event = %+v", event)
+	}
+}
@@ -0,0 +1,306 @@
+package control
+
+import (
+	"bufio"
+	"connectivity/models"
+	"connectivity/types"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// 导出格式
+const (
+	ExportCSV    = "csv"    // CSV 表格，载荷为十六进制和解码后的文本
+	ExportJSONL  = "jsonl"  // 每行一条 JSON 记录
+	ExportText   = "text"   // 可阅读的十六进制转储记录
+	ExportPcapng = "pcapng" // 合成以太网/IP/TCP 或 UDP 首部的抓包文件，可用 Wireshark 打开
+)
+
+// exportBatchSize 导出时每次从数据库读取的条数
+const exportBatchSize = 1000
+
+// exportExtensions 导出格式对应的文件扩展名
+var exportExtensions = map[string]string{
+	ExportCSV:    "csv",
+	ExportJSONL:  "jsonl",
+	ExportText:   "txt",
+	ExportPcapng: "pcapng",
+}
+
+// exportRecord JSON Lines 导出的单条记录
+type exportRecord struct {
+	ID              int    `json:"id"`
+	Timestamp       string `json:"timestamp"`
+	Direction       string `json:"direction"`
+	ClientID        int64  `json:"client_id,omitempty"`
+	ServerID        int64  `json:"server_id,omitempty"`
+	ConnID          string `json:"conn_id,omitempty"`
+	Length          int    `json:"length"`
+	Encoding        string `json:"encoding"`
+	Checksum        string `json:"checksum,omitempty"`
+	PayloadEncoding string `json:"payload_encoding"`
+	Payload         string `json:"payload"`
+}
+
+// messageWriter 按导出格式逐条写出消息
+type messageWriter interface {
+	write(message *types.Message) error
+	flush() error
+}
+
+// validateExport 校验导出参数并补全默认值
+func validateExport(export types.MessageExport) (types.MessageExport, error) {
+	if (export.ClientID == 0) == (export.ServerID == 0) {
+		return export, errors.New("需要指定客户端或服务端")
+	}
+	if export.ClientID != 0 && export.ConnID != 0 {
+		return export, errors.New("连接筛选仅适用于服务端")
+	}
+	export.Format = strings.ToLower(export.Format)
+	if export.Format == "" {
+		export.Format = ExportCSV
+	}
+	if _, ok := exportExtensions[export.Format]; !ok {
+		return export, fmt.Errorf("不支持的导出格式: %s", export.Format)
+	}
+	if export.Format == ExportPcapng && export.ServerID != 0 && export.ConnID == 0 {
+		return export, errors.New("导出 pcapng 需要指定服务端连接")
+	}
+	export.PayloadEncoding = strings.ToLower(export.PayloadEncoding)
+	switch export.PayloadEncoding {
+	case "":
+		export.PayloadEncoding = InputBase64
+	case InputBase64, InputHex:
+	default:
+		return export, fmt.Errorf("不支持的载荷编码: %s", export.PayloadEncoding)
+	}
+	return export, nil
+}
+
+func (m *Message) newMessageWriter(w io.Writer, export types.MessageExport) (messageWriter, error) {
+	switch export.Format {
+	case ExportCSV:
+		cw := &csvMessageWriter{w: csv.NewWriter(w)}
+		return cw, cw.w.Write([]string{"id", "timestamp", "direction", "client_id", "server_id", "conn_id", "length", "encoding", "checksum", "payload_hex", "text"})
+	case ExportJSONL:
+		return &jsonlMessageWriter{enc: json.NewEncoder(w), payloadEncoding: export.PayloadEncoding}, nil
+	case ExportText:
+		return &textMessageWriter{w: w}, nil
+	case ExportPcapng:
+		flow, err := m.resolvePcapFlow(export)
+		if err != nil {
+			return nil, err
+		}
+		return newPcapngMessageWriter(w, flow)
+	}
+	return nil, fmt.Errorf("不支持的导出格式: %s", export.Format)
+}
+
+// exportTimestamp 统一为毫秒精度，旧记录只精确到秒
+func exportTimestamp(timestamp string) string {
+	if len(timestamp) == len("2006-01-02 15:04:05") {
+		return timestamp + ".000"
+	}
+	return timestamp
+}
+
+type csvMessageWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvMessageWriter) write(message *types.Message) error {
+	return c.w.Write([]string{
+		strconv.Itoa(message.ID),
+		exportTimestamp(message.Timestamp),
+		message.Direction,
+		strconv.FormatInt(message.ClientID, 10),
+		strconv.FormatInt(message.ServerID, 10),
+		message.ConnID,
+		strconv.Itoa(len(message.Payload)),
+		message.Encoding,
+		message.Checksum,
+		strings.ToUpper(hex.EncodeToString(message.Payload)),
+		decodeText(message.Payload, message.Encoding),
+	})
+}
+
+func (c *csvMessageWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlMessageWriter struct {
+	enc             *json.Encoder
+	payloadEncoding string
+}
+
+func (j *jsonlMessageWriter) write(message *types.Message) error {
+	record := exportRecord{
+		ID:              message.ID,
+		Timestamp:       exportTimestamp(message.Timestamp),
+		Direction:       message.Direction,
+		ClientID:        message.ClientID,
+		ServerID:        message.ServerID,
+		ConnID:          message.ConnID,
+		Length:          len(message.Payload),
+		Encoding:        message.Encoding,
+		Checksum:        message.Checksum,
+		PayloadEncoding: j.payloadEncoding,
+	}
+	if j.payloadEncoding == InputHex {
+		record.Payload = hex.EncodeToString(message.Payload)
+	} else {
+		record.Payload = base64.StdEncoding.EncodeToString(message.Payload)
+	}
+	return j.enc.Encode(record)
+}
+
+func (j *jsonlMessageWriter) flush() error {
+	return nil
+}
+
+type textMessageWriter struct {
+	w io.Writer
+}
+
+func (t *textMessageWriter) write(message *types.Message) error {
+	arrow := "<<"
+	if message.Direction == "outgoing" {
+		arrow = ">>"
+	}
+	header := fmt.Sprintf("[%s] %s %s %d 字节", exportTimestamp(message.Timestamp), arrow, message.Direction, len(message.Payload))
+	if message.ConnID != "" {
+		header += " 连接 " + message.ConnID
+	}
+	if message.Checksum != "" {
+		header += " 校验 " + message.Checksum
+	}
+	_, err := fmt.Fprintf(t.w, "%s\n%s\n\n", header, formatHexDump(message.Payload))
+	return err
+}
+
+func (t *textMessageWriter) flush() error {
+	return nil
+}
+
+// writeMessages 分批读取符合条件的消息并写出，返回导出条数
+func writeMessages(m *Message, w io.Writer, export types.MessageExport) (int, error) {
+	mw, err := m.newMessageWriter(w, export)
+	if err != nil {
+		return 0, err
+	}
+	filter := models.MessageFilter{
+		ClientID: export.ClientID,
+		ServerID: export.ServerID,
+		ConnID:   export.ConnID,
+		Limit:    exportBatchSize,
+	}
+	count := 0
+	for {
+		m.mu.Lock()
+		messages, more, err := models.QueryMessages(m.Db, filter)
+		m.mu.Unlock()
+		if err != nil {
+			return count, err
+		}
+		for _, message := range messages {
+			if err := mw.write(message); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if !more {
+			break
+		}
+		filter.AfterID = messages[len(messages)-1].ID
+	}
+	return count, mw.flush()
+}
+
+// exportToFile 将消息导出到文件
+func (m *Message) exportToFile(path string, export types.MessageExport) (int, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(file)
+	count, err := writeMessages(m, w, export)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return count, err
+}
+
+// ExportMessages 导出客户端、服务端或单个连接的消息到 CSV、JSON Lines、文本或 pcapng 文件，未指定路径时弹出保存对话框
+func (m *Message) ExportMessages(export types.MessageExport) types.ConnectResult {
+	export, err := validateExport(export)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("导出参数错误: %v", err),
+		}
+	}
+
+	path := export.Path
+	if path == "" {
+		ext := exportExtensions[export.Format]
+		path, err = runtime.SaveFileDialog(m.Ctx, runtime.SaveDialogOptions{
+			Title:           "导出消息",
+			DefaultFilename: exportFilename(export),
+			Filters: []runtime.FileFilter{
+				{DisplayName: strings.ToUpper(ext) + " 文件 (*." + ext + ")", Pattern: "*." + ext},
+			},
+		})
+		if err != nil {
+			return types.ConnectResult{
+				Success: false,
+				Message: fmt.Sprintf("打开保存对话框失败: %v", err),
+			}
+		}
+		if path == "" {
+			return types.ConnectResult{
+				Success: false,
+				Message: "已取消导出",
+			}
+		}
+	}
+
+	count, err := m.exportToFile(path, export)
+	if err != nil {
+		logError(m.Events, fmt.Sprintf("导出消息到 %s 失败: %v", path, err))
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("导出消息失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: fmt.Sprintf("已导出 %d 条消息到 %s", count, path),
+		Data:    path,
+	}
+}
+
+// exportFilename 保存对话框的默认文件名
+func exportFilename(export types.MessageExport) string {
+	name := fmt.Sprintf("client-%d", export.ClientID)
+	if export.ServerID != 0 {
+		name = fmt.Sprintf("server-%d", export.ServerID)
+		if export.ConnID != 0 {
+			name += fmt.Sprintf("-conn-%d", export.ConnID)
+		}
+	}
+	return name + "." + exportExtensions[export.Format]
+}
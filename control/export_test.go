@@ -0,0 +1,101 @@
+package control
+
+import (
+	"bytes"
+	"connectivity/models"
+	"connectivity/types"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func seedExportMessages(t *testing.T) *Message {
+	m := &Message{Db: openMessageDB(t)}
+	models.AddMessageServer(m.Db, 1, 7, []byte("hello"), "tcp", "text", "utf-8", "incoming")
+	models.AddMessageServer(m.Db, 1, 7, []byte{0xC4, 0xE3, 0x00}, "hex", "hex", "gbk", "outgoing")
+	models.AddMessageServer(m.Db, 1, 8, []byte("other"), "tcp", "text", "utf-8", "incoming")
+	return m
+}
+
+func TestExportCSV(t *testing.T) {
+	m := seedExportMessages(t)
+	var buf bytes.Buffer
+	count, err := writeMessages(m, &buf, types.MessageExport{ServerID: 1, ConnID: 7, Format: ExportCSV})
+	if err != nil || count != 2 {
+		t.Fatalf("count=%d err=%v", count, err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0][0] != "id" {
+		t.Fatalf("records = %q", records)
+	}
+	row := records[2]
+	if row[2] != "outgoing" || row[9] != "C4E300" || row[10] != "你\x00" {
+		t.Fatalf("row = %q", row)
+	}
+	if len(row[1]) != len(models.TimestampLayout) {
+		t.Fatalf("timestamp = %s", row[1])
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	m := seedExportMessages(t)
+	for _, c := range []struct{ encoding, want string }{{"", "xOMA"}, {InputHex, "c4e300"}} {
+		export, err := validateExport(types.MessageExport{ServerID: 1, Format: ExportJSONL, PayloadEncoding: c.encoding})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if count, err := writeMessages(m, &buf, export); err != nil || count != 3 {
+			t.Fatalf("count=%d err=%v", count, err)
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		var record exportRecord
+		if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record.Payload != c.want || record.Direction != "outgoing" || record.ConnID != "7" || record.Length != 3 {
+			t.Fatalf("record = %+v", record)
+		}
+	}
+}
+
+func TestExportTextFile(t *testing.T) {
+	m := seedExportMessages(t)
+	path := filepath.Join(t.TempDir(), "out.txt")
+	resp := m.ExportMessages(types.MessageExport{ServerID: 1, ConnID: 8, Format: ExportText, Path: path})
+	if !resp.Success {
+		t.Fatal(resp.Message)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	if !strings.Contains(text, "<< incoming 5 字节 连接 8") || !strings.Contains(text, "|other|") {
+		t.Fatalf("text = %s", text)
+	}
+}
+
+func TestValidateExport(t *testing.T) {
+	bad := []types.MessageExport{
+		{},
+		{ClientID: 1, ServerID: 1},
+		{ClientID: 1, ConnID: 1},
+		{ClientID: 1, Format: "xml"},
+		{ClientID: 1, Format: ExportJSONL, PayloadEncoding: "escape"},
+	}
+	for _, export := range bad {
+		if _, err := validateExport(export); err == nil {
+			t.Fatalf("应校验失败: %+v", export)
+		}
+	}
+	if export, _ := validateExport(types.MessageExport{ClientID: 1}); export.Format != ExportCSV {
+		t.Fatalf("默认格式 = %s", export.Format)
+	}
+}
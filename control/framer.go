@@ -0,0 +1,225 @@
+package control
+
+import (
+	"bytes"
+	"connectivity/types"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// 分帧模式
+const (
+	FrameNone      = ""          // 不分帧，每次读取作为一条消息
+	FrameDelimiter = "delimiter" // 按分隔符分帧
+	FrameFixed     = "fixed"     // 固定长度
+	FrameLength    = "length"    // 长度字段
+	FrameIdle      = "idle"      // 空闲超时
+)
+
+const defaultMaxFrameSize = 64 * 1024
+
+// Framer 流式分帧器，输入任意切分的字节流，输出完整的协议帧
+type Framer interface {
+	// Push 追加数据并返回已完整的帧
+	Push(data []byte) [][]byte
+	// Flush 返回并清空缓冲中未成帧的数据
+	Flush() []byte
+}
+
+type streamFramer struct {
+	config    types.FramerConfig
+	delimiter []byte
+	maxSize   int
+	buf       []byte
+	skip      int64 // 超长帧被截断后仍需丢弃的字节数
+}
+
+// NewFramer 根据配置创建分帧器
+func NewFramer(config types.FramerConfig) (Framer, error) {
+	f := &streamFramer{
+		config:  config,
+		maxSize: config.MaxFrameSize,
+	}
+	if f.maxSize <= 0 {
+		f.maxSize = defaultMaxFrameSize
+	}
+
+	switch config.Mode {
+	case FrameNone, FrameIdle:
+	case FrameDelimiter:
+		delimiter, err := EncodePayload(config.Delimiter, config.DelimiterInput)
+		if err != nil {
+			return nil, fmt.Errorf("分隔符格式错误: %v", err)
+		}
+		if len(delimiter) == 0 {
+			return nil, errors.New("分隔符不能为空")
+		}
+		f.delimiter = delimiter
+	case FrameFixed:
+		if config.FixedLength <= 0 {
+			return nil, errors.New("固定长度必须大于 0")
+		}
+	case FrameLength:
+		switch config.LengthSize {
+		case 1, 2, 4:
+		default:
+			return nil, errors.New("长度字段只支持 1/2/4 字节")
+		}
+		if config.LengthOffset < 0 {
+			return nil, errors.New("长度字段偏移不能为负数")
+		}
+	default:
+		return nil, fmt.Errorf("不支持的分帧模式: %s", config.Mode)
+	}
+	return f, nil
+}
+
+func (f *streamFramer) Push(data []byte) [][]byte {
+	if f.config.Mode == FrameNone {
+		if len(data) == 0 {
+			return nil
+		}
+		return [][]byte{append([]byte(nil), data...)}
+	}
+
+	f.buf = append(f.buf, data...)
+	var frames [][]byte
+	for {
+		if f.skip > 0 {
+			n := min(f.skip, int64(len(f.buf)))
+			f.buf = f.buf[n:]
+			f.skip -= n
+			if f.skip > 0 {
+				break
+			}
+		}
+		n := f.nextFrameLen()
+		if n <= 0 {
+			break
+		}
+		frame := append([]byte(nil), f.buf[:n]...)
+		f.buf = f.buf[n:]
+		if f.config.Mode == FrameDelimiter && !f.config.KeepDelimiter {
+			frame = frame[:len(frame)-len(f.delimiter)]
+		}
+		frames = append(frames, frame)
+	}
+
+	// 超过最大帧长度时强制输出，避免缓冲无限增长
+	if len(f.buf) >= f.maxSize {
+		frames = append(frames, f.Flush())
+	}
+	return frames
+}
+
+func (f *streamFramer) Flush() []byte {
+	if len(f.buf) == 0 {
+		return nil
+	}
+	frame := f.buf
+	f.buf = nil
+	return frame
+}
+
+// nextFrameLen 返回缓冲区中第一个完整帧的长度，不完整时返回 0
+func (f *streamFramer) nextFrameLen() int {
+	switch f.config.Mode {
+	case FrameDelimiter:
+		if i := bytes.Index(f.buf, f.delimiter); i >= 0 {
+			return i + len(f.delimiter)
+		}
+	case FrameFixed:
+		if len(f.buf) >= f.config.FixedLength {
+			return f.config.FixedLength
+		}
+	case FrameLength:
+		header := f.config.LengthOffset + f.config.LengthSize
+		if len(f.buf) < header {
+			return 0
+		}
+		field := f.buf[f.config.LengthOffset:header]
+		var value uint64
+		if f.config.Endian == "little" {
+			switch f.config.LengthSize {
+			case 1:
+				value = uint64(field[0])
+			case 2:
+				value = uint64(binary.LittleEndian.Uint16(field))
+			case 4:
+				value = uint64(binary.LittleEndian.Uint32(field))
+			}
+		} else {
+			switch f.config.LengthSize {
+			case 1:
+				value = uint64(field[0])
+			case 2:
+				value = uint64(binary.BigEndian.Uint16(field))
+			case 4:
+				value = uint64(binary.BigEndian.Uint32(field))
+			}
+		}
+		total := int64(header) + int64(value) + int64(f.config.LengthAdjust)
+		if total < int64(header) {
+			// 长度字段异常，按已读头部输出，避免卡死
+			total = int64(header)
+		}
+		if total > int64(f.maxSize) {
+			// 声明长度超过最大帧长度时输出截断的帧，并丢弃帧体剩余部分，保持后续帧头同步
+			if len(f.buf) < f.maxSize {
+				return 0
+			}
+			f.skip = total - int64(f.maxSize)
+			return f.maxSize
+		}
+		if int64(len(f.buf)) >= total {
+			return int(total)
+		}
+	}
+	return 0
+}
+
+// readFrames 从连接读取数据并按分帧规则逐帧回调，直到连接关闭或出错。
+// 配置了空闲超时时，超过该时间未收到数据则将缓冲中的残留数据作为一帧输出。
+func readFrames(conn net.Conn, config types.FramerConfig, onFrame func([]byte)) error {
+	framer, err := NewFramer(config)
+	if err != nil {
+		return err
+	}
+	idle := time.Duration(config.IdleTimeoutMs) * time.Millisecond
+	if config.Mode == FrameIdle && idle <= 0 {
+		idle = 50 * time.Millisecond
+	}
+
+	buffer := make([]byte, 4096)
+	for {
+		if idle > 0 {
+			conn.SetReadDeadline(time.Now().Add(idle))
+		}
+		n, err := conn.Read(buffer)
+		if n > 0 {
+			for _, frame := range framer.Push(buffer[:n]) {
+				onFrame(frame)
+			}
+		}
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && idle > 0 {
+				if frame := framer.Flush(); len(frame) > 0 {
+					onFrame(frame)
+				}
+				continue
+			}
+			if frame := framer.Flush(); len(frame) > 0 {
+				onFrame(frame)
+			}
+			if errors.Is(err, io.EOF) {
+				return io.EOF
+			}
+			return err
+		}
+	}
+}
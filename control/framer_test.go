@@ -0,0 +1,100 @@
+package control
+
+import (
+	"connectivity/types"
+	"net"
+	"testing"
+	"time"
+)
+
+func pushAll(t *testing.T, config types.FramerConfig, chunks ...string) []string {
+	t.Helper()
+	framer, err := NewFramer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var frames []string
+	for _, chunk := range chunks {
+		for _, frame := range framer.Push([]byte(chunk)) {
+			frames = append(frames, string(frame))
+		}
+	}
+	return frames
+}
+
+func assertFrames(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("frames = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("frames = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestFramerDelimiter(t *testing.T) {
+	config := types.FramerConfig{Mode: FrameDelimiter, Delimiter: `\r\n`, DelimiterInput: InputEscape}
+	assertFrames(t, pushAll(t, config, "ab", "c\r", "\nde\r\nf"), "abc", "de")
+
+	config = types.FramerConfig{Mode: FrameDelimiter, Delimiter: "7E", DelimiterInput: InputHex, KeepDelimiter: true}
+	assertFrames(t, pushAll(t, config, "\x01\x7e\x02", "\x7e"), "\x01\x7e", "\x02\x7e")
+}
+
+func TestFramerFixed(t *testing.T) {
+	config := types.FramerConfig{Mode: FrameFixed, FixedLength: 3}
+	assertFrames(t, pushAll(t, config, "abcd", "efgh"), "abc", "def")
+}
+
+func TestFramerLength(t *testing.T) {
+	// 2 字节魔数 + 2 字节大端长度 + 数据
+	config := types.FramerConfig{Mode: FrameLength, LengthSize: 2, LengthOffset: 2, Endian: "big"}
+	assertFrames(t, pushAll(t, config, "\xAA\x55\x00", "\x03abc\xAA\x55\x00\x01z"), "\xAA\x55\x00\x03abc", "\xAA\x55\x00\x01z")
+
+	// 小端长度包含头部自身，通过长度修正扣除
+	config = types.FramerConfig{Mode: FrameLength, LengthSize: 4, Endian: "little", LengthAdjust: -4}
+	assertFrames(t, pushAll(t, config, "\x06\x00\x00\x00hi"), "\x06\x00\x00\x00hi")
+}
+
+func TestFramerLengthOversized(t *testing.T) {
+	// 声明长度 10 超过最大帧长度 4，截断输出后丢弃剩余帧体，下一帧仍能正确解析
+	config := types.FramerConfig{Mode: FrameLength, LengthSize: 1, MaxFrameSize: 4}
+	assertFrames(t, pushAll(t, config, "\x0Aabcdef", "ghij\x02x", "y"), "\x0Aabc", "\x02xy")
+	assertFrames(t, pushAll(t, config, "\x0Aabcdefghij\x02xy\x01z"), "\x0Aabc", "\x02xy", "\x01z")
+}
+
+func TestFramerInvalidConfig(t *testing.T) {
+	for _, config := range []types.FramerConfig{
+		{Mode: "unknown"},
+		{Mode: FrameFixed},
+		{Mode: FrameLength, LengthSize: 3},
+		{Mode: FrameDelimiter},
+	} {
+		if _, err := NewFramer(config); err == nil {
+			t.Fatalf("配置 %+v 应返回错误", config)
+		}
+	}
+}
+
+func TestReadFramesIdleTimeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	frames := make(chan string, 4)
+	go readFrames(c1, types.FramerConfig{Mode: FrameIdle, IdleTimeoutMs: 100}, func(data []byte) {
+		frames <- string(data)
+	})
+
+	c2.Write([]byte("ab"))
+	c2.Write([]byte("cd"))
+	select {
+	case frame := <-frames:
+		if frame != "abcd" {
+			t.Fatalf("frame = %q", frame)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("空闲超时后应输出缓冲数据")
+	}
+	c1.Close()
+}
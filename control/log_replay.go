@@ -0,0 +1,182 @@
+package control
+
+import (
+	"connectivity/models"
+	"connectivity/types"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 消息记录回放节奏
+const (
+	TimingOriginal = "original" // 按记录的原始间隔
+	TimingInterval = "interval" // 固定间隔
+	TimingFast     = "fast"     // 尽快发送
+)
+
+const (
+	defaultReplyTimeout = 5 * time.Second
+	replyPollInterval   = 20 * time.Millisecond
+)
+
+// StartLogReplay 将客户端或服务端连接消息记录中的发出消息重新发送到回放目标，返回回放标识，进度通过 replay_event 事件推送
+func (r *FuncReplay) StartLogReplay(req types.LogReplay) types.ConnectResult {
+	if err := validateReplayTarget(req.Target, ""); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+	speed, err := logReplaySpeed(req)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+
+	packets, err := r.loadLogPackets(req)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("读取消息记录失败: %v", err),
+		}
+	}
+	if len(packets) == 0 {
+		return types.ConnectResult{
+			Success: false,
+			Message: "所选范围内没有发出的消息",
+		}
+	}
+	if req.Timing == TimingInterval {
+		for i := range packets {
+			packets[i].offset = time.Duration(i*req.IntervalMs) * time.Millisecond
+		}
+	}
+
+	var afterSend func(stop <-chan struct{}) error
+	if req.WaitReply {
+		timeout := defaultReplyTimeout
+		if req.ReplyTimeoutMs > 0 {
+			timeout = time.Duration(req.ReplyTimeoutMs) * time.Millisecond
+		}
+		afterSend = r.replyWaiter(req.Target, timeout)
+	}
+	return r.startReplay(packets, speed, req.Target, afterSend)
+}
+
+// logReplaySpeed 校验发送节奏，返回 runReplay 使用的速度倍数
+func logReplaySpeed(req types.LogReplay) (float64, error) {
+	if req.Timing == TimingInterval {
+		if req.IntervalMs <= 0 {
+			return 0, errors.New("发送间隔必须大于 0 毫秒")
+		}
+		return 1, nil
+	}
+	return replaySpeed(req.Timing, req.Speed)
+}
+
+// replaySpeed 校验 original 与 fast 节奏，返回 runReplay 使用的速度倍数，original 节奏下速度为 0 时按 1 倍处理
+func replaySpeed(timing string, speed float64) (float64, error) {
+	switch timing {
+	case "", TimingOriginal:
+		if speed < 0 {
+			return 0, errors.New("回放速度不能为负数")
+		}
+		if speed == 0 {
+			return 1, nil
+		}
+		return speed, nil
+	case TimingFast:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("不支持的发送节奏: %s", timing)
+}
+
+// loadLogPackets 读取来源记录中的发出消息，offset 为相对首条消息的记录时间
+func (r *FuncReplay) loadLogPackets(req types.LogReplay) ([]replayPacket, error) {
+	query := types.MessageQuery{
+		ClientID:  req.ClientID,
+		ServerID:  req.ServerID,
+		ConnID:    req.ConnID,
+		Direction: "outgoing",
+		Since:     req.Since,
+		Until:     req.Until,
+		Limit:     maxMessagePageSize,
+	}
+	filter, err := buildMessageFilter(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var packets []replayPacket
+	var start time.Time
+	for {
+		messages, more, err := models.QueryMessages(r.Db, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, message := range messages {
+			ts := messageTime(message.Timestamp)
+			if packets == nil {
+				start = ts
+			}
+			offset := ts.Sub(start)
+			if offset < 0 {
+				offset = 0
+			}
+			packets = append(packets, replayPacket{offset: offset, payload: message.Payload})
+		}
+		if !more {
+			return packets, nil
+		}
+		filter.AfterID = messages[len(messages)-1].ID
+	}
+}
+
+// replyWaiter 返回等待回放目标收到新消息的函数。发送前记录最新的消息 id，发送后轮询该 id 之后的接收记录
+func (r *FuncReplay) replyWaiter(target types.ReplayTarget, timeout time.Duration) func(stop <-chan struct{}) error {
+	filter := models.MessageFilter{Direction: "incoming", Limit: 1}
+	if strings.HasSuffix(target.Type, "-client") {
+		filter.ClientID = target.ID
+	} else {
+		filter.ServerID, filter.ConnID = target.ID, target.ConnID
+	}
+
+	// 首次发送前的基准在回放开始时取得，之后每次等待到回复后以该回复为新基准
+	filter.AfterID = r.latestMessageID()
+	return func(stop <-chan struct{}) error {
+		deadline := time.NewTimer(timeout)
+		defer deadline.Stop()
+		ticker := time.NewTicker(replyPollInterval)
+		defer ticker.Stop()
+		for {
+			messages, _, err := models.QueryMessages(r.Db, filter)
+			if err != nil {
+				return err
+			}
+			if len(messages) > 0 {
+				filter.AfterID = r.latestMessageID()
+				return nil
+			}
+			select {
+			case <-stop:
+				return errReplayStopped
+			case <-deadline.C:
+				return fmt.Errorf("等待回复超时 (%v)", timeout)
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// latestMessageID 返回当前最大的消息 id
+func (r *FuncReplay) latestMessageID() int {
+	messages, _, err := models.QueryMessages(r.Db, models.MessageFilter{Desc: true, Limit: 1})
+	if err != nil || len(messages) == 0 {
+		return 0
+	}
+	return messages[0].ID
+}
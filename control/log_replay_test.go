@@ -0,0 +1,89 @@
+package control
+
+import (
+	"connectivity/models"
+	"connectivity/types"
+	"testing"
+	"time"
+)
+
+func TestLoadLogPackets(t *testing.T) {
+	r := &FuncReplay{Db: openMessageDB(t)}
+	insert := func(connID int, direction string, payload string, ts string) {
+		if _, err := r.Db.Exec(`INSERT INTO message (server_id, conn_id, payload, payload_len, input_method, display_method, encoding, direction, timestamp) VALUES (1, ?, ?, ?, 'text', 'text', 'utf-8', ?, ?)`, connID, []byte(payload), len(payload), direction, ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert(5, "outgoing", "a", "2024-05-01 08:00:00.000")
+	insert(5, "incoming", "x", "2024-05-01 08:00:00.100")
+	insert(5, "outgoing", "b", "2024-05-01 08:00:00.300")
+	insert(6, "outgoing", "other", "2024-05-01 08:00:00.400")
+	insert(5, "outgoing", "c", "2024-05-01 08:00:01")
+
+	packets, err := r.loadLogPackets(types.LogReplay{ServerID: 1, ConnID: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 3 || string(packets[1].payload) != "b" || packets[1].offset != 300*time.Millisecond || packets[2].offset != time.Second {
+		t.Fatalf("packets = %+v", packets)
+	}
+
+	packets, err = r.loadLogPackets(types.LogReplay{ServerID: 1, ConnID: 5, Since: "2024-05-01 08:00:00.200", Until: "2024-05-01 08:00:01"})
+	if err != nil || len(packets) != 1 || string(packets[0].payload) != "b" || packets[0].offset != 0 {
+		t.Fatalf("range packets = %+v, %v", packets, err)
+	}
+}
+
+func TestLogReplaySpeed(t *testing.T) {
+	cases := []struct {
+		req  types.LogReplay
+		want float64
+	}{
+		{types.LogReplay{}, 1},
+		{types.LogReplay{Timing: TimingOriginal, Speed: 4}, 4},
+		{types.LogReplay{Timing: TimingInterval, IntervalMs: 10}, 1},
+		{types.LogReplay{Timing: TimingFast}, 0},
+	}
+	for _, c := range cases {
+		if got, err := logReplaySpeed(c.req); err != nil || got != c.want {
+			t.Fatalf("%+v: %v, %v", c.req, got, err)
+		}
+	}
+	for _, req := range []types.LogReplay{{Speed: -1}, {Timing: TimingInterval}, {Timing: "slow"}} {
+		if _, err := logReplaySpeed(req); err == nil {
+			t.Fatalf("应校验失败: %+v", req)
+		}
+	}
+
+	// 抓包回放没有 interval 节奏
+	if _, err := replaySpeed(TimingInterval, 1); err == nil {
+		t.Fatal("抓包回放不支持 interval 节奏")
+	}
+}
+
+func TestReplyWaiter(t *testing.T) {
+	r := &FuncReplay{Db: openMessageDB(t)}
+	models.AddMessage(r.Db, 2, []byte("old"), "tcp", "text", "utf-8", "incoming")
+	wait := r.replyWaiter(types.ReplayTarget{Type: ReplayTCPClient, ID: 2}, 500*time.Millisecond)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		models.AddMessage(r.Db, 3, []byte("other client"), "tcp", "text", "utf-8", "incoming")
+		models.AddMessage(r.Db, 2, []byte("reply"), "tcp", "text", "utf-8", "incoming")
+	}()
+	if err := wait(make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+
+	// 已消费的回复不会被再次计入
+	start := time.Now()
+	if err := wait(make(chan struct{})); err == nil || time.Since(start) < 400*time.Millisecond {
+		t.Fatalf("应等待超时: %v", err)
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	if err := wait(stop); err != errReplayStopped {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -5,14 +5,19 @@ import (
 	"connectivity/types"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Message struct {
-	Db  *sql.DB
-	mu  sync.Mutex
-	Ctx context.Context
+	Db     *sql.DB
+	mu     sync.Mutex
+	Ctx    context.Context
+	Events EventSink
 }
 
 func (m *Message) AddMessage(clientId int, content string, inputMethod string, displayMethod string, encoding string, direction string) types.ConnectResult {
@@ -23,14 +28,29 @@ func (m *Message) AddMessage(clientId int, content string, inputMethod string, d
 	resp.Success = true
 	resp.Message = "消息添加成功"
 
-	if err := models.AddMessage(m.Db, clientId, content, inputMethod, displayMethod, encoding, direction); err != nil {
+	if err := models.AddMessage(m.Db, clientId, []byte(content), inputMethod, displayMethod, encoding, direction); err != nil {
 		resp.Success = false
 		resp.Message = fmt.Sprintf("消息添加失败: %v", err)
 	}
 
 	return resp
 }
+
+// renderMessage 按显示方式和消息记录的字符编码渲染原始字节，displayMethod 为空时使用消息记录的显示方式
+func renderMessage(message *types.Message, displayMethod string) {
+	if displayMethod != "" {
+		message.DisplayMethod = displayMethod
+	}
+	message.Length = len(message.Payload)
+	message.Content = renderPayloadCharset(message.Payload, message.DisplayMethod, message.Encoding)
+}
+
 func (m *Message) GetServerAllMessages(serverID int64, connID int64) types.ConnectResult {
+	return m.GetServerAllMessagesAs(serverID, connID, "")
+}
+
+// GetServerAllMessagesAs 获取服务端连接消息，connID 为 server_conn.conn_id，并按指定显示方式 (text/hex/hexdump/escape) 渲染
+func (m *Message) GetServerAllMessagesAs(serverID int64, connID int64, displayMethod string) types.ConnectResult {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	messages, err := models.GetServerAllMessages(m.Db, int(serverID), int(connID))
@@ -40,6 +60,9 @@ func (m *Message) GetServerAllMessages(serverID int64, connID int64) types.Conne
 			Message: fmt.Sprintf("获取消息失败: %v", err),
 		}
 	}
+	for _, message := range messages {
+		renderMessage(message, displayMethod)
+	}
 	return types.ConnectResult{
 		Success: true,
 		Message: "获取消息成功",
@@ -48,6 +71,11 @@ func (m *Message) GetServerAllMessages(serverID int64, connID int64) types.Conne
 }
 
 func (m *Message) GetAllMessages(clientID int) types.ConnectResult {
+	return m.GetAllMessagesAs(clientID, "")
+}
+
+// GetAllMessagesAs 获取客户端消息，并按指定显示方式 (text/hex/hexdump/escape) 渲染
+func (m *Message) GetAllMessagesAs(clientID int, displayMethod string) types.ConnectResult {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -58,6 +86,9 @@ func (m *Message) GetAllMessages(clientID int) types.ConnectResult {
 			Message: fmt.Sprintf("获取消息失败: %v", err),
 		}
 	}
+	for i := range messages {
+		renderMessage(&messages[i], displayMethod)
+	}
 
 	return types.ConnectResult{
 		Success: true,
@@ -97,3 +128,170 @@ func (m *Message) DeleteMessageByServerID(serverID int, connID int) types.Connec
 		Message: "删除消息成功",
 	}
 }
+
+// RenderPayload 按显示方式重新渲染原始字节
+func (m *Message) RenderPayload(payload []byte, displayMethod string) string {
+	return RenderPayload(payload, displayMethod)
+}
+
+// EncodePayload 按输入方式解析输入，返回原始字节，用于发送前预览
+func (m *Message) EncodePayload(input string, inputMethod string) types.ConnectResult {
+	payload, err := EncodePayload(input, inputMethod)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("数据格式错误: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "解析成功",
+		Data:    payload,
+	}
+}
+
+// 消息搜索方式
+const (
+	SearchText  = "text"  // 按字符编码解码后查找子串
+	SearchHex   = "hex"   // 在原始字节中查找十六进制表示的字节序列
+	SearchRegex = "regex" // 按字符编码解码后进行正则匹配
+)
+
+const (
+	defaultMessagePageSize = 100
+	maxMessagePageSize     = 1000
+)
+
+// messageTimeLayouts 查询时间支持的格式，依次尝试
+var messageTimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// parseMessageTime 将查询时间转换为消息记录的时间格式，支持毫秒，空值原样返回
+func parseMessageTime(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	for _, layout := range messageTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			// 整秒时使用秒级格式，使边界同时适用于只精确到秒的旧记录
+			if t.Nanosecond() == 0 {
+				return t.Format("2006-01-02 15:04:05"), nil
+			}
+			return t.Format(models.TimestampLayout), nil
+		}
+	}
+	return "", fmt.Errorf("时间格式无效: %s", value)
+}
+
+// buildMessageFilter 将前端查询条件转换为数据库过滤条件
+func buildMessageFilter(query types.MessageQuery) (models.MessageFilter, error) {
+	filter := models.MessageFilter{
+		ClientID: query.ClientID,
+		ServerID: query.ServerID,
+		ConnID:   query.ConnID,
+		Limit:    query.Limit,
+	}
+	if (query.ClientID == 0) == (query.ServerID == 0) {
+		return filter, errors.New("需要指定客户端或服务端")
+	}
+	if query.ClientID != 0 && query.ConnID != 0 {
+		return filter, errors.New("连接筛选仅适用于服务端")
+	}
+
+	switch query.Direction {
+	case "", "incoming", "outgoing":
+		filter.Direction = query.Direction
+	default:
+		return filter, fmt.Errorf("不支持的消息方向: %s", query.Direction)
+	}
+
+	var err error
+	if filter.Since, err = parseMessageTime(query.Since); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = parseMessageTime(query.Until); err != nil {
+		return filter, err
+	}
+
+	switch strings.ToLower(query.Order) {
+	case "", "asc":
+		filter.AfterID = query.Cursor
+	case "desc":
+		filter.Desc = true
+		filter.BeforeID = query.Cursor
+	default:
+		return filter, fmt.Errorf("不支持的排序方式: %s", query.Order)
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultMessagePageSize
+	}
+	if filter.Limit > maxMessagePageSize {
+		filter.Limit = maxMessagePageSize
+	}
+
+	if query.Search == "" {
+		return filter, nil
+	}
+	switch strings.ToLower(query.SearchMode) {
+	case "", SearchText:
+		search := query.Search
+		filter.Match = func(message *types.Message) bool {
+			return strings.Contains(decodeText(message.Payload, message.Encoding), search)
+		}
+	case SearchHex:
+		needle, err := EncodePayload(query.Search, InputHex)
+		if err != nil {
+			return filter, fmt.Errorf("十六进制搜索内容无效: %v", err)
+		}
+		filter.Contains = needle
+	case SearchRegex:
+		re, err := regexp.Compile(query.Search)
+		if err != nil {
+			return filter, fmt.Errorf("正则表达式无效: %v", err)
+		}
+		filter.Match = func(message *types.Message) bool {
+			return re.MatchString(decodeText(message.Payload, message.Encoding))
+		}
+	default:
+		return filter, fmt.Errorf("不支持的搜索方式: %s", query.SearchMode)
+	}
+	return filter, nil
+}
+
+// QueryMessages 分页查询客户端或服务端消息，支持时间范围、方向、连接筛选和文本/十六进制/正则搜索。
+// 使用返回的 next_cursor 作为下一次查询的 cursor 获取下一页
+func (m *Message) QueryMessages(query types.MessageQuery) types.ConnectResult {
+	filter, err := buildMessageFilter(query)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("查询条件错误: %v", err),
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	messages, more, err := models.QueryMessages(m.Db, filter)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取消息失败: %v", err),
+		}
+	}
+	page := types.MessagePage{Messages: messages, HasMore: more}
+	if page.Messages == nil {
+		page.Messages = []*types.Message{}
+	}
+	for _, message := range messages {
+		renderMessage(message, query.Display)
+	}
+	if more {
+		page.NextCursor = messages[len(messages)-1].ID
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "获取消息成功",
+		Data:    page,
+	}
+}
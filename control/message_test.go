@@ -1,7 +1,11 @@
 package control
 
 import (
+	"connectivity/models"
+	"connectivity/types"
+	"database/sql"
 	"fmt"
+	"path/filepath"
 	"testing"
 )
 
@@ -13,3 +17,106 @@ func TestGetServerAllMessages(t *testing.T) {
 
 	fmt.Println(serverStr.GetServerAllMessages(3, 63539))
 }
+
+func openMessageDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := models.InitDB(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func queryPage(t *testing.T, m *Message, query types.MessageQuery) types.MessagePage {
+	t.Helper()
+	resp := m.QueryMessages(query)
+	if !resp.Success {
+		t.Fatal(resp.Message)
+	}
+	return resp.Data.(types.MessagePage)
+}
+
+func TestQueryMessages(t *testing.T) {
+	m := &Message{Db: openMessageDB(t)}
+	for i := 1; i <= 5; i++ {
+		direction := "incoming"
+		if i%2 == 0 {
+			direction = "outgoing"
+		}
+		models.AddMessageServer(m.Db, 1, 7, []byte(fmt.Sprintf("msg-%d", i)), "tcp", "text", "utf-8", direction)
+	}
+	models.AddMessageServer(m.Db, 1, 8, []byte("other"), "tcp", "text", "utf-8", "incoming")
+	models.AddMessageServer(m.Db, 1, 7, []byte{0xC4, 0xE3, 0x01, 0x02}, "tcp", "hex", "gbk", "incoming")
+
+	// 游标分页
+	page := queryPage(t, m, types.MessageQuery{ServerID: 1, ConnID: 7, Limit: 2})
+	if len(page.Messages) != 2 || !page.HasMore || page.Messages[0].Content != "msg-1" {
+		t.Fatalf("page 1 = %+v", page)
+	}
+	var seen []string
+	for _, message := range page.Messages {
+		seen = append(seen, string(message.Payload))
+	}
+	for page.HasMore {
+		page = queryPage(t, m, types.MessageQuery{ServerID: 1, ConnID: 7, Limit: 2, Cursor: page.NextCursor})
+		for _, message := range page.Messages {
+			seen = append(seen, string(message.Payload))
+		}
+	}
+	if len(seen) != 6 || page.NextCursor != 0 {
+		t.Fatalf("seen = %q", seen)
+	}
+
+	// 倒序
+	page = queryPage(t, m, types.MessageQuery{ServerID: 1, Order: "desc", Limit: 1})
+	if string(page.Messages[0].Payload) != "\xC4\xE3\x01\x02" || !page.HasMore {
+		t.Fatalf("desc = %+v", page.Messages[0])
+	}
+
+	cases := []struct {
+		query types.MessageQuery
+		want  int
+	}{
+		{types.MessageQuery{ServerID: 1}, 7},
+		{types.MessageQuery{ServerID: 1, Direction: "outgoing"}, 2},
+		{types.MessageQuery{ServerID: 1, Search: "msg-"}, 5},
+		{types.MessageQuery{ServerID: 1, Search: "你"}, 1},
+		{types.MessageQuery{ServerID: 1, Search: "01 02", SearchMode: SearchHex}, 1},
+		{types.MessageQuery{ServerID: 1, Search: `^msg-[35]$`, SearchMode: SearchRegex}, 2},
+		{types.MessageQuery{ServerID: 1, Search: `-[0-9]`, SearchMode: SearchRegex, Limit: 2}, 2},
+		{types.MessageQuery{ServerID: 1, Since: "2000-01-01", Until: "2000-01-02"}, 0},
+		{types.MessageQuery{ServerID: 2}, 0},
+	}
+	for i, c := range cases {
+		if page := queryPage(t, m, c.query); len(page.Messages) != c.want {
+			t.Fatalf("case %d: %d messages", i, len(page.Messages))
+		}
+	}
+}
+
+func TestBuildMessageFilterErrors(t *testing.T) {
+	bad := []types.MessageQuery{
+		{},
+		{ClientID: 1, ServerID: 1},
+		{ClientID: 1, ConnID: 2},
+		{ClientID: 1, Direction: "both"},
+		{ClientID: 1, Since: "yesterday"},
+		{ClientID: 1, Order: "random"},
+		{ClientID: 1, Search: "zz", SearchMode: SearchHex},
+		{ClientID: 1, Search: "(", SearchMode: SearchRegex},
+		{ClientID: 1, Search: "a", SearchMode: "glob"},
+	}
+	for _, query := range bad {
+		if _, err := buildMessageFilter(query); err == nil {
+			t.Fatalf("应校验失败: %+v", query)
+		}
+	}
+
+	filter, err := buildMessageFilter(types.MessageQuery{ClientID: 1, Since: "2024-05-01T08:30", Limit: 5000})
+	if err != nil || filter.Since != "2024-05-01 08:30:00" || filter.Limit != maxMessagePageSize {
+		t.Fatalf("filter = %+v, %v", filter, err)
+	}
+}
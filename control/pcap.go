@@ -0,0 +1,402 @@
+package control
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"time"
+)
+
+// 支持的链路类型
+const (
+	linkTypeNull     = 0   // BSD 环回
+	linkTypeEthernet = 1   // 以太网
+	linkTypeRaw      = 101 // 原始 IP
+	linkTypeLinuxSLL = 113 // Linux cooked capture
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+	linkTypeSLL2     = 276 // Linux cooked capture v2
+)
+
+// pcapPacket 解析出的一个网络层报文
+type pcapPacket struct {
+	time     time.Time
+	linkType int
+	data     []byte
+}
+
+// capturedSegment 会话中一个携带载荷的报文，fromA 表示由 A 端发出
+type capturedSegment struct {
+	time    time.Time
+	fromA   bool
+	payload []byte
+}
+
+// capturedFlow 抓包中的一条 TCP 或 UDP 会话，A 端为首个报文的发送方（TCP 为发起连接的一方）
+type capturedFlow struct {
+	id       int
+	protocol string
+	addrA    string
+	addrB    string
+	segments []capturedSegment
+
+	nextSeq [2]uint32 // 按方向记录期望的下一个 TCP 序号，用于去除重传
+	seqInit [2]bool
+}
+
+// flowKey 会话五元组，端点按字符串排序后作为键，两个方向归入同一会话
+type flowKey struct {
+	protocol string
+	low      string
+	high     string
+}
+
+// parseCapture 解析 pcap 或 pcapng 文件，返回按首次出现顺序排列的 TCP/UDP 会话
+func parseCapture(data []byte) ([]*capturedFlow, error) {
+	packets, err := readCapturePackets(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var flows []*capturedFlow
+	index := make(map[flowKey]*capturedFlow)
+	for _, packet := range packets {
+		protocol, src, dst, seq, flags, payload, ok := decodePacket(packet.linkType, packet.data)
+		if !ok {
+			continue
+		}
+		key := flowKey{protocol: protocol, low: src, high: dst}
+		if key.low > key.high {
+			key.low, key.high = key.high, key.low
+		}
+		flow, exists := index[key]
+		if !exists {
+			flow = &capturedFlow{id: len(flows) + 1, protocol: protocol, addrA: src, addrB: dst}
+			// 抓到 SYN+ACK 时说明发送方为服务端，将发起方作为 A 端
+			if protocol == "tcp" && flags&(tcpSYN|tcpACK) == tcpSYN|tcpACK {
+				flow.addrA, flow.addrB = dst, src
+			}
+			index[key] = flow
+			flows = append(flows, flow)
+		}
+		flow.add(packet.time, src == flow.addrA, seq, flags, payload)
+	}
+	return flows, nil
+}
+
+// add 加入一个报文，TCP 报文按序号去除重传和重叠部分
+func (f *capturedFlow) add(ts time.Time, fromA bool, seq uint32, flags byte, payload []byte) {
+	if f.protocol == "tcp" {
+		dir := 1
+		if fromA {
+			dir = 0
+		}
+		if flags&tcpSYN != 0 {
+			f.nextSeq[dir], f.seqInit[dir] = seq+1, true
+			seq++
+		}
+		if len(payload) == 0 {
+			return
+		}
+		if f.seqInit[dir] {
+			if int32(seq+uint32(len(payload))-f.nextSeq[dir]) <= 0 {
+				return
+			}
+			if overlap := int32(f.nextSeq[dir] - seq); overlap > 0 {
+				payload = payload[overlap:]
+				seq = f.nextSeq[dir]
+			}
+		}
+		f.nextSeq[dir], f.seqInit[dir] = seq+uint32(len(payload)), true
+	}
+	if len(payload) == 0 {
+		return
+	}
+	f.segments = append(f.segments, capturedSegment{time: ts, fromA: fromA, payload: append([]byte(nil), payload...)})
+}
+
+// readCapturePackets 按文件头区分 pcap 与 pcapng
+func readCapturePackets(data []byte) ([]pcapPacket, error) {
+	if len(data) < 4 {
+		return nil, errors.New("文件过短，不是有效的抓包文件")
+	}
+	if binary.LittleEndian.Uint32(data) == pcapngSectionHeader {
+		return readPcapng(data)
+	}
+	return readPcap(data)
+}
+
+func readPcap(data []byte) ([]pcapPacket, error) {
+	if len(data) < 24 {
+		return nil, errors.New("pcap 文件头不完整")
+	}
+	var order binary.ByteOrder
+	var nano bool
+	switch magic := binary.LittleEndian.Uint32(data); magic {
+	case 0xA1B2C3D4:
+		order = binary.LittleEndian
+	case 0xA1B23C4D:
+		order, nano = binary.LittleEndian, true
+	case 0xD4C3B2A1:
+		order = binary.BigEndian
+	case 0x4D3CB2A1:
+		order, nano = binary.BigEndian, true
+	default:
+		return nil, fmt.Errorf("无法识别的抓包文件格式: %08X", magic)
+	}
+	linkType := int(order.Uint32(data[20:]) & 0xFFFF)
+
+	var packets []pcapPacket
+	for offset := 24; offset+16 <= len(data); {
+		sec := int64(order.Uint32(data[offset:]))
+		frac := int64(order.Uint32(data[offset+4:]))
+		capLen := int(order.Uint32(data[offset+8:]))
+		offset += 16
+		if capLen > len(data)-offset {
+			// 文件截断时保留已读取的报文
+			break
+		}
+		if !nano {
+			frac *= 1000
+		}
+		packets = append(packets, pcapPacket{time: time.Unix(sec, frac), linkType: linkType, data: data[offset : offset+capLen]})
+		offset += capLen
+	}
+	return packets, nil
+}
+
+// pcapngInterface 接口描述块中回放需要的信息
+type pcapngInterface struct {
+	linkType int
+	unitsPS  float64 // 每秒的时间戳单位数
+}
+
+func readPcapng(data []byte) ([]pcapPacket, error) {
+	var order binary.ByteOrder = binary.LittleEndian
+	var interfaces []pcapngInterface
+	var packets []pcapPacket
+	for offset := 0; offset+12 <= len(data); {
+		blockType := order.Uint32(data[offset:])
+		if blockType == pcapngSectionHeader {
+			// 每个节头块重新确定字节序，接口编号从 0 开始
+			switch binary.LittleEndian.Uint32(data[offset+8:]) {
+			case pcapngByteOrderMagic:
+				order = binary.LittleEndian
+			case 0x4D3C2B1A:
+				order = binary.BigEndian
+			default:
+				return nil, errors.New("pcapng 字节序标识无效")
+			}
+			interfaces = nil
+		}
+		total := int(order.Uint32(data[offset+4:]))
+		if total < 12 || total%4 != 0 || total > len(data)-offset {
+			if len(packets) > 0 {
+				break
+			}
+			return nil, fmt.Errorf("pcapng 块长度无效: %d", total)
+		}
+		body := data[offset+8 : offset+total-4]
+		offset += total
+
+		switch blockType {
+		case pcapngInterfaceDesc:
+			if len(body) < 8 {
+				return nil, errors.New("pcapng 接口描述块不完整")
+			}
+			iface := pcapngInterface{linkType: int(order.Uint16(body)), unitsPS: 1e6}
+			forEachPcapngOption(order, body[8:], func(code uint16, value []byte) {
+				if code == 9 && len(value) >= 1 {
+					// if_tsresol，最高位为 0 时为 10 的负幂，为 1 时为 2 的负幂
+					if value[0]&0x80 == 0 {
+						iface.unitsPS = math.Pow10(int(value[0]))
+					} else {
+						iface.unitsPS = math.Pow(2, float64(value[0]&0x7F))
+					}
+				}
+			})
+			interfaces = append(interfaces, iface)
+		case pcapngEnhancedPacket:
+			if len(body) < 20 {
+				continue
+			}
+			ifaceID := int(order.Uint32(body))
+			capLen := int(order.Uint32(body[12:]))
+			if ifaceID >= len(interfaces) || capLen > len(body)-20 {
+				continue
+			}
+			iface := interfaces[ifaceID]
+			units := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+			sec := units / uint64(iface.unitsPS)
+			frac := float64(units%uint64(iface.unitsPS)) / iface.unitsPS
+			ts := time.Unix(int64(sec), int64(frac*1e9))
+			packets = append(packets, pcapPacket{time: ts, linkType: iface.linkType, data: body[20 : 20+capLen]})
+		}
+	}
+	return packets, nil
+}
+
+func forEachPcapngOption(order binary.ByteOrder, options []byte, fn func(code uint16, value []byte)) {
+	for len(options) >= 4 {
+		code := order.Uint16(options)
+		length := int(order.Uint16(options[2:]))
+		if code == 0 || 4+length > len(options) {
+			return
+		}
+		fn(code, options[4:4+length])
+		options = options[4+(length+3)&^3:]
+	}
+}
+
+// decodePacket 解析链路层、IP 层与传输层首部，返回 "ip:port" 形式的源和目的地址。分片报文与非 TCP/UDP 报文被忽略
+func decodePacket(linkType int, data []byte) (protocol string, src string, dst string, seq uint32, flags byte, payload []byte, ok bool) {
+	ip, linkOK := linkPayload(linkType, data)
+	if !linkOK || len(ip) < 1 {
+		return "", "", "", 0, 0, nil, false
+	}
+
+	var srcIP, dstIP net.IP
+	var proto byte
+	var transport []byte
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 {
+			return "", "", "", 0, 0, nil, false
+		}
+		ihl := int(ip[0]&0x0F) * 4
+		total := int(binary.BigEndian.Uint16(ip[2:]))
+		if ihl < 20 || total < ihl || total > len(ip) {
+			return "", "", "", 0, 0, nil, false
+		}
+		if binary.BigEndian.Uint16(ip[6:])&0x3FFF != 0 {
+			return "", "", "", 0, 0, nil, false
+		}
+		proto = ip[9]
+		srcIP, dstIP = net.IP(ip[12:16]), net.IP(ip[16:20])
+		transport = ip[ihl:total]
+	case 6:
+		if len(ip) < 40 {
+			return "", "", "", 0, 0, nil, false
+		}
+		end := 40 + int(binary.BigEndian.Uint16(ip[4:]))
+		if end > len(ip) {
+			end = len(ip)
+		}
+		proto = ip[6]
+		srcIP, dstIP = net.IP(ip[8:24]), net.IP(ip[24:40])
+		transport = ip[40:end]
+		// 跳过逐跳、路由和目的选项扩展首部，分片首部不支持
+		for proto == 0 || proto == 43 || proto == 60 {
+			if len(transport) < 8 {
+				return "", "", "", 0, 0, nil, false
+			}
+			n := (int(transport[1]) + 1) * 8
+			if n > len(transport) {
+				return "", "", "", 0, 0, nil, false
+			}
+			proto, transport = transport[0], transport[n:]
+		}
+	default:
+		return "", "", "", 0, 0, nil, false
+	}
+
+	switch proto {
+	case 6:
+		if len(transport) < 20 {
+			return "", "", "", 0, 0, nil, false
+		}
+		offset := int(transport[12]>>4) * 4
+		if offset < 20 || offset > len(transport) {
+			return "", "", "", 0, 0, nil, false
+		}
+		protocol = "tcp"
+		seq = binary.BigEndian.Uint32(transport[4:])
+		flags = transport[13]
+		payload = transport[offset:]
+	case 17:
+		if len(transport) < 8 {
+			return "", "", "", 0, 0, nil, false
+		}
+		end := int(binary.BigEndian.Uint16(transport[4:]))
+		if end < 8 || end > len(transport) {
+			end = len(transport)
+		}
+		protocol = "udp"
+		payload = transport[8:end]
+	default:
+		return "", "", "", 0, 0, nil, false
+	}
+	srcPort := int(binary.BigEndian.Uint16(transport[0:]))
+	dstPort := int(binary.BigEndian.Uint16(transport[2:]))
+	src = net.JoinHostPort(srcIP.String(), fmt.Sprint(srcPort))
+	dst = net.JoinHostPort(dstIP.String(), fmt.Sprint(dstPort))
+	return protocol, src, dst, seq, flags, payload, true
+}
+
+// linkPayload 去除链路层首部，返回 IP 报文
+func linkPayload(linkType int, data []byte) ([]byte, bool) {
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return nil, false
+		}
+		etherType := binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+		// 跳过 802.1Q/802.1ad VLAN 标签
+		for etherType == 0x8100 || etherType == 0x88A8 {
+			if len(data) < 4 {
+				return nil, false
+			}
+			etherType = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+		return data, etherType == 0x0800 || etherType == 0x86DD
+	case linkTypeNull:
+		if len(data) < 4 {
+			return nil, false
+		}
+		return data[4:], true
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+		return data, true
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, false
+		}
+		proto := binary.BigEndian.Uint16(data[14:])
+		return data[16:], proto == 0x0800 || proto == 0x86DD
+	case linkTypeSLL2:
+		if len(data) < 20 {
+			return nil, false
+		}
+		proto := binary.BigEndian.Uint16(data[0:])
+		return data[20:], proto == 0x0800 || proto == 0x86DD
+	}
+	return nil, false
+}
+
+// replayPacket 回放的一个报文，offset 为相对首个报文的时间
+type replayPacket struct {
+	offset  time.Duration
+	payload []byte
+}
+
+// sidePackets 取出会话中一端发出的载荷，fromA 为 true 时取 A 端
+func (f *capturedFlow) sidePackets(fromA bool) []replayPacket {
+	var packets []replayPacket
+	var start time.Time
+	for _, segment := range f.segments {
+		if segment.fromA != fromA {
+			continue
+		}
+		if packets == nil {
+			start = segment.time
+		}
+		packets = append(packets, replayPacket{offset: segment.time.Sub(start), payload: segment.payload})
+	}
+	// 抓包时间偶有乱序，回放时按时间排列
+	sort.SliceStable(packets, func(i, j int) bool { return packets[i].offset < packets[j].offset })
+	return packets
+}
@@ -0,0 +1,166 @@
+package control
+
+import (
+	"bytes"
+	"connectivity/types"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// writeTestPcapng 使用导出的 pcapng 写入器生成抓包
+func writeTestPcapng(t *testing.T, protocol string, messages []*types.Message) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	p, err := newPcapngMessageWriter(&buf, newPcapFlow(protocol, "10.1.1.1", 40000, "10.1.1.2", 502))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range messages {
+		if err := p.write(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseCapturePcapng(t *testing.T) {
+	data := writeTestPcapng(t, "tcp", []*types.Message{
+		{Direction: "outgoing", Payload: []byte("req1"), Timestamp: "2024-05-01 08:00:00.000"},
+		{Direction: "incoming", Payload: bytes.Repeat([]byte{'r'}, 3000), Timestamp: "2024-05-01 08:00:00.050"},
+		{Direction: "outgoing", Payload: []byte("req2"), Timestamp: "2024-05-01 08:00:00.250"},
+	})
+	flows, err := parseCapture(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 1 {
+		t.Fatalf("flows = %d", len(flows))
+	}
+	summary := flows[0].summary()
+	if summary.Protocol != "tcp" || summary.AddrA != "10.1.1.1:40000" || summary.AddrB != "10.1.1.2:502" {
+		t.Fatalf("summary = %+v", summary)
+	}
+	// 3000 字节的响应被分成 3 个分段
+	if summary.PacketsA != 2 || summary.PacketsB != 3 || summary.BytesB != 3000 || summary.DurationMs != 250 {
+		t.Fatalf("summary = %+v", summary)
+	}
+
+	packets := flows[0].sidePackets(true)
+	if len(packets) != 2 || string(packets[1].payload) != "req2" || packets[1].offset != 250*time.Millisecond {
+		t.Fatalf("packets = %+v", packets)
+	}
+}
+
+// pcapRecord 生成经典 pcap 记录，使用原始 IP 链路
+func pcapRecord(sec uint32, usec uint32, frame []byte) []byte {
+	rec := make([]byte, 16, 16+len(frame))
+	binary.LittleEndian.PutUint32(rec[0:], sec)
+	binary.LittleEndian.PutUint32(rec[4:], usec)
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(len(frame)))
+	return append(rec, frame...)
+}
+
+func TestParseCapturePcapRetransmit(t *testing.T) {
+	p := &pcapngMessageWriter{flow: newPcapFlow("tcp", "192.168.0.1", 1234, "192.168.0.2", 80)}
+	ipFrame := func(outgoing bool, seq uint32, flags byte, payload string) []byte {
+		return p.frame(outgoing, seq, 0, flags, []byte(payload))[14:]
+	}
+
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xA1B2C3D4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linkTypeRaw)
+
+	data := append([]byte(nil), header...)
+	// 先抓到服务端的 SYN+ACK，发起方仍应为 A 端
+	data = append(data, pcapRecord(1, 0, ipFrame(false, 99, tcpSYN|tcpACK, ""))...)
+	data = append(data, pcapRecord(1, 10, ipFrame(true, 100, tcpACK|tcpPSH, "hello"))...)
+	data = append(data, pcapRecord(1, 20, ipFrame(true, 100, tcpACK|tcpPSH, "hello"))...)    // 重传
+	data = append(data, pcapRecord(1, 30, ipFrame(true, 103, tcpACK|tcpPSH, "lo world"))...) // 部分重叠
+	data = append(data, pcapRecord(2, 0, ipFrame(false, 100, tcpACK|tcpPSH, "ok"))...)
+
+	flows, err := parseCapture(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 1 || flows[0].addrA != "192.168.0.1:1234" {
+		t.Fatalf("flows = %+v", flows)
+	}
+	var got []string
+	for _, packet := range flows[0].sidePackets(true) {
+		got = append(got, string(packet.payload))
+	}
+	if len(got) != 2 || got[0] != "hello" || got[1] != " world" {
+		t.Fatalf("got = %q", got)
+	}
+	if b := flows[0].sidePackets(false); len(b) != 1 || string(b[0].payload) != "ok" {
+		t.Fatalf("b = %+v", b)
+	}
+}
+
+func TestParseCaptureUDPAndInvalid(t *testing.T) {
+	data := writeTestPcapng(t, "udp", []*types.Message{
+		{Direction: "incoming", Payload: []byte("a"), Timestamp: "2024-05-01 08:00:00.000"},
+		{Direction: "outgoing", Payload: []byte("b"), Timestamp: "2024-05-01 08:00:01.000"},
+	})
+	flows, err := parseCapture(data)
+	if err != nil || len(flows) != 1 || flows[0].protocol != "udp" {
+		t.Fatalf("flows = %+v, %v", flows, err)
+	}
+	// UDP 会话以首个报文的发送方为 A 端
+	if flows[0].addrA != "10.1.1.2:502" {
+		t.Fatalf("addrA = %s", flows[0].addrA)
+	}
+
+	if _, err := parseCapture([]byte("not a capture file at all")); err == nil {
+		t.Fatal("应解析失败")
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	packets := []replayPacket{{0, []byte("a")}, {40 * time.Millisecond, []byte("b")}, {80 * time.Millisecond, []byte("c")}}
+	var sent []string
+	start := time.Now()
+	err := runReplay(packets, 2, make(chan struct{}), func(payload []byte) error {
+		sent = append(sent, string(payload))
+		return nil
+	}, nil, func(int) {})
+	if err != nil || len(sent) != 3 {
+		t.Fatalf("sent=%v err=%v", sent, err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("2 倍速应耗时约 40ms: %v", elapsed)
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	if err := runReplay(packets, 1, stop, func([]byte) error { return nil }, nil, func(int) {}); err != errReplayStopped {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestValidateReplayTarget(t *testing.T) {
+	if err := validateReplayTarget(types.ReplayTarget{Type: ReplayTCPClient, ID: 1}, "tcp"); err != nil {
+		t.Fatal(err)
+	}
+	bad := []struct {
+		target   types.ReplayTarget
+		protocol string
+	}{
+		{types.ReplayTarget{Type: "ws-client", ID: 1}, ""},
+		{types.ReplayTarget{Type: ReplayUDPClient, ID: 1}, "tcp"},
+		{types.ReplayTarget{Type: ReplayTCPServer, ID: 1}, "tcp"},
+	}
+	for _, c := range bad {
+		if err := validateReplayTarget(c.target, c.protocol); err == nil {
+			t.Fatalf("应校验失败: %+v", c.target)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package control
+
+import (
+	"connectivity/models"
+	"connectivity/types"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// pcapng 块类型
+const (
+	pcapngSectionHeader    = 0x0A0D0D0A
+	pcapngInterfaceDesc    = 0x00000001
+	pcapngEnhancedPacket   = 0x00000006
+	pcapngByteOrderMagic   = 0x1A2B3C4D
+	pcapngLinkTypeEthernet = 1
+)
+
+// tcpSegmentSize 合成 TCP 报文时每个分段的最大载荷
+const tcpSegmentSize = 1460
+
+// TCP 标志位
+const (
+	tcpFIN = 0x01
+	tcpSYN = 0x02
+	tcpPSH = 0x08
+	tcpACK = 0x10
+)
+
+var (
+	localMAC  = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	remoteMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+)
+
+// pcapFlow 一条会话的两端地址，local 为本应用一侧
+type pcapFlow struct {
+	protocol   string // tcp 或 udp
+	localIP    net.IP
+	localPort  int
+	remoteIP   net.IP
+	remotePort int
+	passive    bool // 本端为服务端，TCP 握手由对端发起
+}
+
+// newPcapFlow 由记录的地址生成会话端点，主机名或未指定地址使用占位地址，两端地址族不一致时统一为对端的地址族
+func newPcapFlow(protocol string, localHost string, localPort int, remoteHost string, remotePort int) pcapFlow {
+	remote := net.ParseIP(remoteHost)
+	if remote == nil || remote.IsUnspecified() {
+		remote = net.IPv4(10, 0, 0, 2)
+	}
+	local := net.ParseIP(localHost)
+	if local == nil || local.IsUnspecified() || (local.To4() == nil) != (remote.To4() == nil) {
+		if remote.To4() != nil {
+			local = net.IPv4(10, 0, 0, 1)
+		} else {
+			local = net.IPv6loopback
+		}
+	}
+	if local.Equal(remote) && localPort == remotePort {
+		localPort++
+	}
+	return pcapFlow{protocol: protocol, localIP: local, localPort: localPort, remoteIP: remote, remotePort: remotePort}
+}
+
+// resolvePcapFlow 根据导出对象查找会话两端地址。客户端未记录本地端口，使用由客户端 ID 生成的临时端口
+func (m *Message) resolvePcapFlow(export types.MessageExport) (pcapFlow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if export.ClientID != 0 {
+		client, err := models.FindServerClientOne(m.Db, export.ClientID)
+		if err != nil {
+			return pcapFlow{}, fmt.Errorf("查找客户端失败: %v", err)
+		}
+		if client.Type != "tcp" && client.Type != "udp" {
+			return pcapFlow{}, fmt.Errorf("%s 客户端不支持导出为 pcapng", client.Type)
+		}
+		return newPcapFlow(client.Type, "", 49152+export.ClientID%16384, client.Host, client.Port), nil
+	}
+
+	server, err := models.FindServerOne(m.Db, export.ServerID)
+	if err != nil {
+		return pcapFlow{}, fmt.Errorf("查找服务端失败: %v", err)
+	}
+	if server.Type != "tcp" && server.Type != "udp" {
+		return pcapFlow{}, fmt.Errorf("%s 服务端不支持导出为 pcapng", server.Type)
+	}
+	conn, err := models.FindServerConnOne(m.Db, export.ServerID, export.ConnID)
+	if err != nil {
+		return pcapFlow{}, fmt.Errorf("查找连接失败: %v", err)
+	}
+	flow := newPcapFlow(server.Type, server.Host, server.Port, conn.ConnHost, conn.ConnPort)
+	flow.passive = true
+	return flow, nil
+}
+
+// pcapngMessageWriter 将消息写为 pcapng，TCP 会话补全三次握手和结束时的 FIN，使 Wireshark 能够重组数据流
+type pcapngMessageWriter struct {
+	w         io.Writer
+	flow      pcapFlow
+	started   bool
+	localSeq  uint32 // 本端下一个发送序号
+	remoteSeq uint32 // 对端下一个发送序号
+	last      time.Time
+	ipID      uint16
+}
+
+func newPcapngMessageWriter(w io.Writer, flow pcapFlow) (*pcapngMessageWriter, error) {
+	p := &pcapngMessageWriter{w: w, flow: flow, localSeq: 1000, remoteSeq: 5000}
+	// 节头块，节长度未知时为 -1
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:], 1)
+	binary.LittleEndian.PutUint16(shb[6:], 0)
+	binary.LittleEndian.PutUint64(shb[8:], ^uint64(0))
+	if err := p.block(pcapngSectionHeader, shb); err != nil {
+		return nil, err
+	}
+	// 接口描述块，以太网链路，时间戳默认精度为微秒
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:], pcapngLinkTypeEthernet)
+	binary.LittleEndian.PutUint32(idb[4:], 0)
+	return p, p.block(pcapngInterfaceDesc, idb)
+}
+
+// block 写出一个 pcapng 块，主体按 4 字节对齐
+func (p *pcapngMessageWriter) block(blockType uint32, body []byte) error {
+	padded := (len(body) + 3) &^ 3
+	total := 12 + padded
+	buf := make([]byte, total)
+	binary.LittleEndian.PutUint32(buf[0:], blockType)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(total))
+	copy(buf[8:], body)
+	binary.LittleEndian.PutUint32(buf[total-4:], uint32(total))
+	_, err := p.w.Write(buf)
+	return err
+}
+
+func (p *pcapngMessageWriter) packet(ts time.Time, frame []byte) error {
+	body := make([]byte, 20+len(frame))
+	micros := uint64(ts.UnixMicro())
+	binary.LittleEndian.PutUint32(body[0:], 0)
+	binary.LittleEndian.PutUint32(body[4:], uint32(micros>>32))
+	binary.LittleEndian.PutUint32(body[8:], uint32(micros))
+	binary.LittleEndian.PutUint32(body[12:], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(body[16:], uint32(len(frame)))
+	copy(body[20:], frame)
+	p.last = ts
+	return p.block(pcapngEnhancedPacket, body)
+}
+
+func (p *pcapngMessageWriter) write(message *types.Message) error {
+	// 系统消息等不是线路上的数据，不合成报文
+	if message.Direction != "incoming" && message.Direction != "outgoing" {
+		return nil
+	}
+	ts := messageTime(message.Timestamp)
+	// 保证时间单调，同一毫秒内的报文依次错开 1 微秒
+	if !ts.After(p.last) && !p.last.IsZero() {
+		ts = p.last.Add(time.Microsecond)
+	}
+	outgoing := message.Direction == "outgoing"
+
+	if p.flow.protocol == "udp" {
+		return p.packet(ts, p.frame(outgoing, 0, 0, 0, message.Payload))
+	}
+
+	if !p.started {
+		p.started = true
+		if err := p.handshake(ts); err != nil {
+			return err
+		}
+		ts = p.last.Add(time.Microsecond)
+	}
+	payload := message.Payload
+	for len(payload) > 0 {
+		n := len(payload)
+		if n > tcpSegmentSize {
+			n = tcpSegmentSize
+		}
+		seq, ack := p.localSeq, p.remoteSeq
+		if !outgoing {
+			seq, ack = p.remoteSeq, p.localSeq
+		}
+		if err := p.packet(ts, p.frame(outgoing, seq, ack, tcpPSH|tcpACK, payload[:n])); err != nil {
+			return err
+		}
+		if outgoing {
+			p.localSeq += uint32(n)
+		} else {
+			p.remoteSeq += uint32(n)
+		}
+		payload = payload[n:]
+		ts = ts.Add(time.Microsecond)
+	}
+	return nil
+}
+
+// handshake 在首条消息之前合成三次握手，客户端会话由本端发起，服务端会话由对端发起
+func (p *pcapngMessageWriter) handshake(ts time.Time) error {
+	// active 为发起方发出的报文方向，seq/peerSeq 为发起方与应答方的下一个发送序号
+	active := !p.flow.passive
+	seq, peerSeq := p.localSeq, p.remoteSeq
+	if p.flow.passive {
+		seq, peerSeq = peerSeq, seq
+	}
+	start := ts.Add(-3 * time.Microsecond)
+	if err := p.packet(start, p.frame(active, seq-1, 0, tcpSYN, nil)); err != nil {
+		return err
+	}
+	if err := p.packet(start.Add(time.Microsecond), p.frame(!active, peerSeq-1, seq, tcpSYN|tcpACK, nil)); err != nil {
+		return err
+	}
+	return p.packet(start.Add(2*time.Microsecond), p.frame(active, seq, peerSeq, tcpACK, nil))
+}
+
+// flush TCP 会话以本端发起的 FIN 挥手结束
+func (p *pcapngMessageWriter) flush() error {
+	if p.flow.protocol != "tcp" || !p.started {
+		return nil
+	}
+	ts := p.last.Add(time.Microsecond)
+	if err := p.packet(ts, p.frame(true, p.localSeq, p.remoteSeq, tcpFIN|tcpACK, nil)); err != nil {
+		return err
+	}
+	if err := p.packet(ts.Add(time.Microsecond), p.frame(false, p.remoteSeq, p.localSeq+1, tcpFIN|tcpACK, nil)); err != nil {
+		return err
+	}
+	return p.packet(ts.Add(2*time.Microsecond), p.frame(true, p.localSeq+1, p.remoteSeq+1, tcpACK, nil))
+}
+
+// frame 合成以太网帧，outgoing 为本端发往对端
+func (p *pcapngMessageWriter) frame(outgoing bool, seq uint32, ack uint32, flags byte, payload []byte) []byte {
+	srcIP, dstIP := p.flow.localIP, p.flow.remoteIP
+	srcPort, dstPort := p.flow.localPort, p.flow.remotePort
+	srcMAC, dstMAC := localMAC, remoteMAC
+	if !outgoing {
+		srcIP, dstIP = dstIP, srcIP
+		srcPort, dstPort = dstPort, srcPort
+		srcMAC, dstMAC = dstMAC, srcMAC
+	}
+
+	var transport []byte
+	var proto byte
+	if p.flow.protocol == "udp" {
+		proto = 17
+		transport = make([]byte, 8+len(payload))
+		binary.BigEndian.PutUint16(transport[0:], uint16(srcPort))
+		binary.BigEndian.PutUint16(transport[2:], uint16(dstPort))
+		binary.BigEndian.PutUint16(transport[4:], uint16(len(transport)))
+		copy(transport[8:], payload)
+	} else {
+		proto = 6
+		transport = make([]byte, 20+len(payload))
+		binary.BigEndian.PutUint16(transport[0:], uint16(srcPort))
+		binary.BigEndian.PutUint16(transport[2:], uint16(dstPort))
+		binary.BigEndian.PutUint32(transport[4:], seq)
+		binary.BigEndian.PutUint32(transport[8:], ack)
+		transport[12] = 5 << 4
+		transport[13] = flags
+		binary.BigEndian.PutUint16(transport[14:], 65535)
+		copy(transport[20:], payload)
+	}
+	sum := ^foldChecksum(checksumAdd(pseudoHeaderSum(srcIP, dstIP, proto, len(transport)), transport))
+	if proto == 17 {
+		if sum == 0 {
+			sum = 0xFFFF
+		}
+		binary.BigEndian.PutUint16(transport[6:], sum)
+	} else {
+		binary.BigEndian.PutUint16(transport[16:], sum)
+	}
+
+	var ip []byte
+	etherType := uint16(0x0800)
+	if src4, dst4 := srcIP.To4(), dstIP.To4(); src4 != nil && dst4 != nil {
+		p.ipID++
+		ip = make([]byte, 20, 20+len(transport))
+		ip[0] = 0x45
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(transport)))
+		binary.BigEndian.PutUint16(ip[4:], p.ipID)
+		ip[6] = 0x40 // DF
+		ip[8] = 64
+		ip[9] = proto
+		copy(ip[12:], src4)
+		copy(ip[16:], dst4)
+		binary.BigEndian.PutUint16(ip[10:], ^foldChecksum(checksumAdd(0, ip)))
+	} else {
+		etherType = 0x86DD
+		ip = make([]byte, 40, 40+len(transport))
+		ip[0] = 0x60
+		binary.BigEndian.PutUint16(ip[4:], uint16(len(transport)))
+		ip[6] = proto
+		ip[7] = 64
+		copy(ip[8:], srcIP.To16())
+		copy(ip[24:], dstIP.To16())
+	}
+
+	frame := make([]byte, 14, 14+len(ip)+len(transport))
+	copy(frame[0:], dstMAC)
+	copy(frame[6:], srcMAC)
+	binary.BigEndian.PutUint16(frame[12:], etherType)
+	frame = append(frame, ip...)
+	return append(frame, transport...)
+}
+
+// pseudoHeaderSum TCP/UDP 校验和的伪首部部分
+func pseudoHeaderSum(src net.IP, dst net.IP, proto byte, length int) uint32 {
+	var sum uint32
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		sum = checksumAdd(sum, src4)
+		sum = checksumAdd(sum, dst4)
+	} else {
+		sum = checksumAdd(sum, src.To16())
+		sum = checksumAdd(sum, dst.To16())
+	}
+	return sum + uint32(proto) + uint32(length)
+}
+
+// checksumAdd 按 16 位大端字累加，奇数长度末尾补零
+func checksumAdd(sum uint32, data []byte) uint32 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	return sum
+}
+
+func foldChecksum(sum uint32) uint16 {
+	for sum>>16 != 0 {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return uint16(sum)
+}
+
+// messageTime 解析消息记录的时间，兼容只精确到秒的旧记录
+func messageTime(timestamp string) time.Time {
+	for _, layout := range []string{models.TimestampLayout, "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, timestamp, time.Local); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,143 @@
+package control
+
+import (
+	"bytes"
+	"connectivity/types"
+	"encoding/binary"
+	"testing"
+)
+
+// pcapngPackets 拆分 pcapng 文件，返回增强分组块中的帧
+func pcapngPackets(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	var frames [][]byte
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("块不完整: %d", len(data))
+		}
+		blockType := binary.LittleEndian.Uint32(data[0:])
+		total := int(binary.LittleEndian.Uint32(data[4:]))
+		if total%4 != 0 || total > len(data) || binary.LittleEndian.Uint32(data[total-4:]) != uint32(total) {
+			t.Fatalf("块长度错误: %d", total)
+		}
+		if blockType == pcapngEnhancedPacket {
+			n := binary.LittleEndian.Uint32(data[20:])
+			frames = append(frames, data[28:28+n])
+		}
+		data = data[total:]
+	}
+	return frames
+}
+
+func TestPcapngTCP(t *testing.T) {
+	flow := newPcapFlow("tcp", "0.0.0.0", 9000, "192.168.1.5", 50000)
+	flow.passive = true
+	var buf bytes.Buffer
+	p, err := newPcapngMessageWriter(&buf, flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	big := bytes.Repeat([]byte{0xAA}, 2000)
+	messages := []*types.Message{
+		{Direction: "system", Payload: []byte("客户端已连接"), Timestamp: "2024-05-01 08:00:00.050"},
+		{Direction: "incoming", Payload: []byte("ping"), Timestamp: "2024-05-01 08:00:00.100"},
+		{Direction: "outgoing", Payload: big, Timestamp: "2024-05-01 08:00:00.100"},
+	}
+	for _, message := range messages {
+		if err := p.write(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	frames := pcapngPackets(t, buf.Bytes())
+	// 3 次握手 + 1 + 2 个数据分段 + 3 个挥手报文，系统消息不生成报文
+	if len(frames) != 9 {
+		t.Fatalf("frames = %d", len(frames))
+	}
+	// 服务端会话由对端发送 SYN，本端应答 SYN/ACK
+	syn, synAck := frames[0][34:], frames[1][34:]
+	if binary.BigEndian.Uint16(syn[0:]) != 50000 || syn[13] != tcpSYN || binary.BigEndian.Uint32(syn[4:]) != 4999 {
+		t.Fatalf("syn = % X", syn[:20])
+	}
+	if binary.BigEndian.Uint16(synAck[0:]) != 9000 || synAck[13] != tcpSYN|tcpACK || binary.BigEndian.Uint32(synAck[8:]) != 5000 {
+		t.Fatalf("syn/ack = % X", synAck[:20])
+	}
+	first := frames[3]
+	ip := first[14:34]
+	if binary.BigEndian.Uint16(first[12:]) != 0x0800 || foldChecksum(checksumAdd(0, ip)) != 0xFFFF {
+		t.Fatalf("ip header = % X", ip)
+	}
+	if !bytes.Equal(ip[12:16], []byte{192, 168, 1, 5}) || !bytes.Equal(ip[16:20], []byte{10, 0, 0, 1}) {
+		t.Fatalf("地址错误: % X", ip[12:20])
+	}
+	tcp := first[34:]
+	if binary.BigEndian.Uint16(tcp[0:]) != 50000 || binary.BigEndian.Uint16(tcp[2:]) != 9000 || string(tcp[20:]) != "ping" {
+		t.Fatalf("tcp = % X", tcp)
+	}
+	if foldChecksum(checksumAdd(pseudoHeaderSum(flow.remoteIP, flow.localIP, 6, len(tcp)), tcp)) != 0xFFFF {
+		t.Fatal("TCP 校验和错误")
+	}
+
+	// 对端数据之后本端序号不变，分段序号连续
+	second, third := frames[4][34:], frames[5][34:]
+	seq := binary.BigEndian.Uint32(second[4:])
+	if binary.BigEndian.Uint32(second[8:]) != 5004 || len(second)-20 != tcpSegmentSize || binary.BigEndian.Uint32(third[4:]) != seq+tcpSegmentSize {
+		t.Fatalf("序号错误: seq=%d", seq)
+	}
+	if frames[6][34+13] != tcpFIN|tcpACK {
+		t.Fatalf("flags = %02X", frames[6][34+13])
+	}
+}
+
+func TestPcapngClientHandshake(t *testing.T) {
+	flow := newPcapFlow("tcp", "", 50001, "192.168.1.5", 9000)
+	var buf bytes.Buffer
+	p, err := newPcapngMessageWriter(&buf, flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.write(&types.Message{Direction: "outgoing", Payload: []byte("hi"), Timestamp: "2024-05-01 08:00:00.100"}); err != nil {
+		t.Fatal(err)
+	}
+	// 客户端会话由本端发送 SYN
+	syn := pcapngPackets(t, buf.Bytes())[0][34:]
+	if binary.BigEndian.Uint16(syn[0:]) != 50001 || syn[13] != tcpSYN || binary.BigEndian.Uint32(syn[4:]) != 999 {
+		t.Fatalf("syn = % X", syn[:20])
+	}
+}
+
+func TestPcapngUDPIPv6(t *testing.T) {
+	flow := newPcapFlow("udp", "", 40000, "::1", 7000)
+	var buf bytes.Buffer
+	p, err := newPcapngMessageWriter(&buf, flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.write(&types.Message{Direction: "outgoing", Payload: []byte("abc"), Timestamp: "2024-05-01 08:00:00"}); err != nil {
+		t.Fatal(err)
+	}
+	frames := pcapngPackets(t, buf.Bytes())
+	if len(frames) != 1 {
+		t.Fatalf("frames = %d", len(frames))
+	}
+	frame := frames[0]
+	if binary.BigEndian.Uint16(frame[12:]) != 0x86DD || frame[14+6] != 17 {
+		t.Fatalf("frame = % X", frame[:22])
+	}
+	udp := frame[54:]
+	if binary.BigEndian.Uint16(udp[2:]) != 7000 || binary.BigEndian.Uint16(udp[4:]) != 11 || string(udp[8:]) != "abc" {
+		t.Fatalf("udp = % X", udp)
+	}
+	if foldChecksum(checksumAdd(pseudoHeaderSum(flow.localIP, flow.remoteIP, 17, len(udp)), udp)) != 0xFFFF {
+		t.Fatal("UDP 校验和错误")
+	}
+}
+
+func TestValidateExportPcapng(t *testing.T) {
+	if _, err := validateExport(types.MessageExport{ServerID: 1, Format: ExportPcapng}); err == nil {
+		t.Fatal("服务端导出 pcapng 应要求指定连接")
+	}
+}
@@ -0,0 +1,131 @@
+package control
+
+import (
+	"connectivity/types"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// 重连退避方式
+const (
+	BackoffFixed       = "fixed"
+	BackoffExponential = "exponential"
+)
+
+// 重连触发条件
+const (
+	ReconnectOnAll   = "all"
+	ReconnectOnEOF   = "eof"
+	ReconnectOnError = "error"
+)
+
+const (
+	defaultReconnectDelay    = time.Second
+	defaultReconnectMaxDelay = 30 * time.Second
+)
+
+// validateReconnectPolicy 校验重连策略，未启用时不做检查
+func validateReconnectPolicy(policy types.ReconnectPolicy) error {
+	if !policy.Enabled {
+		return nil
+	}
+	switch policy.Backoff {
+	case "", BackoffFixed, BackoffExponential:
+	default:
+		return fmt.Errorf("不支持的退避方式: %s", policy.Backoff)
+	}
+	switch policy.Trigger {
+	case "", ReconnectOnAll, ReconnectOnEOF, ReconnectOnError:
+	default:
+		return fmt.Errorf("不支持的重连触发条件: %s", policy.Trigger)
+	}
+	if policy.InitialDelayMs < 0 || policy.MaxDelayMs < 0 || policy.MaxAttempts < 0 {
+		return errors.New("重连延迟和次数不能为负数")
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return errors.New("抖动比例必须在 0~1 之间")
+	}
+	return nil
+}
+
+// shouldReconnect 根据策略和断开原因判断是否需要重连，对端正常关闭视为 EOF
+func shouldReconnect(policy types.ReconnectPolicy, err error) bool {
+	if !policy.Enabled || isClosedError(err) {
+		return false
+	}
+	eof := err == nil || errors.Is(err, io.EOF)
+	switch policy.Trigger {
+	case ReconnectOnEOF:
+		return eof
+	case ReconnectOnError:
+		return !eof
+	}
+	return true
+}
+
+// reconnectDelay 计算第 attempt 次（从 1 开始）重连前的等待时间，rnd 返回 [0,1) 的随机数
+func reconnectDelay(policy types.ReconnectPolicy, attempt int, rnd func() float64) time.Duration {
+	delay := defaultReconnectDelay
+	if policy.InitialDelayMs > 0 {
+		delay = time.Duration(policy.InitialDelayMs) * time.Millisecond
+	}
+	maxDelay := defaultReconnectMaxDelay
+	if policy.MaxDelayMs > 0 {
+		maxDelay = time.Duration(policy.MaxDelayMs) * time.Millisecond
+	}
+
+	d := float64(delay)
+	if policy.Backoff == BackoffExponential && attempt > 1 {
+		multiplier := policy.Multiplier
+		if multiplier <= 1 {
+			multiplier = 2
+		}
+		d *= math.Pow(multiplier, float64(attempt-1))
+	}
+	if d > float64(maxDelay) {
+		d = float64(maxDelay)
+	}
+	if policy.Jitter > 0 && rnd != nil {
+		d += d * policy.Jitter * (2*rnd() - 1)
+	}
+	if d < 0 {
+		d = 0
+	}
+	return time.Duration(d)
+}
+
+// reconnect 按策略循环重连，直到成功、达到最大次数或 stop 被关闭。
+// notify 用于推送 reconnecting/reconnected/gave_up 事件，被取消时不推送 gave_up。
+func reconnect(policy types.ReconnectPolicy, stop <-chan struct{}, dial func() (net.Conn, error), notify func(eventType string, content string)) (net.Conn, bool) {
+	var lastErr error
+	for attempt := 1; policy.MaxAttempts <= 0 || attempt <= policy.MaxAttempts; attempt++ {
+		delay := reconnectDelay(policy, attempt, rand.Float64)
+		content := fmt.Sprintf("第 %d 次重连，%v 后尝试", attempt, delay.Round(time.Millisecond))
+		if lastErr != nil {
+			content += fmt.Sprintf("，上次失败: %v", lastErr)
+		}
+		notify("reconnecting", content)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-stop:
+			timer.Stop()
+			return nil, false
+		case <-timer.C:
+		}
+
+		conn, err := dial()
+		if err == nil {
+			notify("reconnected", fmt.Sprintf("第 %d 次重连成功", attempt))
+			return conn, true
+		}
+		lastErr = err
+	}
+	notify("gave_up", fmt.Sprintf("重连 %d 次均失败，已放弃: %v", policy.MaxAttempts, lastErr))
+	return nil, false
+}
@@ -0,0 +1,130 @@
+package control
+
+import (
+	"connectivity/types"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReconnectDelay(t *testing.T) {
+	policy := types.ReconnectPolicy{Enabled: true, Backoff: BackoffExponential, InitialDelayMs: 100, MaxDelayMs: 1000}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if got := reconnectDelay(policy, i+1, nil); got != w*time.Millisecond {
+			t.Fatalf("attempt %d: %v, want %v", i+1, got, w*time.Millisecond)
+		}
+	}
+
+	policy.Backoff = BackoffFixed
+	if got := reconnectDelay(policy, 5, nil); got != 100*time.Millisecond {
+		t.Fatalf("fixed: %v", got)
+	}
+
+	policy.Jitter = 0.5
+	if got := reconnectDelay(policy, 1, func() float64 { return 0 }); got != 50*time.Millisecond {
+		t.Fatalf("jitter min: %v", got)
+	}
+	if got := reconnectDelay(policy, 1, func() float64 { return 0.999999 }); got < 149*time.Millisecond || got > 150*time.Millisecond {
+		t.Fatalf("jitter max: %v", got)
+	}
+}
+
+func TestShouldReconnect(t *testing.T) {
+	refused := &net.OpError{Op: "read", Err: syscall.ECONNREFUSED}
+	cases := []struct {
+		policy types.ReconnectPolicy
+		err    error
+		want   bool
+	}{
+		{types.ReconnectPolicy{}, io.EOF, false},
+		{types.ReconnectPolicy{Enabled: true}, io.EOF, true},
+		{types.ReconnectPolicy{Enabled: true}, refused, true},
+		{types.ReconnectPolicy{Enabled: true}, net.ErrClosed, false},
+		{types.ReconnectPolicy{Enabled: true, Trigger: ReconnectOnEOF}, refused, false},
+		{types.ReconnectPolicy{Enabled: true, Trigger: ReconnectOnError}, io.EOF, false},
+		{types.ReconnectPolicy{Enabled: true, Trigger: ReconnectOnError}, refused, true},
+	}
+	for i, c := range cases {
+		if got := shouldReconnect(c.policy, c.err); got != c.want {
+			t.Fatalf("case %d: %v", i, got)
+		}
+	}
+}
+
+func TestValidateReconnectPolicy(t *testing.T) {
+	if err := validateReconnectPolicy(types.ReconnectPolicy{Backoff: "bad"}); err != nil {
+		t.Fatal("未启用时不应校验")
+	}
+	bad := []types.ReconnectPolicy{
+		{Enabled: true, Backoff: "linear"},
+		{Enabled: true, Trigger: "timeout"},
+		{Enabled: true, MaxAttempts: -1},
+		{Enabled: true, Jitter: 2},
+	}
+	for _, policy := range bad {
+		if err := validateReconnectPolicy(policy); err == nil {
+			t.Fatalf("应校验失败: %+v", policy)
+		}
+	}
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	policy := types.ReconnectPolicy{Enabled: true, InitialDelayMs: 1, MaxAttempts: 3}
+	dials := 0
+	var events []string
+	conn, ok := reconnect(policy, make(chan struct{}), func() (net.Conn, error) {
+		dials++
+		return nil, errors.New("refused")
+	}, func(eventType string, content string) {
+		events = append(events, eventType)
+	})
+	if ok || conn != nil || dials != 3 {
+		t.Fatalf("ok=%v dials=%d", ok, dials)
+	}
+	if len(events) != 4 || events[3] != "gave_up" {
+		t.Fatalf("events = %v", events)
+	}
+}
+
+func TestReconnectSucceeds(t *testing.T) {
+	policy := types.ReconnectPolicy{Enabled: true, InitialDelayMs: 1}
+	client, server := net.Pipe()
+	defer server.Close()
+
+	dials := 0
+	var last string
+	conn, ok := reconnect(policy, make(chan struct{}), func() (net.Conn, error) {
+		dials++
+		if dials < 2 {
+			return nil, errors.New("refused")
+		}
+		return client, nil
+	}, func(eventType string, content string) {
+		last = eventType
+	})
+	if !ok || conn != client || dials != 2 || last != "reconnected" {
+		t.Fatalf("ok=%v dials=%d last=%s", ok, dials, last)
+	}
+	conn.Close()
+}
+
+func TestReconnectCancelled(t *testing.T) {
+	policy := types.ReconnectPolicy{Enabled: true, InitialDelayMs: 60000}
+	stop := make(chan struct{})
+	close(stop)
+
+	var events []string
+	conn, ok := reconnect(policy, stop, func() (net.Conn, error) {
+		t.Fatal("取消后不应拨号")
+		return nil, nil
+	}, func(eventType string, content string) {
+		events = append(events, eventType)
+	})
+	if ok || conn != nil || len(events) != 1 || events[0] != "reconnecting" {
+		t.Fatalf("ok=%v events=%v", ok, events)
+	}
+}
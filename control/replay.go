@@ -0,0 +1,350 @@
+package control
+
+import (
+	"connectivity/types"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// 回放目标类型
+const (
+	ReplayTCPClient = "tcp-client"
+	ReplayUDPClient = "udp-client"
+	ReplayTCPServer = "tcp-server"
+	ReplayUDPServer = "udp-server"
+)
+
+// replayInputMethod 回放发出的消息记录的输入方式
+const replayInputMethod = "replay"
+
+var errReplayStopped = errors.New("回放已停止")
+
+// FuncReplay 抓包会话与消息记录回放，通过已有的客户端连接或服务端连接发出载荷
+type FuncReplay struct {
+	mu        sync.Mutex
+	Ctx       context.Context
+	Events    EventSink
+	Db        *sql.DB
+	TcpClient *FuncTcpClient
+	UdpClient *FuncUdpClient
+	TcpServer *FuncTcpServer
+	UdpServer *FuncUdpServer
+
+	captures      map[int]*pcapCapture
+	nextCaptureID int
+	replays       map[int]chan struct{} // 正在进行的回放，关闭通道可停止
+	nextReplayID  int
+}
+
+// pcapCapture 已解析的抓包文件
+type pcapCapture struct {
+	path  string
+	flows []*capturedFlow
+}
+
+// OpenPcap 加载 pcap/pcapng 文件并列出其中的 TCP/UDP 会话，path 为空时弹出文件选择对话框
+func (r *FuncReplay) OpenPcap(path string) types.ConnectResult {
+	if path == "" {
+		var err error
+		path, err = runtime.OpenFileDialog(r.Ctx, runtime.OpenDialogOptions{
+			Title: "导入抓包文件",
+			Filters: []runtime.FileFilter{
+				{DisplayName: "抓包文件 (*.pcap;*.pcapng;*.cap)", Pattern: "*.pcap;*.pcapng;*.cap"},
+			},
+		})
+		if err != nil {
+			return types.ConnectResult{
+				Success: false,
+				Message: fmt.Sprintf("打开文件对话框失败: %v", err),
+			}
+		}
+		if path == "" {
+			return types.ConnectResult{
+				Success: false,
+				Message: "已取消导入",
+			}
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("读取文件失败: %v", err),
+		}
+	}
+	flows, err := parseCapture(data)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("解析抓包文件失败: %v", err),
+		}
+	}
+
+	r.mu.Lock()
+	if r.captures == nil {
+		r.captures = make(map[int]*pcapCapture)
+	}
+	r.nextCaptureID++
+	id := r.nextCaptureID
+	r.captures[id] = &pcapCapture{path: path, flows: flows}
+	r.mu.Unlock()
+
+	capture := types.PcapCapture{ID: id, Path: path, Flows: []types.PcapFlow{}}
+	for _, flow := range flows {
+		capture.Flows = append(capture.Flows, flow.summary())
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: fmt.Sprintf("已加载 %d 条会话", len(flows)),
+		Data:    capture,
+	}
+}
+
+// ClosePcap 释放已加载的抓包文件
+func (r *FuncReplay) ClosePcap(captureID int) types.ConnectResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.captures[captureID]; !ok {
+		return types.ConnectResult{
+			Success: false,
+			Message: "抓包文件未加载",
+		}
+	}
+	delete(r.captures, captureID)
+	return types.ConnectResult{
+		Success: true,
+		Message: "已关闭抓包文件",
+	}
+}
+
+func (f *capturedFlow) summary() types.PcapFlow {
+	summary := types.PcapFlow{ID: f.id, Protocol: f.protocol, AddrA: f.addrA, AddrB: f.addrB}
+	for _, segment := range f.segments {
+		if segment.fromA {
+			summary.PacketsA++
+			summary.BytesA += len(segment.payload)
+		} else {
+			summary.PacketsB++
+			summary.BytesB += len(segment.payload)
+		}
+	}
+	if len(f.segments) > 0 {
+		first, last := f.segments[0].time, f.segments[len(f.segments)-1].time
+		summary.Start = first.Format("2006-01-02 15:04:05.000")
+		summary.DurationMs = last.Sub(first).Milliseconds()
+	}
+	return summary
+}
+
+// StartPcapReplay 将抓包会话中一端的载荷通过回放目标发出，返回回放标识，进度通过 replay_event 事件推送
+func (r *FuncReplay) StartPcapReplay(req types.PcapReplay) types.ConnectResult {
+	r.mu.Lock()
+	capture, ok := r.captures[req.CaptureID]
+	r.mu.Unlock()
+	if !ok {
+		return types.ConnectResult{
+			Success: false,
+			Message: "抓包文件未加载",
+		}
+	}
+	var flow *capturedFlow
+	for _, f := range capture.flows {
+		if f.id == req.FlowID {
+			flow = f
+		}
+	}
+	if flow == nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("会话不存在: %d", req.FlowID),
+		}
+	}
+
+	var fromA bool
+	switch strings.ToLower(req.Side) {
+	case "a":
+		fromA = true
+	case "b":
+	default:
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("回放端无效: %s", req.Side),
+		}
+	}
+	packets := flow.sidePackets(fromA)
+	if len(packets) == 0 {
+		return types.ConnectResult{
+			Success: false,
+			Message: "所选一端没有可回放的载荷",
+		}
+	}
+	if err := validateReplayTarget(req.Target, flow.protocol); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+	speed, err := replaySpeed(req.Timing, req.Speed)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+	return r.startReplay(packets, speed, req.Target, nil)
+}
+
+// validateReplayTarget 校验回放目标类型，protocol 非空时要求与目标的传输协议一致
+func validateReplayTarget(target types.ReplayTarget, protocol string) error {
+	var targetProtocol string
+	switch target.Type {
+	case ReplayTCPClient, ReplayTCPServer:
+		targetProtocol = "tcp"
+	case ReplayUDPClient, ReplayUDPServer:
+		targetProtocol = "udp"
+	default:
+		return fmt.Errorf("不支持的回放目标: %s", target.Type)
+	}
+	if protocol != "" && protocol != targetProtocol {
+		return fmt.Errorf("%s 会话不能通过 %s 回放", protocol, target.Type)
+	}
+	if (target.Type == ReplayTCPServer || target.Type == ReplayUDPServer) && target.ConnID == 0 {
+		return errors.New("服务端回放需要指定连接")
+	}
+	return nil
+}
+
+// sender 返回向回放目标发送原始字节的函数
+func (r *FuncReplay) sender(target types.ReplayTarget) func(payload []byte) error {
+	switch target.Type {
+	case ReplayTCPClient:
+		return func(payload []byte) error { return r.TcpClient.sendRaw(target.ID, payload, replayInputMethod) }
+	case ReplayUDPClient:
+		return func(payload []byte) error { return r.UdpClient.sendRaw(target.ID, payload, replayInputMethod) }
+	case ReplayTCPServer:
+		return func(payload []byte) error {
+			return r.TcpServer.sendRaw(target.ID, target.ConnID, payload, replayInputMethod)
+		}
+	default:
+		return func(payload []byte) error {
+			return r.UdpServer.sendRaw(target.ID, target.ConnID, payload, replayInputMethod)
+		}
+	}
+}
+
+// startReplay 在后台按节奏发送报文，afterSend 非空时在每次发送后调用，用于等待回复
+func (r *FuncReplay) startReplay(packets []replayPacket, speed float64, target types.ReplayTarget, afterSend func(stop <-chan struct{}) error) types.ConnectResult {
+	r.mu.Lock()
+	if r.replays == nil {
+		r.replays = make(map[int]chan struct{})
+	}
+	r.nextReplayID++
+	replayID := r.nextReplayID
+	stop := make(chan struct{})
+	r.replays[replayID] = stop
+	r.mu.Unlock()
+
+	send := r.sender(target)
+	total := len(packets)
+	go func() {
+		defer func() {
+			r.mu.Lock()
+			delete(r.replays, replayID)
+			r.mu.Unlock()
+		}()
+		r.emitReplay(types.ReplayEvent{ReplayID: replayID, Type: "started", Total: total})
+		err := runReplay(packets, speed, stop, send, afterSend, func(sent int) {
+			r.emitReplay(types.ReplayEvent{ReplayID: replayID, Type: "progress", Sent: sent, Total: total})
+		})
+		switch {
+		case err == nil:
+			r.emitReplay(types.ReplayEvent{ReplayID: replayID, Type: "finished", Sent: total, Total: total, Message: "回放完成"})
+		case errors.Is(err, errReplayStopped):
+			r.emitReplay(types.ReplayEvent{ReplayID: replayID, Type: "stopped", Total: total, Message: err.Error()})
+		default:
+			r.emitReplay(types.ReplayEvent{ReplayID: replayID, Type: "error", Total: total, Message: err.Error()})
+		}
+	}()
+
+	return types.ConnectResult{
+		Success: true,
+		Message: fmt.Sprintf("回放已开始，共 %d 个报文", total),
+		Data:    replayID,
+	}
+}
+
+// StopReplay 停止回放
+func (r *FuncReplay) StopReplay(replayID int) types.ConnectResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stop, ok := r.replays[replayID]
+	if !ok {
+		return types.ConnectResult{
+			Success: false,
+			Message: "回放不存在或已结束",
+		}
+	}
+	close(stop)
+	delete(r.replays, replayID)
+	return types.ConnectResult{
+		Success: true,
+		Message: "回放已停止",
+	}
+}
+
+func (r *FuncReplay) emitReplay(event types.ReplayEvent) {
+	emitEvent(r.Events, "replay_event", event)
+}
+
+// runReplay 按报文的相对时间发送，speed 为速度倍数，0 表示不等待。各报文按起始时间排期，发送耗时不会累积；
+// afterSend 非空时每次发送后调用，其耗时不计入报文间隔
+func runReplay(packets []replayPacket, speed float64, stop <-chan struct{}, send func(payload []byte) error, afterSend func(stop <-chan struct{}) error, progress func(sent int)) error {
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	start := time.Now()
+	for i, packet := range packets {
+		if speed > 0 {
+			due := start.Add(time.Duration(float64(packet.offset) / speed))
+			if wait := time.Until(due); wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-stop:
+					return errReplayStopped
+				case <-timer.C:
+				}
+			}
+		}
+		select {
+		case <-stop:
+			return errReplayStopped
+		default:
+		}
+		if err := send(packet.payload); err != nil {
+			return fmt.Errorf("第 %d 个报文发送失败: %v", i+1, err)
+		}
+		progress(i + 1)
+		if afterSend != nil && i < len(packets)-1 {
+			if err := afterSend(stop); err != nil {
+				return err
+			}
+			if speed > 0 {
+				// 以等待结束的时刻作为当前报文的发送时间，重新排期后续报文
+				start = time.Now().Add(-time.Duration(float64(packet.offset) / speed))
+			}
+		}
+	}
+	return nil
+}
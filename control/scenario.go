@@ -0,0 +1,587 @@
+package control
+
+import (
+	"bytes"
+	"connectivity/models"
+	"connectivity/types"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"gopkg.in/yaml.v3"
+)
+
+// 场景步骤
+const (
+	StepConnect    = "connect"    // 连接客户端，服务端目标等待新连接
+	StepSend       = "send"       // 发送数据
+	StepExpect     = "expect"     // 在超时内等待匹配的数据
+	StepSleep      = "sleep"      // 等待
+	StepLoop       = "loop"       // 循环执行子步骤
+	StepDisconnect = "disconnect" // 断开连接
+)
+
+// defaultExpectTimeout expect 与服务端 connect 的默认超时
+const defaultExpectTimeout = time.Second
+
+// scenarioReceiveBuffer 执行期间缓存的收到消息数，超出时丢弃
+const scenarioReceiveBuffer = 1024
+
+// defaultScenarioRuns 默认返回的运行记录条数
+const defaultScenarioRuns = 100
+
+// FuncScenario 测试场景，按步骤驱动客户端或服务端连接并校验收到的数据，运行报告保存到数据库
+type FuncScenario struct {
+	Ctx       context.Context
+	Events    *FanoutSink
+	Db        *sql.DB
+	TcpClient *FuncTcpClient
+	UdpClient *FuncUdpClient
+	TcpServer *FuncTcpServer
+	UdpServer *FuncUdpServer
+}
+
+// parseScenario 解析 JSON 或 YAML 格式的场景，字段名与 JSON 相同
+func parseScenario(data []byte) (types.Scenario, error) {
+	var scenario types.Scenario
+	// YAML 是 JSON 的超集，先解析为通用结构再按 JSON 字段解码，两种格式共用一套字段名
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return scenario, err
+	}
+	normalized, err := json.Marshal(raw)
+	if err != nil {
+		return scenario, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(normalized))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&scenario); err != nil {
+		return scenario, err
+	}
+	return scenario, validateScenario(scenario)
+}
+
+// validateScenario 校验目标与全部步骤
+func validateScenario(scenario types.Scenario) error {
+	switch scenario.Target.Type {
+	case ReplayTCPClient, ReplayUDPClient, ReplayTCPServer, ReplayUDPServer:
+	default:
+		return fmt.Errorf("不支持的场景目标: %s", scenario.Target.Type)
+	}
+	if scenario.Target.ID == 0 {
+		return errors.New("需要指定场景目标")
+	}
+	if len(scenario.Steps) == 0 {
+		return errors.New("场景没有步骤")
+	}
+	return validateSteps(scenario.Steps, "")
+}
+
+func validateSteps(steps []types.ScenarioStep, prefix string) error {
+	for i, step := range steps {
+		path := prefix + strconv.Itoa(i+1)
+		if err := validateStep(step, path); err != nil {
+			return fmt.Errorf("步骤 %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func validateStep(step types.ScenarioStep, path string) error {
+	if step.TimeoutMs < 0 || step.DurationMs < 0 {
+		return errors.New("时间不能为负数")
+	}
+	switch step.Action {
+	case StepConnect, StepDisconnect:
+	case StepSend:
+		// 与发送时一样按模板渲染，hex 内容中可以包含占位符
+		if _, err := renderTemplate(step.Data, step.Input, templateContext{}); err != nil {
+			return fmt.Errorf("发送内容格式错误: %v", err)
+		}
+	case StepExpect:
+		if _, err := compileExpect(step, ""); err != nil {
+			return err
+		}
+	case StepSleep:
+		if step.DurationMs == 0 {
+			return errors.New("需要指定等待时长")
+		}
+	case StepLoop:
+		if step.Count <= 0 {
+			return errors.New("循环次数必须大于 0")
+		}
+		if len(step.Steps) == 0 {
+			return errors.New("循环没有子步骤")
+		}
+		return validateSteps(step.Steps, path+".")
+	default:
+		return fmt.Errorf("不支持的步骤: %s", step.Action)
+	}
+	return nil
+}
+
+// expectMatcher expect 步骤的匹配条件，每条收到的消息单独匹配，流式协议需配置分帧
+type expectMatcher struct {
+	match    string
+	pattern  []byte
+	wildcard []bool // hex 模式中 ?? 所在位置
+	re       *regexp.Regexp
+}
+
+// compileExpect 编译期望条件，文本期望内容按目标的字符编码 charset 转换
+func compileExpect(step types.ScenarioStep, charset string) (*expectMatcher, error) {
+	m := &expectMatcher{match: step.Match}
+	if m.match == "" {
+		m.match = MatchExact
+	}
+	var err error
+	switch m.match {
+	case MatchExact, MatchPrefix:
+		if m.pattern, err = encodePayloadCharset(step.Data, step.Input, charset); err != nil {
+			return nil, fmt.Errorf("期望内容格式错误: %v", err)
+		}
+	case MatchRegex:
+		if m.re, err = regexp.Compile(step.Data); err != nil {
+			return nil, fmt.Errorf("正则表达式错误: %v", err)
+		}
+	case MatchHex:
+		if m.pattern, m.wildcard, err = parseHexPattern(step.Data); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的匹配方式: %s", step.Match)
+	}
+	return m, nil
+}
+
+// matches exact 与 hex 要求整条消息一致，prefix 匹配开头，regex 在消息中查找
+func (m *expectMatcher) matches(data []byte) bool {
+	switch m.match {
+	case MatchExact:
+		return bytes.Equal(data, m.pattern)
+	case MatchPrefix:
+		return bytes.HasPrefix(data, m.pattern)
+	case MatchRegex:
+		return m.re.Match(data)
+	}
+	if len(data) != len(m.pattern) {
+		return false
+	}
+	for i, b := range m.pattern {
+		if !m.wildcard[i] && data[i] != b {
+			return false
+		}
+	}
+	return true
+}
+
+// scenarioSink 收集场景目标收到的消息和服务端的新连接，缓冲区满时丢弃，不阻塞收发
+type scenarioSink struct {
+	target   types.ReplayTarget
+	received chan *types.Message
+	conns    chan int
+}
+
+func (s *scenarioSink) Emit(name string, data interface{}) {
+	event, ok := data.(types.ServerEvent)
+	if !ok || event.ServerId != s.target.ID || event.Message == nil {
+		return
+	}
+	isServer := s.target.Type == ReplayTCPServer || s.target.Type == ReplayUDPServer
+	if (isServer && name != "server_event") || (!isServer && name != "client_event") {
+		return
+	}
+	switch {
+	case event.Type == "data_received":
+		select {
+		case s.received <- event.Message:
+		default:
+		}
+	case isServer && event.Type == "connection_status" && event.Message.ConnID != "":
+		if connID, err := strconv.Atoi(event.Message.ConnID); err == nil {
+			select {
+			case s.conns <- connID:
+			default:
+			}
+		}
+	}
+}
+
+func (s *scenarioSink) LogError(message string) {}
+
+// scenarioRun 一次场景执行
+type scenarioRun struct {
+	f       *FuncScenario
+	target  types.ReplayTarget
+	connID  int    // 服务端目标当前使用的连接
+	charset string // 目标的字符编码
+	sink    *scenarioSink
+	results []types.ScenarioStepResult
+}
+
+// LoadScenario 读取 JSON 或 YAML 场景文件，path 为空时弹出文件选择对话框
+func (f *FuncScenario) LoadScenario(path string) types.ConnectResult {
+	if path == "" {
+		var err error
+		path, err = runtime.OpenFileDialog(f.Ctx, runtime.OpenDialogOptions{
+			Title: "打开测试场景",
+			Filters: []runtime.FileFilter{
+				{DisplayName: "场景文件 (*.json;*.yaml;*.yml)", Pattern: "*.json;*.yaml;*.yml"},
+			},
+		})
+		if err != nil {
+			return types.ConnectResult{
+				Success: false,
+				Message: fmt.Sprintf("打开文件对话框失败: %v", err),
+			}
+		}
+		if path == "" {
+			return types.ConnectResult{
+				Success: false,
+				Message: "已取消",
+			}
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("读取文件失败: %v", err),
+		}
+	}
+	scenario, err := parseScenario(data)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("场景格式错误: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "加载场景成功",
+		Data:    scenario,
+	}
+}
+
+// RunScenario 执行场景并保存运行记录，执行完成后返回报告，每个步骤的结果通过 scenario_event 事件推送。
+// 场景未通过时 Success 仍为 true，以报告中的 passed 为准
+func (f *FuncScenario) RunScenario(scenario types.Scenario) types.ConnectResult {
+	if err := validateScenario(scenario); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("场景格式错误: %v", err),
+		}
+	}
+
+	run := &scenarioRun{
+		f:       f,
+		target:  scenario.Target,
+		connID:  scenario.Target.ConnID,
+		charset: scenarioCharset(f.Db, scenario.Target),
+		sink: &scenarioSink{
+			target:   scenario.Target,
+			received: make(chan *types.Message, scenarioReceiveBuffer),
+			conns:    make(chan int, scenarioReceiveBuffer),
+		},
+		results: []types.ScenarioStepResult{},
+	}
+	remove := f.Events.Add(run.sink)
+	start := time.Now()
+	passed := run.runSteps(scenario.Steps, "", 0)
+	remove()
+
+	report := types.ScenarioReport{
+		Name:       scenario.Name,
+		Target:     scenario.Target,
+		Passed:     passed,
+		StartedAt:  start.Format(models.TimestampLayout),
+		DurationMs: time.Since(start).Milliseconds(),
+		Steps:      run.results,
+	}
+	message := "场景通过"
+	if !passed {
+		last := run.results[len(run.results)-1]
+		message = fmt.Sprintf("场景未通过: 步骤 %s %s", last.Path, last.Message)
+	}
+	id, err := models.AddScenarioRun(f.Db, report)
+	if err != nil {
+		logError(f.Events, fmt.Sprintf("保存场景运行记录失败: %v", err))
+	}
+	report.RunID = id
+	return types.ConnectResult{
+		Success: true,
+		Message: message,
+		Data:    report,
+	}
+}
+
+// runSteps 依次执行步骤，失败时返回 false 并停止
+func (r *scenarioRun) runSteps(steps []types.ScenarioStep, prefix string, iteration int) bool {
+	for i, step := range steps {
+		path := prefix + strconv.Itoa(i+1)
+		start := time.Now()
+		var message string
+		var err error
+		if step.Action == StepLoop {
+			message = fmt.Sprintf("完成 %d 次循环", step.Count)
+			for it := 1; it <= step.Count; it++ {
+				if !r.runSteps(step.Steps, path+".", it) {
+					err = fmt.Errorf("第 %d 次循环失败", it)
+					break
+				}
+			}
+		} else {
+			message, err = r.exec(step)
+		}
+
+		result := types.ScenarioStepResult{
+			Path:       path,
+			Iteration:  iteration,
+			Action:     step.Action,
+			Name:       step.Name,
+			Passed:     err == nil,
+			DurationMs: time.Since(start).Milliseconds(),
+			Message:    message,
+		}
+		if err != nil {
+			result.Message = err.Error()
+		}
+		r.results = append(r.results, result)
+		emitEvent(r.f.Events, "scenario_event", result)
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *scenarioRun) isServer() bool {
+	return r.target.Type == ReplayTCPServer || r.target.Type == ReplayUDPServer
+}
+
+// exec 执行单个步骤，返回执行说明
+func (r *scenarioRun) exec(step types.ScenarioStep) (string, error) {
+	switch step.Action {
+	case StepConnect:
+		if r.isServer() {
+			return r.acceptConn(step)
+		}
+		return r.connectClient()
+	case StepSend:
+		return r.send(step)
+	case StepExpect:
+		return r.expect(step)
+	case StepSleep:
+		time.Sleep(time.Duration(step.DurationMs) * time.Millisecond)
+		return fmt.Sprintf("等待 %d 毫秒", step.DurationMs), nil
+	default:
+		return r.disconnect()
+	}
+}
+
+// scenarioCharset 返回场景目标的字符编码，目标不存在时为空，按 UTF-8 处理
+func scenarioCharset(db *sql.DB, target types.ReplayTarget) string {
+	switch target.Type {
+	case ReplayTCPServer, ReplayUDPServer:
+		if server, err := models.FindServerOne(db, target.ID); err == nil {
+			return server.Encoding
+		}
+	default:
+		if client, err := models.FindServerClientOne(db, target.ID); err == nil {
+			return client.Encoding
+		}
+	}
+	return ""
+}
+
+func stepTimeout(step types.ScenarioStep) time.Duration {
+	if step.TimeoutMs > 0 {
+		return time.Duration(step.TimeoutMs) * time.Millisecond
+	}
+	return defaultExpectTimeout
+}
+
+func (r *scenarioRun) connectClient() (string, error) {
+	status, connect := r.f.TcpClient.GetTCPClientStatus, r.f.TcpClient.ConnectTCPClient
+	if r.target.Type == ReplayUDPClient {
+		status, connect = r.f.UdpClient.GetUdpClientStatus, r.f.UdpClient.ConnectUdpClient
+	}
+	if status(r.target.ID).Success {
+		return "客户端已连接", nil
+	}
+	if result := connect(r.target.ID); !result.Success {
+		return "", errors.New(result.Message)
+	}
+	return "连接成功", nil
+}
+
+// acceptConn 确保服务端运行，指定了连接时直接使用，否则在超时内等待新连接
+func (r *scenarioRun) acceptConn(step types.ScenarioStep) (string, error) {
+	status, start := r.f.TcpServer.GetTCPServerStatus, r.f.TcpServer.StartTCPServer
+	if r.target.Type == ReplayUDPServer {
+		status, start = r.f.UdpServer.GetUdpServerStatus, r.f.UdpServer.StartUdpServer
+	}
+	if !status(r.target.ID).Success {
+		if result := start(r.target.ID); !result.Success {
+			return "", errors.New(result.Message)
+		}
+	}
+	if r.target.ConnID != 0 {
+		r.connID = r.target.ConnID
+		return fmt.Sprintf("使用连接 %d", r.connID), nil
+	}
+
+	timeout := stepTimeout(step)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r.connID = <-r.sink.conns:
+		return fmt.Sprintf("连接 %d 已建立", r.connID), nil
+	case <-timer.C:
+		return "", fmt.Errorf("%d 毫秒内没有新连接", timeout.Milliseconds())
+	}
+}
+
+func (r *scenarioRun) send(step types.ScenarioStep) (string, error) {
+	var result types.ConnectResult
+	switch r.target.Type {
+	case ReplayTCPClient:
+		result = r.f.TcpClient.SendMessage(r.target.ID, step.Data, step.Input)
+	case ReplayUDPClient:
+		result = r.f.UdpClient.SendMessage(r.target.ID, step.Data, step.Input)
+	case ReplayTCPServer, ReplayUDPServer:
+		if r.connID == 0 {
+			return "", errors.New("没有可用的服务端连接，需先执行 connect 步骤")
+		}
+		if r.target.Type == ReplayTCPServer {
+			result = r.f.TcpServer.SendMessageEncoded(r.target.ID, r.connID, step.Data, step.Input)
+		} else {
+			result = r.f.UdpServer.SendMessageEncoded(r.target.ID, r.connID, step.Data, step.Input)
+		}
+	}
+	if !result.Success {
+		return "", errors.New(result.Message)
+	}
+	return result.Message, nil
+}
+
+// expect 依次检查收到的消息，跳过不匹配的，超时前没有匹配时失败
+func (r *scenarioRun) expect(step types.ScenarioStep) (string, error) {
+	matcher, err := compileExpect(step, r.charset)
+	if err != nil {
+		return "", err
+	}
+	if r.isServer() && r.connID == 0 {
+		return "", errors.New("没有可用的服务端连接，需先执行 connect 步骤")
+	}
+	connID := strconv.Itoa(r.connID)
+
+	timeout := stepTimeout(step)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	skipped := 0
+	var last []byte
+	for {
+		select {
+		case message := <-r.sink.received:
+			if r.isServer() && message.ConnID != connID {
+				continue
+			}
+			if matcher.matches(message.Payload) {
+				result := fmt.Sprintf("收到匹配数据 %d 字节", len(message.Payload))
+				if skipped > 0 {
+					result += fmt.Sprintf("，跳过 %d 条不匹配的消息", skipped)
+				}
+				return result, nil
+			}
+			skipped++
+			last = message.Payload
+		case <-timer.C:
+			if last == nil {
+				return "", fmt.Errorf("%d 毫秒内没有收到数据", timeout.Milliseconds())
+			}
+			return "", fmt.Errorf("%d 毫秒内没有收到匹配数据，收到 %d 条不匹配的消息，最后一条: %s", timeout.Milliseconds(), skipped, strings.ToUpper(formatHex(last)))
+		}
+	}
+}
+
+func (r *scenarioRun) disconnect() (string, error) {
+	var result types.ConnectResult
+	switch r.target.Type {
+	case ReplayTCPClient:
+		result = r.f.TcpClient.DisconnectTCPClient(r.target.ID)
+	case ReplayUDPClient:
+		result = r.f.UdpClient.DisconnectUdpClient(r.target.ID)
+	case ReplayTCPServer, ReplayUDPServer:
+		if r.connID == 0 {
+			return "", errors.New("没有可用的服务端连接")
+		}
+		if r.target.Type == ReplayTCPServer {
+			result = r.f.TcpServer.DisconnectClient(r.target.ID, r.connID)
+		} else {
+			result = r.f.UdpServer.DisconnectClient(r.target.ID, r.connID)
+		}
+		r.connID = 0
+	}
+	if !result.Success {
+		return "", errors.New(result.Message)
+	}
+	return result.Message, nil
+}
+
+// GetScenarioRuns 获取最近的场景运行记录，limit 为 0 时返回最近 100 条
+func (f *FuncScenario) GetScenarioRuns(limit int) types.ConnectResult {
+	if limit <= 0 {
+		limit = defaultScenarioRuns
+	}
+	runs, err := models.GetScenarioRuns(f.Db, limit)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取运行记录失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "获取运行记录成功",
+		Data:    runs,
+	}
+}
+
+// GetScenarioRun 获取运行记录的完整报告
+func (f *FuncScenario) GetScenarioRun(id int) types.ConnectResult {
+	report, err := models.FindScenarioRunOne(f.Db, id)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取运行记录失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "获取运行记录成功",
+		Data:    report,
+	}
+}
+
+// DeleteScenarioRun 删除运行记录
+func (f *FuncScenario) DeleteScenarioRun(id int) types.ConnectResult {
+	if err := models.DeleteScenarioRun(f.Db, id); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("删除运行记录失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "删除运行记录成功",
+	}
+}
@@ -0,0 +1,189 @@
+package control
+
+import (
+	"bytes"
+	"connectivity/models"
+	"connectivity/types"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScenario(t *testing.T) {
+	yamlScenario := `
+name: 登录
+target: {type: tcp-server, id: 1}
+steps:
+  - action: connect
+    timeout_ms: 500
+  - action: loop
+    count: 2
+    steps:
+      - {action: send, data: "01 02", input: hex}
+      - {action: expect, match: hex, data: "AA ?? 03"}
+`
+	scenario, err := parseScenario([]byte(yamlScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scenario.Name != "登录" || scenario.Target.Type != ReplayTCPServer || len(scenario.Steps) != 2 || scenario.Steps[1].Steps[1].Data != "AA ?? 03" {
+		t.Fatalf("scenario = %+v", scenario)
+	}
+	jsonScenario := `{"target":{"type":"tcp-client","id":2},"steps":[{"action":"sleep","duration_ms":10}]}`
+	if _, err := parseScenario([]byte(jsonScenario)); err != nil {
+		t.Fatal(err)
+	}
+	// hex 发送内容可以包含模板占位符
+	templated := `{"target":{"type":"tcp-client","id":2},"steps":[{"action":"send","input":"hex","data":"AA {{seq:x2}} {{crc16_modbus}}"}]}`
+	if _, err := parseScenario([]byte(templated)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, bad := range []string{
+		`{"target":{"type":"ws-client","id":1},"steps":[{"action":"connect"}]}`,
+		`{"target":{"type":"tcp-client","id":1},"steps":[{"action":"connect","timeout":5}]}`,
+		`{"target":{"type":"tcp-client","id":1},"steps":[{"action":"loop","count":0,"steps":[{"action":"connect"}]}]}`,
+		`{"target":{"type":"tcp-client","id":1},"steps":[{"action":"loop","count":1,"steps":[{"action":"expect","match":"regex","data":"("}]}]}`,
+		`{"target":{"type":"tcp-client","id":1},"steps":[{"action":"jump"}]}`,
+	} {
+		if _, err := parseScenario([]byte(bad)); err == nil {
+			t.Errorf("parseScenario(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestExpectMatcher(t *testing.T) {
+	cases := []struct {
+		step types.ScenarioStep
+		data string
+		want bool
+	}{
+		{types.ScenarioStep{Data: "OK"}, "OK", true},
+		{types.ScenarioStep{Data: "OK"}, "OK!", false},
+		{types.ScenarioStep{Match: MatchPrefix, Data: "OK"}, "OK!", true},
+		{types.ScenarioStep{Match: MatchRegex, Data: `id=\d+`}, "user id=42", true},
+		{types.ScenarioStep{Match: MatchHex, Data: "4F ?? 21"}, "OK!", true},
+		{types.ScenarioStep{Match: MatchHex, Data: "4F ??"}, "OK!", false},
+	}
+	for _, c := range cases {
+		m, err := compileExpect(c.step, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.matches([]byte(c.data)); got != c.want {
+			t.Errorf("%+v matches %q = %v, want %v", c.step, c.data, got, c.want)
+		}
+	}
+}
+
+func TestExpectMatcherCharset(t *testing.T) {
+	m, err := compileExpect(types.ScenarioStep{Data: "你好"}, CharsetGBK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.matches([]byte{0xC4, 0xE3, 0xBA, 0xC3}) || m.matches([]byte("你好")) {
+		t.Fatalf("pattern = % X", m.pattern)
+	}
+}
+
+func TestRunScenarioTCPServer(t *testing.T) {
+	db := openMessageDB(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	if err := models.AddServer(db, types.Server{Host: "127.0.0.1", Port: port, Status: "stopped", Type: "tcp"}); err != nil {
+		t.Fatal(err)
+	}
+
+	events := NewFanoutSink()
+	server := &FuncTcpServer{
+		Servers: make(map[int]NetListener),
+		Conn:    make(map[int]ServerConn),
+		Events:  events,
+		Db:      db,
+	}
+	defer server.StopTCPServer(1)
+	f := &FuncScenario{Events: events, Db: db, TcpServer: server}
+
+	// 对端: 发送 hello，之后每收到一次 ping 回复 pong
+	go func() {
+		var conn net.Conn
+		var err error
+		for i := 0; i < 50; i++ {
+			if conn, err = net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port))); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("hello"))
+		buf := make([]byte, 4)
+		for {
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			if _, err := conn.Read(buf); err != nil {
+				return
+			}
+			if bytes.Equal(buf, []byte("ping")) {
+				conn.Write([]byte("pong"))
+			}
+		}
+	}()
+
+	scenario := types.Scenario{
+		Name:   "握手",
+		Target: types.ReplayTarget{Type: ReplayTCPServer, ID: 1},
+		Steps: []types.ScenarioStep{
+			{Action: StepConnect, TimeoutMs: 2000},
+			{Action: StepExpect, Data: "hello"},
+			{Action: StepLoop, Count: 2, Steps: []types.ScenarioStep{
+				{Action: StepSend, Data: "ping"},
+				{Action: StepExpect, Match: MatchHex, Data: "70 ?? 6E 67"},
+			}},
+			{Action: StepSend, Data: "ping"},
+			{Action: StepExpect, Data: "never", TimeoutMs: 200},
+			{Action: StepDisconnect},
+		},
+	}
+	resp := f.RunScenario(scenario)
+	if !resp.Success {
+		t.Fatal(resp.Message)
+	}
+	report := resp.Data.(types.ScenarioReport)
+	if report.Passed || report.RunID == 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	var paths []string
+	for _, step := range report.Steps {
+		paths = append(paths, step.Path+"/"+strconv.FormatBool(step.Passed))
+	}
+	want := "1/true,2/true,3.1/true,3.2/true,3.1/true,3.2/true,3/true,4/true,5/false"
+	if strings.Join(paths, ",") != want {
+		t.Fatalf("steps = %v, want %s", paths, want)
+	}
+	if last := report.Steps[len(report.Steps)-1]; !strings.Contains(last.Message, "70 6F 6E 67") {
+		t.Fatalf("failure message = %q", last.Message)
+	}
+
+	runs := f.GetScenarioRuns(0).Data.([]types.ScenarioReport)
+	if len(runs) != 1 || runs[0].Name != "握手" || runs[0].Passed {
+		t.Fatalf("runs = %+v", runs)
+	}
+	saved := f.GetScenarioRun(report.RunID)
+	if !saved.Success || len(saved.Data.(types.ScenarioReport).Steps) != len(report.Steps) {
+		t.Fatalf("saved run = %+v", saved)
+	}
+	if resp := f.DeleteScenarioRun(report.RunID); !resp.Success {
+		t.Fatal(resp.Message)
+	}
+	if f.GetScenarioRun(report.RunID).Success {
+		t.Fatal("deleted run still exists")
+	}
+}
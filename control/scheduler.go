@@ -0,0 +1,87 @@
+package control
+
+import (
+	"connectivity/types"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// sendStep 校验后的发送步骤
+type sendStep struct {
+	content     string
+	inputMethod string
+	delay       time.Duration
+	charset     string
+}
+
+// compileSequence 校验发送序列，每一步的延迟至少 1 毫秒，文本按 charset 编码
+func compileSequence(sequence types.SendSequence, charset string) ([]sendStep, error) {
+	if len(sequence.Steps) == 0 {
+		return nil, errors.New("发送序列不能为空")
+	}
+	if sequence.Loop < 0 {
+		return nil, errors.New("循环次数不能为负数")
+	}
+	steps := make([]sendStep, 0, len(sequence.Steps))
+	for i, step := range sequence.Steps {
+		if step.DelayMs <= 0 {
+			return nil, fmt.Errorf("第 %d 步延迟必须大于 0 毫秒", i+1)
+		}
+		s := sendStep{
+			content:     step.Content,
+			inputMethod: step.InputMethod,
+			delay:       time.Duration(step.DelayMs) * time.Millisecond,
+			charset:     charset,
+		}
+		if _, err := s.render(templateContext{Seq: 1, Counter: 1}); err != nil {
+			return nil, fmt.Errorf("第 %d 步数据格式错误: %v", i+1, err)
+		}
+		steps = append(steps, s)
+	}
+	return steps, nil
+}
+
+// render 渲染载荷模板后编码为待发送字节
+func (s sendStep) render(ctx templateContext) ([]byte, error) {
+	ctx.Charset = s.charset
+	return renderTemplate(s.content, s.inputMethod, ctx)
+}
+
+// runSequence 按顺序逐步发送，loop 为 0 时无限循环，seqKey 为发送目标的序号键。各步按累计时间排期，避免发送耗时造成漂移。
+// 完成全部循环、done 收到信号或 send 返回 false 时结束；替换占位符后格式错误的步骤会被跳过。
+func runSequence(steps []sendStep, loop int, seqKey string, done <-chan bool, send func(payload []byte, inputMethod string) bool) {
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	next := time.Now()
+	counter := 0
+	for round := 0; loop == 0 || round < loop; round++ {
+		for _, step := range steps {
+			next = next.Add(step.delay)
+			wait := time.Until(next)
+			if wait < 0 {
+				// 落后于排期（如重连期间）时重新对齐，避免集中补发
+				next, wait = time.Now(), 0
+			}
+			timer.Reset(wait)
+			select {
+			case <-done:
+				return
+			case <-timer.C:
+			}
+
+			counter++
+			payload, err := step.render(templateContext{Seq: payloadSeq.next(seqKey), Counter: counter})
+			if err != nil {
+				continue
+			}
+			if !send(payload, step.inputMethod) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package control
+
+import (
+	"connectivity/types"
+	"testing"
+	"time"
+)
+
+func TestCompileSequence(t *testing.T) {
+	bad := []types.SendSequence{
+		{},
+		{Loop: -1, Steps: []types.SequenceStep{{Content: "a", DelayMs: 1}}},
+		{Steps: []types.SequenceStep{{Content: "a", DelayMs: 0}}},
+		{Steps: []types.SequenceStep{{Content: "GG", InputMethod: InputHex, DelayMs: 1}}},
+	}
+	for _, sequence := range bad {
+		if _, err := compileSequence(sequence, ""); err == nil {
+			t.Fatalf("应校验失败: %+v", sequence)
+		}
+	}
+}
+
+func TestSendStepRender(t *testing.T) {
+	cases := []struct {
+		step    sendStep
+		counter int
+		want    string
+	}{
+		{sendStep{content: "msg {{counter}}", inputMethod: InputText}, 12, "msg 12"},
+		{sendStep{content: "AA {{counter:x2}} 55", inputMethod: InputHex}, 10, "\xaa\x0a\x55"},
+		{sendStep{content: "AA {{counter:x2}}", inputMethod: InputHex}, 0x1ff, "\xaa\xff"},
+		{sendStep{content: "{{counter:x4}}", inputMethod: InputText}, 255, "00FF"},
+	}
+	for _, c := range cases {
+		got, err := c.step.render(templateContext{Counter: c.counter})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != c.want {
+			t.Fatalf("%q: %q, want %q", c.step.content, got, c.want)
+		}
+	}
+}
+
+func TestRunSequence(t *testing.T) {
+	steps, err := compileSequence(types.SendSequence{Steps: []types.SequenceStep{
+		{Content: "a{{counter}}", InputMethod: InputText, DelayMs: 1},
+		{Content: "62", InputMethod: InputHex, DelayMs: 2},
+	}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []string
+	runSequence(steps, 2, "test", make(chan bool), func(payload []byte, inputMethod string) bool {
+		sent = append(sent, string(payload))
+		return true
+	})
+	want := []string{"a1", "b", "a3", "b"}
+	if len(sent) != len(want) {
+		t.Fatalf("sent = %v", sent)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Fatalf("sent = %v", sent)
+		}
+	}
+
+	// send 返回 false 时结束
+	count := 0
+	runSequence(steps, 0, "test", make(chan bool), func(payload []byte, inputMethod string) bool {
+		count++
+		return count < 3
+	})
+	if count != 3 {
+		t.Fatalf("count = %d", count)
+	}
+}
+
+func TestRunSequenceStop(t *testing.T) {
+	steps, _ := compileSequence(types.SendSequence{Steps: []types.SequenceStep{{Content: "a", DelayMs: 1}}}, "")
+	done := make(chan bool, 1)
+	finished := make(chan struct{})
+	sent := 0
+	go func() {
+		runSequence(steps, 0, "test", done, func(payload []byte, inputMethod string) bool {
+			sent++
+			if sent == 2 {
+				done <- true
+			}
+			return true
+		})
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("停止后任务未结束")
+	}
+	if sent != 2 {
+		t.Fatalf("sent = %d", sent)
+	}
+}
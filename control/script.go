@@ -0,0 +1,410 @@
+package control
+
+import (
+	"connectivity/models"
+	"connectivity/types"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// 脚本目标
+const (
+	ScriptClient = "client"
+	ScriptServer = "server"
+)
+
+// scriptCallTimeout 单次钩子调用（包括脚本顶层代码）的最长执行时间，超时后中断脚本
+const scriptCallTimeout = time.Second
+
+// minScriptTimer onTimer 的最小间隔
+const minScriptTimer = 10 * time.Millisecond
+
+// FuncScript 客户端与服务端的 JavaScript 脚本，用于模拟有状态的设备。
+// 脚本可定义以下钩子:
+//
+//	onConnect()    连接建立时调用，客户端重连成功后再次调用
+//	onData(data)   收到一条消息时调用，data 为 Uint8Array
+//	onTimer()      setTimer 设置的定时器到期时调用
+//
+// 并可使用 send(data, input)、close()、log(...)、setTimer(ms)、hex(data)、text(data) 以及 state 对象，
+// 每个连接运行独立的实例，全局变量与 state 在连接期间保持
+type FuncScript struct {
+	mu  sync.Mutex
+	Ctx context.Context
+	Db  *sql.DB
+}
+
+// GetScript 获取客户端或服务端的脚本，未设置时返回空脚本
+func (a *FuncScript) GetScript(targetType string, targetID int) types.ConnectResult {
+	script, err := models.FindScript(a.Db, targetType, targetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.ConnectResult{
+			Success: true,
+			Message: "未设置脚本",
+			Data:    types.Script{TargetType: targetType, TargetID: targetID},
+		}
+	}
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取脚本失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "获取脚本成功",
+		Data:    script,
+	}
+}
+
+// SaveScript 检查语法后保存脚本，对之后建立的连接生效
+func (a *FuncScript) SaveScript(script types.Script) types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := validateScriptTarget(script.TargetType); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+	if _, err := compileScript(script.Source); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("脚本语法错误: %v", err),
+		}
+	}
+	if err := models.SaveScript(a.Db, script); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("保存脚本失败: %v", err),
+		}
+	}
+	scripts.invalidate()
+	return types.ConnectResult{
+		Success: true,
+		Message: "保存脚本成功，对新建立的连接生效",
+	}
+}
+
+// DeleteScript 删除脚本，已建立的连接继续运行原脚本
+func (a *FuncScript) DeleteScript(targetType string, targetID int) types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := models.DeleteScript(a.Db, targetType, targetID); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("删除脚本失败: %v", err),
+		}
+	}
+	scripts.invalidate()
+	return types.ConnectResult{
+		Success: true,
+		Message: "删除脚本成功",
+	}
+}
+
+func validateScriptTarget(targetType string) error {
+	switch targetType {
+	case ScriptClient, ScriptServer:
+		return nil
+	}
+	return fmt.Errorf("不支持的脚本目标: %s", targetType)
+}
+
+func compileScript(source string) (*goja.Program, error) {
+	return goja.Compile("script", source, false)
+}
+
+// scriptCache 按目标缓存已编译的启用脚本，脚本变更时整体失效
+type scriptCache struct {
+	mu       sync.Mutex
+	programs map[string]*goja.Program
+}
+
+var scripts = &scriptCache{programs: make(map[string]*goja.Program)}
+
+// get 返回目标的脚本，没有或未启用时返回 nil
+func (c *scriptCache) get(db *sql.DB, targetType string, targetID int) (*goja.Program, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := targetType + ":" + strconv.Itoa(targetID)
+	if program, ok := c.programs[key]; ok {
+		return program, nil
+	}
+	script, err := models.FindScript(db, targetType, targetID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	var program *goja.Program
+	if err == nil && script.Enabled {
+		if program, err = compileScript(script.Source); err != nil {
+			return nil, err
+		}
+	}
+	c.programs[key] = program
+	return program, nil
+}
+
+func (c *scriptCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.programs = make(map[string]*goja.Program)
+}
+
+// scriptHost 脚本所在连接提供的操作
+type scriptHost struct {
+	send    func(data []byte) error
+	close   func()                                 // 断开连接，需异步执行，不得等待钩子返回
+	log     func(eventType string, content string) // eventType 为 script_log 或 error
+	alive   func() bool                            // 为 false 时跳过钩子，如客户端重连期间，可为 nil
+	charset string                                 // 连接的字符编码，用于字符串与字节的相互转换
+}
+
+// scriptSession 单个连接的脚本实例，钩子依次执行
+type scriptSession struct {
+	mu      sync.Mutex
+	vm      *goja.Runtime
+	host    scriptHost
+	stopped bool
+	timer   chan struct{} // 当前定时器的停止通道
+}
+
+// newScriptSession 为连接创建脚本实例并执行顶层代码，目标没有启用的脚本时返回 nil。
+// 返回值的方法均可在 nil 上调用
+func newScriptSession(db *sql.DB, targetType string, targetID int, host scriptHost) *scriptSession {
+	program, err := scripts.get(db, targetType, targetID)
+	if err != nil {
+		host.log("error", fmt.Sprintf("加载脚本失败: %v", err))
+		return nil
+	}
+	if program == nil {
+		return nil
+	}
+
+	s := &scriptSession{vm: goja.New(), host: host}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bind()
+	if err := s.run(func() error {
+		_, err := s.vm.RunProgram(program)
+		return err
+	}); err != nil {
+		host.log("error", fmt.Sprintf("脚本执行失败: %v", err))
+		s.stopLocked()
+		return nil
+	}
+	return s
+}
+
+// bind 注册脚本可用的函数与 state 对象
+func (s *scriptSession) bind() {
+	vm := s.vm
+	vm.Set("send", func(call goja.FunctionCall) goja.Value {
+		data, err := s.toBytes(call.Argument(0), call.Argument(1))
+		if err != nil {
+			panic(vm.NewTypeError(err.Error()))
+		}
+		if err := s.host.send(data); err != nil {
+			panic(vm.NewGoError(err))
+		}
+		return goja.Undefined()
+	})
+	vm.Set("close", func() {
+		s.stopLocked()
+		s.host.close()
+	})
+	vm.Set("log", func(call goja.FunctionCall) goja.Value {
+		parts := make([]string, len(call.Arguments))
+		for i, arg := range call.Arguments {
+			parts[i] = arg.String()
+		}
+		s.host.log("script_log", strings.Join(parts, " "))
+		return goja.Undefined()
+	})
+	vm.Set("setTimer", func(ms int64) {
+		s.setTimer(time.Duration(ms) * time.Millisecond)
+	})
+	vm.Set("hex", func(call goja.FunctionCall) goja.Value {
+		data, err := s.toBytes(call.Argument(0), goja.Undefined())
+		if err != nil {
+			panic(vm.NewTypeError(err.Error()))
+		}
+		return vm.ToValue(formatHex(data))
+	})
+	vm.Set("text", func(call goja.FunctionCall) goja.Value {
+		data, err := s.toBytes(call.Argument(0), goja.Undefined())
+		if err != nil {
+			panic(vm.NewTypeError(err.Error()))
+		}
+		return vm.ToValue(decodeText(data, s.host.charset))
+	})
+	vm.Set("state", vm.NewObject())
+}
+
+// toBytes 转换脚本传入的数据: 字符串按 input 指定的输入方式（默认 text，按连接字符编码转换）编码，
+// Uint8Array、ArrayBuffer 与数字数组按字节取值
+func (s *scriptSession) toBytes(value goja.Value, input goja.Value) ([]byte, error) {
+	if goja.IsUndefined(value) || goja.IsNull(value) {
+		return nil, errors.New("缺少数据")
+	}
+	switch exported := value.Export().(type) {
+	case string:
+		method := InputText
+		if !goja.IsUndefined(input) && !goja.IsNull(input) {
+			method = input.String()
+		}
+		return encodePayloadCharset(exported, method, s.host.charset)
+	case goja.ArrayBuffer:
+		return append([]byte(nil), exported.Bytes()...), nil
+	}
+	var data []byte
+	if err := s.vm.ExportTo(value, &data); err != nil {
+		return nil, fmt.Errorf("不支持的数据类型: %v", err)
+	}
+	// Uint8Array 与脚本共享内存，复制后再交给连接
+	return append([]byte(nil), data...), nil
+}
+
+// setTimer 以 interval 为间隔周期调用 onTimer，interval 不大于 0 时停止定时器
+func (s *scriptSession) setTimer(interval time.Duration) {
+	if s.timer != nil {
+		close(s.timer)
+		s.timer = nil
+	}
+	if interval <= 0 || s.stopped {
+		return
+	}
+	if interval < minScriptTimer {
+		interval = minScriptTimer
+	}
+	stop := make(chan struct{})
+	s.timer = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.mu.Lock()
+				// 等待锁期间定时器可能已被替换或停止
+				if s.timer == stop {
+					s.callLocked("onTimer")
+				}
+				s.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// run 执行脚本代码，超时后中断
+func (s *scriptSession) run(fn func() error) error {
+	timer := time.AfterFunc(scriptCallTimeout, func() {
+		s.vm.Interrupt("执行超时")
+	})
+	defer func() {
+		timer.Stop()
+		s.vm.ClearInterrupt()
+	}()
+	return fn()
+}
+
+// callLocked 调用脚本定义的钩子，未定义时忽略
+func (s *scriptSession) callLocked(name string, args ...goja.Value) {
+	if s.stopped || (s.host.alive != nil && !s.host.alive()) {
+		return
+	}
+	fn, ok := goja.AssertFunction(s.vm.Get(name))
+	if !ok {
+		return
+	}
+	if err := s.run(func() error {
+		_, err := fn(goja.Undefined(), args...)
+		return err
+	}); err != nil {
+		s.host.log("error", fmt.Sprintf("脚本 %s 执行失败: %v", name, err))
+	}
+}
+
+// onConnect 连接建立时调用
+func (s *scriptSession) onConnect() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.callLocked("onConnect")
+}
+
+// onData 收到消息时调用
+func (s *scriptSession) onData(data []byte) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return
+	}
+	array, err := s.vm.New(s.vm.Get("Uint8Array"), s.vm.ToValue(s.vm.NewArrayBuffer(append([]byte(nil), data...))))
+	if err != nil {
+		s.host.log("error", fmt.Sprintf("脚本 onData 执行失败: %v", err))
+		return
+	}
+	s.callLocked("onData", array)
+}
+
+// stop 停止定时器，之后不再调用钩子
+func (s *scriptSession) stop() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopLocked()
+}
+
+func (s *scriptSession) stopLocked() {
+	s.stopped = true
+	if s.timer != nil {
+		close(s.timer)
+		s.timer = nil
+	}
+}
+
+// scriptLogger 返回推送脚本日志与错误的函数，connID 为 0 时表示客户端
+func scriptLogger(events EventSink, eventName string, id int, connID int) func(eventType string, content string) {
+	return func(eventType string, content string) {
+		message := &types.Message{
+			Content:       content,
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "system",
+			InputMethod:   "script",
+			DisplayMethod: "text",
+			Encoding:      "utf-8",
+		}
+		if connID != 0 {
+			message.ServerID = int64(id)
+			message.ConnID = strconv.Itoa(connID)
+		} else {
+			message.ID = id
+		}
+		emitEvent(events, eventName, types.ServerEvent{
+			Type:     eventType,
+			ServerId: id,
+			Message:  message,
+		})
+	}
+}
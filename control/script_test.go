@@ -0,0 +1,187 @@
+package control
+
+import (
+	"bytes"
+	"connectivity/models"
+	"connectivity/types"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScriptSession(t *testing.T) {
+	db := openMessageDB(t)
+	// 缓存按目标标识共享，避免影响其他测试中的同号服务端
+	t.Cleanup(scripts.invalidate)
+	f := &FuncScript{Db: db}
+	if resp := f.SaveScript(types.Script{TargetType: ScriptServer, TargetID: 1, Source: "function onData( {", Enabled: true}); resp.Success {
+		t.Fatal("syntax error accepted")
+	}
+	if resp := f.SaveScript(types.Script{TargetType: "ws", TargetID: 1, Source: "", Enabled: true}); resp.Success {
+		t.Fatal("unknown target accepted")
+	}
+	source := `
+state.n = 0;
+function onData(data) {
+	state.n++;
+	if (text(data) === "loop") { while (true) {} }
+	log("got", hex(data), state.n);
+	send("AA 55", "hex");
+	send(new Uint8Array([1, 2]));
+	send([3]);
+	send(data);
+}
+`
+	if resp := f.SaveScript(types.Script{TargetType: ScriptServer, TargetID: 1, Source: source, Enabled: true}); !resp.Success {
+		t.Fatal(resp.Message)
+	}
+
+	var sent []byte
+	var logs []string
+	session := newScriptSession(db, ScriptServer, 1, scriptHost{
+		send: func(data []byte) error {
+			sent = append(sent, data...)
+			return nil
+		},
+		close: func() {},
+		log: func(eventType string, content string) {
+			logs = append(logs, eventType+": "+content)
+		},
+	})
+	if session == nil {
+		t.Fatal(logs)
+	}
+	defer session.stop()
+
+	session.onData([]byte("hi"))
+	if !bytes.Equal(sent, []byte{0xAA, 0x55, 1, 2, 3, 'h', 'i'}) {
+		t.Fatalf("sent % X", sent)
+	}
+	if len(logs) != 1 || logs[0] != "script_log: got 68 69 1" {
+		t.Fatalf("logs = %q", logs)
+	}
+
+	start := time.Now()
+	session.onData([]byte("loop"))
+	if elapsed := time.Since(start); elapsed > 3*scriptCallTimeout {
+		t.Fatalf("interrupt took %v", elapsed)
+	}
+	if len(logs) != 2 || !strings.HasPrefix(logs[1], "error: 脚本 onData 执行失败") {
+		t.Fatalf("logs = %q", logs)
+	}
+
+	// 中断后实例仍可继续使用
+	sent = nil
+	session.onData([]byte("x"))
+	if !bytes.HasSuffix(sent, []byte("x")) || !strings.HasSuffix(logs[2], " 3") {
+		t.Fatalf("sent % X, logs %q", sent, logs)
+	}
+
+	// 禁用后新连接不再运行脚本
+	if resp := f.SaveScript(types.Script{TargetType: ScriptServer, TargetID: 1, Source: source, Enabled: false}); !resp.Success {
+		t.Fatal(resp.Message)
+	}
+	if newScriptSession(db, ScriptServer, 1, scriptHost{}) != nil {
+		t.Fatal("disabled script still runs")
+	}
+}
+
+func TestScriptCharset(t *testing.T) {
+	db := openMessageDB(t)
+	t.Cleanup(scripts.invalidate)
+	source := `function onData(data) { send(text(data) + "好"); }`
+	if resp := (&FuncScript{Db: db}).SaveScript(types.Script{TargetType: ScriptServer, TargetID: 2, Source: source, Enabled: true}); !resp.Success {
+		t.Fatal(resp.Message)
+	}
+
+	var sent []byte
+	session := newScriptSession(db, ScriptServer, 2, scriptHost{
+		send: func(data []byte) error {
+			sent = append(sent, data...)
+			return nil
+		},
+		close:   func() {},
+		log:     func(eventType string, content string) { t.Log(eventType, content) },
+		charset: CharsetGBK,
+	})
+	defer session.stop()
+
+	// 收到的 GBK 字节按连接编码解码，发送的字符串再按连接编码转换
+	session.onData([]byte{0xC4, 0xE3})
+	if !bytes.Equal(sent, []byte{0xC4, 0xE3, 0xBA, 0xC3}) {
+		t.Fatalf("sent % X", sent)
+	}
+}
+
+func TestScriptTCPServer(t *testing.T) {
+	db := openMessageDB(t)
+	t.Cleanup(scripts.invalidate)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	if err := models.AddServer(db, types.Server{Host: "127.0.0.1", Port: port, Status: "stopped", Type: "tcp"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟设备: 连接后发送 HI，ping 应答带计数的 pong，tick 启动定时器发送两次 T，bye 断开连接
+	source := `
+var count = 0;
+function onConnect() { send("HI"); }
+function onData(data) {
+	var cmd = text(data);
+	if (cmd === "ping") { count++; send("pong" + count); }
+	if (cmd === "tick") { state.ticks = 0; setTimer(20); }
+	if (cmd === "bye") { close(); }
+}
+function onTimer() {
+	send("T");
+	if (++state.ticks === 2) { setTimer(0); }
+}
+`
+	if resp := (&FuncScript{Db: db}).SaveScript(types.Script{TargetType: ScriptServer, TargetID: 1, Source: source, Enabled: true}); !resp.Success {
+		t.Fatal(resp.Message)
+	}
+
+	server := &FuncTcpServer{
+		Servers: make(map[int]NetListener),
+		Conn:    make(map[int]ServerConn),
+		Db:      db,
+	}
+	if resp := server.StartTCPServer(1); !resp.Success {
+		t.Fatal(resp.Message)
+	}
+	defer server.StopTCPServer(1)
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	expect := func(want string) {
+		t.Helper()
+		buf := make([]byte, len(want))
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != want {
+			t.Fatalf("read %q, %v, want %q", buf, err, want)
+		}
+	}
+
+	expect("HI")
+	for i := 1; i <= 2; i++ {
+		conn.Write([]byte("ping"))
+		expect("pong" + strconv.Itoa(i))
+	}
+	conn.Write([]byte("tick"))
+	expect("TT")
+
+	conn.Write([]byte("bye"))
+	if n, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read after close: %d, %v", n, err)
+	}
+}
@@ -1,19 +1,18 @@
 package control
 
 import (
-	"bytes"
 	"connectivity/models"
 	"connectivity/types"
 	"context"
+	"crypto/tls"
 	"database/sql"
-	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"net"
+	"reflect"
+	"strconv"
 	"sync"
 	"time"
-
-	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 type FuncTcpClient struct {
@@ -21,15 +20,16 @@ type FuncTcpClient struct {
 	Connections     map[int]net.Conn
 	ScheduledTasks  map[int]*ScheduledTask
 	ClientReadTasks map[int]*ClientReadTask
+	Reconnecting    map[int]chan struct{} // 正在重连的客户端，关闭通道可取消重连
 	Db              *sql.DB
 	Ctx             context.Context
+	Events          EventSink
 }
 
 // SendScheduledMessage 定时发送消息到 TCP 连接
 // 存储定时任务的map
 type ScheduledTask struct {
-	ticker *time.Ticker
-	done   chan bool
+	done chan bool
 }
 
 // ClientReadTask 客户端读取任务
@@ -73,6 +73,13 @@ func (a *FuncTcpClient) UpdateTCPClient(config types.ServerClient) types.Connect
 			Message: "连接在线无法修改，请断线后再修改",
 		}
 	}
+	config, err := mergeStoredClient(a.Db, config)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端失败: %v", err),
+		}
+	}
 	if err := models.UpdateServerClient(a.Db, config); err != nil {
 		return types.ConnectResult{
 			Success: false,
@@ -85,6 +92,32 @@ func (a *FuncTcpClient) UpdateTCPClient(config types.ServerClient) types.Connect
 	}
 }
 
+// mergeStoredClient 编辑客户端时，调用方未携带（零值）的编码和各项配置沿用已保存的值，
+// 避免只提交基本信息的编辑表单清空 TLS、分帧等配置
+func mergeStoredClient(db *sql.DB, config types.ServerClient) (types.ServerClient, error) {
+	stored, err := models.FindServerClientOne(db, config.ID)
+	if err != nil {
+		return config, err
+	}
+	if config.Encoding == "" {
+		config.Encoding = stored.Encoding
+	}
+	keepStored(&config.TLS, stored.TLS)
+	keepStored(&config.WS, stored.WS)
+	keepStored(&config.Framer, stored.Framer)
+	keepStored(&config.Reconnect, stored.Reconnect)
+	keepStored(&config.Sequence, stored.Sequence)
+	keepStored(&config.Checksum, stored.Checksum)
+	return config, nil
+}
+
+// keepStored 在 value 为零值时改用已保存的值
+func keepStored[T any](value *T, stored T) {
+	if reflect.ValueOf(value).Elem().IsZero() {
+		*value = stored
+	}
+}
+
 // GetAllTCPClients 获取所有 TCP 客户端
 func (a *FuncTcpClient) GetAllTCPClients() types.ConnectResult {
 	result, err := models.GetAllServerClients(a.Db, "tcp")
@@ -124,95 +157,207 @@ func (a *FuncTcpClient) DeleteTCPClient(id int) types.ConnectResult {
 			Message: fmt.Sprintf("删除客户端失败: %v", err),
 		}
 	}
+	scripts.invalidate()
 	return types.ConnectResult{
 		Success: true,
 		Message: "删除客户端成功",
 	}
 }
 
-// handleTCPConnection 处理 TCP 客户端连接
-func (a *FuncTcpClient) handleTCPConnectionTask(clientID int) {
-
-	task, exists := a.ClientReadTasks[clientID]
+// handleTCPConnectionTask 处理带定时发送任务的 TCP 客户端连接
+func (a *FuncTcpClient) handleTCPConnectionTask(client types.ServerClient) {
+	a.mu.Lock()
+	task, exists := a.ClientReadTasks[client.ID]
+	a.mu.Unlock()
 	if !exists {
 		return
 	}
 
-	defer task.conn.Close()
+	a.handleTCPConnection(client, task.conn)
+}
 
+// handleTCPConnection 处理 TCP 客户端连接，按分帧配置将数据流切分为完整消息，
+// 连接断开后按重连策略重新拨号并替换连接
+func (a *FuncTcpClient) handleTCPConnection(client types.ServerClient, conn net.Conn) {
+	clientID := client.ID
+	script := a.newScript(client)
+	defer script.stop()
+	script.onConnect()
 	for {
-		select {
-		case <-task.done:
-			return
-		default:
-			// 创建一个固定大小的缓冲区
-			buffer := make([]byte, 1024)
-			n, err := task.conn.Read(buffer)
-			if err != nil {
-				if err == io.EOF {
-					runtime.LogError(a.Ctx, fmt.Sprintf("连接已断开: %v", err))
-					return
-				}
-				continue
-			}
-
-			// 只取实际读取的数据
-			data := string(buffer[:n])
-
-			if err := models.AddMessage(a.Db, clientID, data, "tcp", "text", "utf-8", "incoming"); err != nil {
-				runtime.LogError(a.Ctx, fmt.Sprintf("添加消息失败: %v", err))
+		err := readFrames(conn, client.Framer, func(data []byte) {
+			display := detectDisplayMethodCharset(data, client.Encoding)
+			verdict := verifyChecksum(data, client.Checksum)
+			if err := models.AddMessageWithChecksum(a.Db, clientID, data, "tcp", display, normalizeCharset(client.Encoding), "incoming", verdict); err != nil {
+				logError(a.Events, fmt.Sprintf("添加消息失败: %v", err))
 			}
-			runtime.EventsEmit(a.Ctx, "client_event", types.ServerEvent{
+			emitEvent(a.Events, "client_event", types.ServerEvent{
 				Type:     "data_received",
 				ServerId: clientID,
 				Message: &types.Message{
 					ID:            clientID,
-					Content:       data,
+					Content:       renderPayloadCharset(data, display, client.Encoding),
+					Payload:       data,
+					Length:        len(data),
 					Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
 					Direction:     "incoming",
 					InputMethod:   "tcp",
-					DisplayMethod: "text",
-					Encoding:      "utf-8",
+					DisplayMethod: display,
+					Encoding:      normalizeCharset(client.Encoding),
+					Checksum:      verdict,
 				},
 			})
+			script.onData(data)
+		})
+		conn.Close()
+
+		// 连接已被 DisconnectTCPClient 移除，属于主动断开
+		stop, ok := a.beginReconnect(clientID, conn, shouldReconnect(client.Reconnect, err))
+		if !ok {
+			return
+		}
+		logError(a.Events, fmt.Sprintf("连接已断开: %v", err))
+		if stop == nil {
+			a.markOffline(clientID, fmt.Sprintf("连接已断开: %v", err))
+			return
+		}
+
+		newConn, _ := reconnect(client.Reconnect, stop, func() (net.Conn, error) {
+			return a.dial(client)
+		}, func(eventType string, content string) {
+			a.emitSystem(clientID, eventType, content)
+		})
+		swapped, cancelled := a.finishReconnect(clientID, newConn)
+		if !swapped {
+			if newConn != nil {
+				newConn.Close()
+			}
+			if !cancelled {
+				a.markOffline(clientID, "重连失败，连接已断开")
+			}
+			return
 		}
+		conn = newConn
+		script.onConnect()
 	}
 }
 
-func (a *FuncTcpClient) handleTCPConnection(clientID int, conn net.Conn) {
-	defer conn.Close()
+// newScript 创建客户端的脚本实例，重连期间跳过钩子
+func (a *FuncTcpClient) newScript(client types.ServerClient) *scriptSession {
+	clientID := client.ID
+	return newScriptSession(a.Db, ScriptClient, clientID, scriptHost{
+		send: func(data []byte) error {
+			return a.sendRaw(clientID, data, "script")
+		},
+		close: func() { go a.DisconnectTCPClient(clientID) },
+		log:   scriptLogger(a.Events, "client_event", clientID, 0),
+		alive: func() bool {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			_, exists := a.Connections[clientID]
+			return exists
+		},
+		charset: client.Encoding,
+	})
+}
 
-	for {
-		// 创建一个固定大小的缓冲区
-		buffer := make([]byte, 1024)
-		n, err := conn.Read(buffer)
+// beginReconnect 从连接表中移除已断开的连接，连接已被主动断开时返回 false；
+// 需要重连时登记并返回取消通道，否则返回 nil
+func (a *FuncTcpClient) beginReconnect(clientID int, conn net.Conn, reconnect bool) (chan struct{}, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if current, exists := a.Connections[clientID]; !exists || current != conn {
+		return nil, false
+	}
+	delete(a.Connections, clientID)
+	if !reconnect {
+		return nil, true
+	}
+	stop := make(chan struct{})
+	a.Reconnecting[clientID] = stop
+	return stop, true
+}
+
+// finishReconnect 重连结束后替换连接，重连期间被主动断开时 cancelled 为 true
+func (a *FuncTcpClient) finishReconnect(clientID int, conn net.Conn) (swapped bool, cancelled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, exists := a.Reconnecting[clientID]; !exists {
+		return false, true
+	}
+	delete(a.Reconnecting, clientID)
+	if conn == nil {
+		return false, false
+	}
+	a.Connections[clientID] = conn
+	if task, exists := a.ClientReadTasks[clientID]; exists {
+		task.conn = conn
+	}
+	return true, false
+}
+
+// markOffline 连接异常断开且不再重连时更新状态并停止定时发送
+func (a *FuncTcpClient) markOffline(clientID int, reason string) {
+	a.mu.Lock()
+	if task, exists := a.ScheduledTasks[clientID]; exists {
+		task.done <- true
+		delete(a.ScheduledTasks, clientID)
+	}
+	delete(a.ClientReadTasks, clientID)
+	a.mu.Unlock()
+
+	if client, err := models.GetServerClientData(a.Db, clientID); err == nil {
+		client.Status = "offline"
+		if err := models.UpdateServerClient(a.Db, client); err != nil {
+			logError(a.Events, fmt.Sprintf("更新客户端状态失败: %v", err))
+		}
+	}
+	a.emitSystem(clientID, "disconnected", reason)
+}
+
+// emitSystem 记录并推送系统消息
+func (a *FuncTcpClient) emitSystem(clientID int, eventType string, content string) {
+	if err := models.AddMessage(a.Db, clientID, []byte(content), "tcp", "text", "utf-8", "system"); err != nil {
+		logError(a.Events, fmt.Sprintf("添加消息失败: %v", err))
+	}
+	emitEvent(a.Events, "client_event", types.ServerEvent{
+		Type:     eventType,
+		ServerId: clientID,
+		Message: &types.Message{
+			ID:            clientID,
+			Content:       content,
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "system",
+			InputMethod:   "tcp",
+			DisplayMethod: "text",
+			Encoding:      "utf-8",
+		},
+	})
+}
+
+// dial 按客户端配置建立 TCP 或 TLS 连接
+func (a *FuncTcpClient) dial(client types.ServerClient) (net.Conn, error) {
+	addr := net.JoinHostPort(client.Host, strconv.Itoa(client.Port))
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !client.TLS.Enabled {
+		conn, err := dialer.Dial("tcp", addr)
 		if err != nil {
-			if err == io.EOF {
-				runtime.LogError(a.Ctx, fmt.Sprintf("连接已断开: %v", err))
-				return
-			}
-			continue
-		}
-
-		// 只取实际读取的数据
-		data := string(buffer[:n])
-		if err := models.AddMessage(a.Db, clientID, data, "tcp", "text", "utf-8", "incoming"); err != nil {
-			runtime.LogError(a.Ctx, fmt.Sprintf("添加消息失败: %v", err))
-		}
-		runtime.EventsEmit(a.Ctx, "client_event", types.ServerEvent{
-			Type:     "data_received",
-			ServerId: clientID,
-			Message: &types.Message{
-				ID:            clientID,
-				Content:       data,
-				Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-				Direction:     "incoming",
-				InputMethod:   "tcp",
-				DisplayMethod: "text",
-				Encoding:      "utf-8",
-			},
-		})
+			return nil, fmt.Errorf("连接失败: %v", err)
+		}
+		return conn, nil
 	}
+
+	tlsConfig, err := buildClientTLSConfig(client.TLS, client.Host)
+	if err != nil {
+		return nil, fmt.Errorf("TLS 配置错误: %v", err)
+	}
+	tlsConn, err := tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("TLS 连接失败: %v", err)
+	}
+	a.emitTLSHandshake(client.ID, tlsConn.ConnectionState())
+	return tlsConn, nil
 }
 
 // ConnectTCPClient 连接 TCP 客户端
@@ -235,29 +380,54 @@ func (a *FuncTcpClient) ConnectTCPClient(clientID int) types.ConnectResult {
 		}
 	}
 
-	addr := fmt.Sprintf("%s:%d", client.Host, client.Port)
-	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if _, err := NewFramer(client.Framer); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("分帧配置错误: %v", err),
+		}
+	}
+	if err := validateReconnectPolicy(client.Reconnect); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("重连配置错误: %v", err),
+		}
+	}
+	if err := validateChecksumConfig(client.Checksum); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("校验配置错误: %v", err),
+		}
+	}
+	if err := validateCharset(client.Encoding); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+
+	conn, err := a.dial(client)
 	if err != nil {
 		return types.ConnectResult{
 			Success: false,
-			Message: fmt.Sprintf("连接失败: %v", err),
+			Message: err.Error(),
 		}
 	}
 
 	a.mu.Lock()
 	a.Connections[client.ID] = conn
-	a.mu.Unlock()
-
 	if client.RepeatSend {
 		// 创建读取任务
 		a.ClientReadTasks[client.ID] = &ClientReadTask{
 			conn: conn,
 			done: make(chan bool, 1),
 		}
-		go a.handleTCPConnectionTask(client.ID) // 启动处理连接的 goroutine
+	}
+	a.mu.Unlock()
 
+	if client.RepeatSend {
+		go a.handleTCPConnectionTask(client) // 启动处理连接的 goroutine
 	} else {
-		go a.handleTCPConnection(client.ID, conn) // 启动处理连接的 goroutine
+		go a.handleTCPConnection(client, conn) // 启动处理连接的 goroutine
 	}
 
 	return types.ConnectResult{
@@ -266,6 +436,27 @@ func (a *FuncTcpClient) ConnectTCPClient(clientID int) types.ConnectResult {
 	}
 }
 
+// emitTLSHandshake 记录并推送 TLS 握手结果
+func (a *FuncTcpClient) emitTLSHandshake(clientID int, state tls.ConnectionState) {
+	content := describeTLSState(state)
+	if err := models.AddMessage(a.Db, clientID, []byte(content), "tls", "text", "utf-8", "system"); err != nil {
+		logError(a.Events, fmt.Sprintf("添加消息失败: %v", err))
+	}
+	emitEvent(a.Events, "client_event", types.ServerEvent{
+		Type:     "tls_handshake",
+		ServerId: clientID,
+		Message: &types.Message{
+			ID:            clientID,
+			Content:       content,
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "system",
+			InputMethod:   "tls",
+			DisplayMethod: "text",
+			Encoding:      "utf-8",
+		},
+	})
+}
+
 func (a *FuncTcpClient) GetTCPClientStatus(clientID int) types.ConnectResult {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -345,6 +536,15 @@ func (a *FuncTcpClient) DisconnectTCPClient(clientId int) types.ConnectResult {
 		}
 	}
 
+	if stop, exists := a.Reconnecting[clientId]; exists {
+		close(stop)
+		delete(a.Reconnecting, clientId)
+		return types.ConnectResult{
+			Success: true,
+			Message: "已停止重连",
+		}
+	}
+
 	conn, exists := a.Connections[clientId]
 	if !exists {
 		return types.ConnectResult{
@@ -381,14 +581,22 @@ func (a *FuncTcpClient) SendMessage(clientID int, message string, inputMethod st
 		}
 	}
 
-	buf := bytes.NewBuffer(nil)
-	if inputMethod == "hex" {
-		buf.WriteString(hex.EncodeToString([]byte(message)))
-	} else {
-		buf.WriteString(message)
+	client, err := models.GetServerClientData(a.Db, clientID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端数据失败: %v", err),
+		}
+	}
+	payload, err := encodeOutgoing(fmt.Sprintf("tcp-client:%d", clientID), message, inputMethod, client.Encoding, client.Checksum)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("数据格式错误: %v", err),
+		}
 	}
 
-	_, err := conn.Write(buf.Bytes())
+	_, err = conn.Write(payload)
 	if err != nil {
 		return types.ConnectResult{
 			Success: false,
@@ -396,8 +604,8 @@ func (a *FuncTcpClient) SendMessage(clientID int, message string, inputMethod st
 		}
 	}
 
-	if err := models.AddMessage(a.Db, clientID, message, inputMethod, "text", "utf-8", "outgoing"); err != nil {
-		runtime.LogError(a.Ctx, fmt.Sprintf("添加消息失败: %v", err))
+	if err := models.AddMessage(a.Db, clientID, payload, inputMethod, detectDisplayMethodCharset(payload, client.Encoding), normalizeCharset(client.Encoding), "outgoing"); err != nil {
+		logError(a.Events, fmt.Sprintf("添加消息失败: %v", err))
 	}
 
 	return types.ConnectResult{
@@ -406,72 +614,93 @@ func (a *FuncTcpClient) SendMessage(clientID int, message string, inputMethod st
 	}
 }
 
-// SendScheduledMessage 定时发送消息到 TCP 连接
+// SendScheduledMessage 按毫秒间隔定时发送消息到 TCP 连接，内容中的 {{counter}} 替换为发送计数
 func (a *FuncTcpClient) SendScheduledMessage(clientID int, message string, inputMethod string, interval int) types.ConnectResult {
+	client, err := models.GetServerClientData(a.Db, clientID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端数据失败: %v", err),
+		}
+	}
+	steps, err := compileSequence(types.SendSequence{
+		Steps: []types.SequenceStep{{Content: message, InputMethod: inputMethod, DelayMs: interval}},
+	}, client.Encoding)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("数据格式错误: %v", err),
+		}
+	}
+	return a.startSchedule(client, steps, 0)
+}
+
+// SendScheduledSequence 保存客户端的发送序列并开始按序列定时发送
+func (a *FuncTcpClient) SendScheduledSequence(clientID int, sequence types.SendSequence) types.ConnectResult {
+	client, err := models.GetServerClientData(a.Db, clientID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端数据失败: %v", err),
+		}
+	}
+	steps, err := compileSequence(sequence, client.Encoding)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("发送序列错误: %v", err),
+		}
+	}
+
+	client.Sequence = sequence
+	if err := models.UpdateServerClient(a.Db, client); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("保存发送序列失败: %v", err),
+		}
+	}
+	return a.startSchedule(client, steps, sequence.Loop)
+}
+
+// startSchedule 启动定时发送任务，已有任务时先停止
+func (a *FuncTcpClient) startSchedule(client types.ServerClient, steps []sendStep, loop int) types.ConnectResult {
+	clientID := client.ID
 	a.mu.Lock()
-	_, exists := a.Connections[clientID]
-	if !exists {
+	if _, exists := a.Connections[clientID]; !exists {
 		a.mu.Unlock()
 		return types.ConnectResult{
 			Success: false,
 			Message: "连接不存在",
 		}
 	}
-	a.mu.Unlock()
-
-	// 创建定时器和停止通道
-	ticker := time.NewTicker(time.Duration(interval) * time.Second)
-	done := make(chan bool, 1)
-
-	// 保存定时任务
-	a.ScheduledTasks[clientID] = &ScheduledTask{
-		ticker: ticker,
-		done:   done,
+	if task, exists := a.ScheduledTasks[clientID]; exists {
+		task.done <- true
 	}
+	task := &ScheduledTask{done: make(chan bool, 1)}
+	a.ScheduledTasks[clientID] = task
+	a.mu.Unlock()
 
 	go func() {
-		for {
-			select {
-			case <-done:
-				ticker.Stop()
-				return
-			case <-ticker.C:
-				a.mu.Lock()
-				if conn, ok := a.Connections[clientID]; ok {
-					buf := bytes.NewBuffer(nil)
-					if inputMethod == "hex" {
-						buf.WriteString(hex.EncodeToString([]byte(message)))
-					} else {
-						buf.WriteString(message)
-					}
-					_, err := conn.Write(buf.Bytes())
-					if err != nil {
-						runtime.LogError(a.Ctx, fmt.Sprintf("发送消息失败: %v", err))
-						ticker.Stop()
-						delete(a.ScheduledTasks, clientID)
-					}
-					if err := models.AddMessage(a.Db, clientID, message, inputMethod, "text", "utf-8", "outgoing"); err != nil {
-						runtime.LogError(a.Ctx, fmt.Sprintf("添加消息失败: %v", err))
-					}
-					runtime.EventsEmit(a.Ctx, "client_event", types.ServerEvent{
-						Type:     "data_sent",
-						ServerId: clientID,
-						Message: &types.Message{
-							ID:            clientID,
-							Content:       message,
-							Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-							Direction:     "outgoing",
-							InputMethod:   inputMethod,
-							DisplayMethod: "text",
-							Encoding:      "utf-8",
-						},
-					})
-				} else {
-					ticker.Stop()
-					delete(a.ScheduledTasks, clientID)
-				}
-				a.mu.Unlock()
+		runSequence(steps, loop, fmt.Sprintf("tcp-client:%d", clientID), task.done, func(payload []byte, inputMethod string) bool {
+			payload, err := appendChecksum(payload, client.Checksum)
+			if err != nil {
+				logError(a.Events, fmt.Sprintf("追加校验失败: %v", err))
+				return true
 			}
+			return a.sendScheduled(client, payload, inputMethod)
+		})
+
+		a.mu.Lock()
+		finished := a.ScheduledTasks[clientID] == task
+		if finished {
+			delete(a.ScheduledTasks, clientID)
+		}
+		a.mu.Unlock()
+		if finished {
+			emitEvent(a.Events, "client_event", types.ServerEvent{
+				Type:     "schedule_finished",
+				ServerId: clientID,
+			})
 		}
 	}()
 
@@ -481,6 +710,70 @@ func (a *FuncTcpClient) SendScheduledMessage(clientID int, message string, input
 	}
 }
 
+// sendScheduled 发送一条定时消息，连接已断开且不在重连时返回 false 结束任务
+func (a *FuncTcpClient) sendScheduled(client types.ServerClient, payload []byte, inputMethod string) bool {
+	clientID := client.ID
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	conn, ok := a.Connections[clientID]
+	if !ok {
+		_, reconnecting := a.Reconnecting[clientID]
+		return reconnecting
+	}
+	if _, err := conn.Write(payload); err != nil {
+		// 连接断开后由读取协程决定是否重连，重连期间暂停发送
+		logError(a.Events, fmt.Sprintf("发送消息失败: %v", err))
+		return true
+	}
+	a.recordSent(client, payload, inputMethod)
+	return true
+}
+
+// sendRaw 将已编码的字节发送到客户端连接，用于回放等不经过模板渲染的发送
+func (a *FuncTcpClient) sendRaw(clientID int, payload []byte, inputMethod string) error {
+	client, err := models.GetServerClientData(a.Db, clientID)
+	if err != nil {
+		return fmt.Errorf("获取客户端数据失败: %v", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	conn, ok := a.Connections[clientID]
+	if !ok {
+		return errors.New("连接不存在")
+	}
+	if _, err := conn.Write(payload); err != nil {
+		return fmt.Errorf("发送失败: %v", err)
+	}
+	a.recordSent(client, payload, inputMethod)
+	return nil
+}
+
+// recordSent 记录发出的消息并推送 data_sent 事件
+func (a *FuncTcpClient) recordSent(client types.ServerClient, payload []byte, inputMethod string) {
+	clientID := client.ID
+	display := detectDisplayMethodCharset(payload, client.Encoding)
+	encoding := normalizeCharset(client.Encoding)
+	if err := models.AddMessage(a.Db, clientID, payload, inputMethod, display, encoding, "outgoing"); err != nil {
+		logError(a.Events, fmt.Sprintf("添加消息失败: %v", err))
+	}
+	emitEvent(a.Events, "client_event", types.ServerEvent{
+		Type:     "data_sent",
+		ServerId: clientID,
+		Message: &types.Message{
+			ID:            clientID,
+			Content:       renderPayloadCharset(payload, display, encoding),
+			Payload:       payload,
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "outgoing",
+			InputMethod:   inputMethod,
+			DisplayMethod: display,
+			Encoding:      encoding,
+		},
+	})
+}
+
 // StopScheduledMessage 停止定时发送消息
 func (a *FuncTcpClient) StopScheduledMessage(clientID int) types.ConnectResult {
 	a.mu.Lock()
@@ -0,0 +1,51 @@
+package control
+
+import (
+	"connectivity/models"
+	"connectivity/types"
+	"net"
+	"testing"
+)
+
+func TestUpdateTCPClientKeepsConfigs(t *testing.T) {
+	client := &FuncTcpClient{
+		Db:          openMessageDB(t),
+		Connections: make(map[int]net.Conn),
+	}
+	stored := types.ServerClient{
+		Remark:   "设备",
+		Host:     "127.0.0.1",
+		Port:     502,
+		Type:     "tcp",
+		Encoding: CharsetGBK,
+		TLS:      types.TLSConfig{Enabled: true, ServerName: "device.local", MinVersion: "1.2"},
+		Framer:   types.FramerConfig{Mode: FrameDelimiter, Delimiter: "\\r\\n", DelimiterInput: "escape"},
+	}
+	if err := models.AddServerClient(client.Db, stored); err != nil {
+		t.Fatal(err)
+	}
+
+	// 编辑表单只提交基本信息
+	if resp := client.UpdateTCPClient(types.ServerClient{ID: 1, Remark: "新备注", Host: "127.0.0.2", Port: 503, Type: "tcp", Status: "offline"}); !resp.Success {
+		t.Fatal(resp.Message)
+	}
+	updated, err := models.FindServerClientOne(client.Db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Remark != "新备注" || updated.Host != "127.0.0.2" || updated.Port != 503 {
+		t.Fatalf("基本信息未更新: %+v", updated)
+	}
+	if updated.TLS != stored.TLS || updated.Framer != stored.Framer || updated.Encoding != CharsetGBK {
+		t.Fatalf("配置被清空: %+v", updated)
+	}
+
+	// 显式提交的配置会覆盖已保存的值
+	updated.Framer = types.FramerConfig{Mode: FrameFixed, FixedLength: 8}
+	if resp := client.UpdateTCPClient(updated); !resp.Success {
+		t.Fatal(resp.Message)
+	}
+	if current, _ := models.FindServerClientOne(client.Db, 1); current.Framer != updated.Framer || current.TLS != stored.TLS {
+		t.Fatalf("current = %+v", current)
+	}
+}
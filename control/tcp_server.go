@@ -4,6 +4,7 @@ import (
 	"connectivity/models"
 	"connectivity/types"
 	"context"
+	"crypto/tls"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -13,15 +14,14 @@ import (
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 type FuncTcpServer struct {
 	mu      sync.Mutex
 	Servers map[int]NetListener
-	Conn    map[string]ServerConn
+	Conn    map[int]ServerConn // 以 server_conn.conn_id 为键
 	Ctx     context.Context
+	Events  EventSink
 	Db      *sql.DB
 	Wg      sync.WaitGroup
 }
@@ -34,7 +34,11 @@ type NetListener struct {
 }
 
 type ServerConn struct {
-	Conn net.Conn
+	ID       int    // server_conn.conn_id
+	ServerID int    // 所属服务器
+	Host     string // 客户端 IP
+	Port     int    // 客户端端口
+	Conn     net.Conn
 }
 
 func (a *FuncTcpServer) AddTCPServer(config types.Server) types.ConnectResult {
@@ -96,6 +100,25 @@ func (a *FuncTcpServer) UpdateTCPServer(config types.Server) types.ConnectResult
 			Message: fmt.Sprintf("获取服务器失败: %v", err),
 		}
 	} else {
+		if _, err := NewFramer(config.Framer); err != nil {
+			return types.ConnectResult{
+				Success: false,
+				Message: fmt.Sprintf("分帧配置错误: %v", err),
+			}
+		}
+		if err := validateChecksumConfig(config.Checksum); err != nil {
+			return types.ConnectResult{
+				Success: false,
+				Message: fmt.Sprintf("校验配置错误: %v", err),
+			}
+		}
+		if err := validateCharset(config.Encoding); err != nil {
+			return types.ConnectResult{
+				Success: false,
+				Message: err.Error(),
+			}
+		}
+
 		if server.Host != config.Host || server.Port != config.Port {
 			// 检查是否有相同的 Host 和 Port 的服务器
 			servers, _ := models.GetAllServers(a.Db, "tcp")
@@ -115,6 +138,10 @@ func (a *FuncTcpServer) UpdateTCPServer(config types.Server) types.ConnectResult
 		server.Remark = config.Remark
 		server.Host = config.Host
 		server.Port = config.Port
+		server.TLS = config.TLS
+		server.Framer = config.Framer
+		server.Checksum = config.Checksum
+		server.Encoding = config.Encoding
 		server.Status = "stopped"
 	}
 
@@ -151,6 +178,8 @@ func (a *FuncTcpServer) DeleteTCPServer(id int) types.ConnectResult {
 			Message: fmt.Sprintf("删除服务器失败: %v", err),
 		}
 	}
+	autoReplyRules.invalidate()
+	scripts.invalidate()
 	return types.ConnectResult{
 		Success: true,
 		Message: "删除服务器成功",
@@ -174,7 +203,37 @@ func (a *FuncTcpServer) StartTCPServer(id int) types.ConnectResult {
 		}
 	}
 
-	addr := fmt.Sprintf("%s:%d", config.Host, config.Port)
+	var tlsConfig *tls.Config
+	if config.TLS.Enabled {
+		tlsConfig, err = buildServerTLSConfig(config.TLS)
+		if err != nil {
+			return types.ConnectResult{
+				Success: false,
+				Message: fmt.Sprintf("TLS 配置错误: %v", err),
+			}
+		}
+	}
+
+	if _, err := NewFramer(config.Framer); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("分帧配置错误: %v", err),
+		}
+	}
+	if err := validateChecksumConfig(config.Checksum); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("校验配置错误: %v", err),
+		}
+	}
+	if err := validateCharset(config.Encoding); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+
+	addr := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		if strings.Contains(err.Error(), "address already in use") {
@@ -208,6 +267,10 @@ func (a *FuncTcpServer) StartTCPServer(id int) types.ConnectResult {
 		}
 	}
 
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
 	a.mu.Lock()
 	ctx, cancel := context.WithCancel(context.Background())
 	a.Servers[config.ID] = NetListener{
@@ -246,7 +309,7 @@ func (a *FuncTcpServer) acceptConnections(ctx context.Context, config types.Serv
 			conn, err := listener.Accept()
 			if err != nil {
 				if !isClosedError(err) {
-					runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
+					emitEvent(a.Events, "server_event", types.ServerEvent{
 						Type:     "error",
 						ServerId: config.ID,
 						Message: &types.Message{
@@ -263,27 +326,32 @@ func (a *FuncTcpServer) acceptConnections(ctx context.Context, config types.Serv
 				return
 			}
 
-			a.mu.Lock()
-			// 获取连接的key,客户端的 IP，端口
-			connKey := fmt.Sprintf("%d:%d", config.ID, conn.RemoteAddr().(*net.TCPAddr).Port)
-			fmt.Println(connKey)
-			a.Conn[connKey] = ServerConn{
-				Conn: conn,
-			}
-
-			if err := models.InsertServerConn(a.Db, config.ID, "connected", conn.RemoteAddr().(*net.TCPAddr).IP.String(), conn.RemoteAddr().(*net.TCPAddr).Port); err != nil {
+			// 以 server_conn 记录的 conn_id 标识连接，客户端 IP 和端口作为属性
+			remote := conn.RemoteAddr().(*net.TCPAddr)
+			connID, err := models.InsertServerConn(a.Db, config.ID, "connected", remote.IP.String(), remote.Port)
+			if err != nil {
 				conn.Close()
 				continue
 			}
 
+			a.mu.Lock()
+			a.Conn[connID] = ServerConn{
+				ID:       connID,
+				ServerID: config.ID,
+				Host:     remote.IP.String(),
+				Port:     remote.Port,
+				Conn:     conn,
+			}
 			a.mu.Unlock()
 			a.Wg.Add(1)
-			go a.handleTCPConnection(ctx, config.ID, conn)
-			runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
+			go a.handleTCPConnection(ctx, config, connID, conn)
+			emitEvent(a.Events, "server_event", types.ServerEvent{
 				Type:     "connection_status",
 				ServerId: config.ID,
 				Message: &types.Message{
-					Content: "连接已建立",
+					ServerID: int64(config.ID),
+					ConnID:   strconv.Itoa(connID),
+					Content:  "连接已建立",
 				},
 			})
 		}
@@ -336,7 +404,6 @@ func isClosedError(err error) bool {
 func (a *FuncTcpServer) StopTCPServer(serverID int) types.ConnectResult {
 	a.mu.Lock()
 	defer a.mu.Unlock()
-	fmt.Println(serverID, a.Servers)
 	server, exists := a.Servers[serverID]
 	if !exists {
 		return types.ConnectResult{
@@ -344,7 +411,6 @@ func (a *FuncTcpServer) StopTCPServer(serverID int) types.ConnectResult {
 			Message: fmt.Sprintf("服务器未运行: %d", serverID),
 		}
 	}
-	fmt.Println(server)
 	server.Cancel()
 
 	// 关闭监听器
@@ -356,16 +422,17 @@ func (a *FuncTcpServer) StopTCPServer(serverID int) types.ConnectResult {
 	}
 
 	// 取消并移除所有与该服务器相关的连接
-	for key, conn := range a.Conn {
-		// 假设连接的 key 包含 serverID，可以根据实际情况调整判断条件
-		if strings.HasPrefix(key, fmt.Sprintf("%d:", serverID)) {
+	for connID, conn := range a.Conn {
+		if conn.ServerID == serverID {
 			conn.Conn.Close()
-			delete(a.Conn, key)
+			delete(a.Conn, connID)
 		}
 	}
 
-	// 等待所有相关的 goroutine 完成
+	// 等待所有相关的 goroutine 完成，连接处理结束时需要获取锁
+	a.mu.Unlock()
 	a.Wg.Wait()
+	a.mu.Lock()
 
 	// 从服务器列表中删除
 	delete(a.Servers, serverID)
@@ -388,7 +455,7 @@ func (a *FuncTcpServer) StopTCPServer(serverID int) types.ConnectResult {
 	}
 
 	// 发射服务器停止事件
-	runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
+	emitEvent(a.Events, "server_event", types.ServerEvent{
 		Type:     "server_stopped",
 		ServerId: serverID,
 		Message: &types.Message{
@@ -409,19 +476,19 @@ func (a *FuncTcpServer) StopTCPServer(serverID int) types.ConnectResult {
 }
 
 // handleTCPConnection 处理 TCP 连接
-func (a *FuncTcpServer) handleTCPConnection(ctx context.Context, serverID int, conn net.Conn) {
+func (a *FuncTcpServer) handleTCPConnection(ctx context.Context, server types.Server, connID int, conn net.Conn) {
+	serverID := server.ID
 	defer func() {
 		conn.Close()
 		a.Wg.Done()
 		// 从连接映射中删除连接
 		a.mu.Lock()
-		connKey := fmt.Sprintf("%d:%d", serverID, conn.RemoteAddr().(*net.TCPAddr).Port)
-		delete(a.Conn, connKey)
+		delete(a.Conn, connID)
 		a.mu.Unlock()
 
 		// 更新数据库中的连接状态
-		if err := models.UpdateServerConnStatus(a.Db, serverID, conn.RemoteAddr().(*net.TCPAddr).Port, "disconnected"); err != nil {
-			runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
+		if err := models.UpdateServerConn(a.Db, serverID, connID, "disconnected"); err != nil {
+			emitEvent(a.Events, "server_event", types.ServerEvent{
 				Type:     "error",
 				ServerId: serverID,
 				Message: &types.Message{
@@ -437,71 +504,172 @@ func (a *FuncTcpServer) handleTCPConnection(ctx context.Context, serverID int, c
 		}
 	}()
 
-	buffer := make([]byte, 1024)
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if !a.handshakeTLS(serverID, connID, tlsConn) {
+			return
+		}
+	}
 
-	for {
+	// 服务器停止时关闭连接以结束读取
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
 		select {
 		case <-ctx.Done():
-			return
-		default:
-			n, err := conn.Read(buffer)
-			if err != nil {
-				if err == io.EOF {
-					// 客户端主动断开连接
-					runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
-						Type:     "connection_closed",
-						ServerId: serverID,
-						Message: &types.Message{
-							ID:            serverID,
-							Content:       "客户端已断开连接",
-							Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-							Direction:     "system",
-							InputMethod:   "tcp",
-							DisplayMethod: "text",
-							Encoding:      "utf-8",
-						},
-					})
-				} else {
-					// 其他读取错误
-					runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
-						Type:     "error",
-						ServerId: serverID,
-						Message: &types.Message{
-							ID:            serverID,
-							Content:       fmt.Sprintf("读取数据错误: %v", err),
-							Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-							Direction:     "incoming",
-							InputMethod:   "tcp",
-							DisplayMethod: "text",
-							Encoding:      "utf-8",
-						},
-					})
-				}
-				return
-			}
+			conn.Close()
+		case <-done:
+		}
+	}()
 
-			if n > 0 {
-				data := buffer[:n]
-				connID := fmt.Sprintf("%d:%d", serverID, conn.RemoteAddr().(*net.TCPAddr).Port)
-				models.AddMessageServer(a.Db, serverID, connID, string(data), "tcp", "text", "utf-8", "incoming")
-				runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
-					Type:     "data_received",
-					ServerId: serverID,
-					Message: &types.Message{
-						ServerID:      int64(serverID),
-						ConnID:        strconv.Itoa(conn.RemoteAddr().(*net.TCPAddr).Port),
-						Content:       string(data),
-						Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-						Direction:     "incoming",
-						InputMethod:   "tcp",
-						DisplayMethod: "text",
-						Encoding:      "utf-8",
-					},
-				})
-				buffer = make([]byte, 1024)
+	script := newScriptSession(a.Db, ScriptServer, serverID, scriptHost{
+		send: func(data []byte) error {
+			if _, err := conn.Write(data); err != nil {
+				return err
 			}
+			a.recordSent(serverID, connID, data, "script", server.Encoding)
+			return nil
+		},
+		close:   func() { go a.DisconnectClient(serverID, connID) },
+		log:     scriptLogger(a.Events, "server_event", serverID, connID),
+		charset: server.Encoding,
+	})
+	defer script.stop()
+	script.onConnect()
+
+	session := newAutoReplySession(server)
+	err := readFrames(conn, server.Framer, func(data []byte) {
+		display := detectDisplayMethodCharset(data, server.Encoding)
+		verdict := verifyChecksum(data, server.Checksum)
+		models.AddMessageServerWithChecksum(a.Db, serverID, connID, data, "tcp", display, normalizeCharset(server.Encoding), "incoming", verdict)
+		emitEvent(a.Events, "server_event", types.ServerEvent{
+			Type:     "data_received",
+			ServerId: serverID,
+			Message: &types.Message{
+				ServerID:      int64(serverID),
+				ConnID:        strconv.Itoa(connID),
+				Content:       renderPayloadCharset(data, display, server.Encoding),
+				Payload:       data,
+				Length:        len(data),
+				Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+				Direction:     "incoming",
+				InputMethod:   "tcp",
+				DisplayMethod: display,
+				Encoding:      normalizeCharset(server.Encoding),
+				Checksum:      verdict,
+			},
+		})
+		a.autoReply(session, serverID, connID, conn, data)
+		script.onData(data)
+	})
+	if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+		// 服务器停止或服务端主动断开，已单独推送事件
+		return
+	}
+	if err == io.EOF {
+		// 客户端主动断开连接
+		emitEvent(a.Events, "server_event", types.ServerEvent{
+			Type:     "connection_closed",
+			ServerId: serverID,
+			Message: &types.Message{
+				ID:            serverID,
+				Content:       "客户端已断开连接",
+				Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+				Direction:     "system",
+				InputMethod:   "tcp",
+				DisplayMethod: "text",
+				Encoding:      "utf-8",
+			},
+		})
+	} else {
+		// 其他读取错误
+		emitEvent(a.Events, "server_event", types.ServerEvent{
+			Type:     "error",
+			ServerId: serverID,
+			Message: &types.Message{
+				ID:            serverID,
+				Content:       fmt.Sprintf("读取数据错误: %v", err),
+				Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+				Direction:     "incoming",
+				InputMethod:   "tcp",
+				DisplayMethod: "text",
+				Encoding:      "utf-8",
+			},
+		})
+	}
+}
+
+// autoReply 匹配自动应答规则，命中时向连接发送应答并记录为发出的消息
+func (a *FuncTcpServer) autoReply(session *autoReplySession, serverID int, connID int, conn net.Conn, data []byte) {
+	rule, payload, err := session.match(a.Db, data)
+	if rule == nil {
+		return
+	}
+	scheduleAutoReply(rule, func() {
+		if err == nil {
+			_, err = conn.Write(payload)
 		}
+		if err != nil {
+			emitEvent(a.Events, "server_event", types.ServerEvent{
+				Type:     "error",
+				ServerId: serverID,
+				Message: &types.Message{
+					ServerID:      int64(serverID),
+					ConnID:        strconv.Itoa(connID),
+					Content:       fmt.Sprintf("自动应答 [%s] 失败: %v", rule.Name, err),
+					Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+					Direction:     "system",
+					InputMethod:   "auto-reply",
+					DisplayMethod: "text",
+					Encoding:      "utf-8",
+				},
+			})
+			return
+		}
+
+		a.recordSent(serverID, connID, payload, "auto-reply", session.charset)
+	})
+}
+
+// handshakeTLS 完成 TLS 握手并推送握手结果，失败时返回 false
+func (a *FuncTcpServer) handshakeTLS(serverID int, connID int, conn *tls.Conn) bool {
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	err := conn.Handshake()
+	conn.SetDeadline(time.Time{})
+	if err != nil {
+		emitEvent(a.Events, "server_event", types.ServerEvent{
+			Type:     "error",
+			ServerId: serverID,
+			Message: &types.Message{
+				ServerID:      int64(serverID),
+				ConnID:        strconv.Itoa(connID),
+				Content:       fmt.Sprintf("TLS 握手失败: %v", err),
+				Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+				Direction:     "system",
+				InputMethod:   "tls",
+				DisplayMethod: "text",
+				Encoding:      "utf-8",
+			},
+		})
+		return false
 	}
+
+	content := describeTLSState(conn.ConnectionState())
+	models.AddMessageServer(a.Db, serverID, connID, []byte(content), "tls", "text", "utf-8", "system")
+	emitEvent(a.Events, "server_event", types.ServerEvent{
+		Type:     "tls_handshake",
+		ServerId: serverID,
+		Message: &types.Message{
+			ServerID:      int64(serverID),
+			ConnID:        strconv.Itoa(connID),
+			Content:       content,
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "system",
+			InputMethod:   "tls",
+			DisplayMethod: "text",
+			Encoding:      "utf-8",
+		},
+	})
+	return true
 }
 
 func (a *FuncTcpServer) GetTCPServerData(serverID int) types.ConnectResult {
@@ -521,12 +689,17 @@ func (a *FuncTcpServer) GetTCPServerData(serverID int) types.ConnectResult {
 	}
 }
 
-// 修改 SendMessage 函数，发送消息到现有连接而非接受新连接
-func (a *FuncTcpServer) SendMessage(serverID int, port int, message string) types.ConnectResult {
+// SendMessage 以文本方式发送消息到现有连接，connID 为 server_conn.conn_id
+func (a *FuncTcpServer) SendMessage(serverID int, connID int, message string) types.ConnectResult {
+	return a.SendMessageEncoded(serverID, connID, message, InputText)
+}
+
+// SendMessageEncoded 按输入方式解析消息后发送到现有连接
+func (a *FuncTcpServer) SendMessageEncoded(serverID int, connID int, message string, inputMethod string) types.ConnectResult {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	_, err := models.FindServerOne(a.Db, serverID)
+	server, err := models.FindServerOne(a.Db, serverID)
 	if err != nil {
 		return types.ConnectResult{
 			Success: false,
@@ -534,58 +707,126 @@ func (a *FuncTcpServer) SendMessage(serverID int, port int, message string) type
 		}
 	}
 
-	connID := fmt.Sprintf("%d:%d", serverID, port)
+	payload, err := encodeOutgoing(fmt.Sprintf("tcp-server:%d", connID), message, inputMethod, server.Encoding, server.Checksum)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("数据格式错误: %v", err),
+		}
+	}
 
 	conn, exists := a.Conn[connID]
-	if !exists {
+	if !exists || conn.ServerID != serverID {
 		return types.ConnectResult{
 			Success: false,
-			Message: fmt.Sprintf("连接不存在: %s", connID),
-		}
-	} else {
-		// 遍历所有连接并发送消息
-		_, err := conn.Conn.Write([]byte(message))
-		if err != nil {
-			runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
-				Type:     "error",
-				ServerId: serverID,
-				Message: &types.Message{
-					ServerID:      int64(serverID),
-					ConnID:        strconv.Itoa(port),
-					Content:       fmt.Sprintf("发送消息错误: %v", err),
-					Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-					Direction:     "outgoing",
-					InputMethod:   "tcp",
-					DisplayMethod: "text",
-					Encoding:      "utf-8",
-				},
-			})
-		} else {
-			connID := fmt.Sprintf("%d:%d", serverID, port)
-			models.AddMessageServer(a.Db, serverID, connID, message, "tcp", "text", "utf-8", "incoming")
-			runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
-				Type:     "data_sent",
-				ServerId: serverID,
-				Message: &types.Message{
-					ServerID:      int64(serverID),
-					ConnID:        strconv.Itoa(port),
-					Content:       message,
-					Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-					Direction:     "outgoing",
-					InputMethod:   "tcp",
-					DisplayMethod: "text",
-					Encoding:      "utf-8",
-				},
-			})
+			Message: fmt.Sprintf("连接不存在: %d", connID),
+		}
+	}
+
+	if _, err := conn.Conn.Write(payload); err != nil {
+		emitEvent(a.Events, "server_event", types.ServerEvent{
+			Type:     "error",
+			ServerId: serverID,
+			Message: &types.Message{
+				ServerID:      int64(serverID),
+				ConnID:        strconv.Itoa(connID),
+				Content:       fmt.Sprintf("发送消息错误: %v", err),
+				Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+				Direction:     "outgoing",
+				InputMethod:   "tcp",
+				DisplayMethod: "text",
+				Encoding:      "utf-8",
+			},
+		})
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("发送消息失败: %v", err),
 		}
 	}
 
+	a.recordSent(serverID, connID, payload, inputMethod, server.Encoding)
+
 	return types.ConnectResult{
 		Success: true,
 		Message: "发送消息成功",
 	}
 }
 
+// sendRaw 将已编码的字节发送到现有连接，用于回放等不经过模板渲染的发送
+func (a *FuncTcpServer) sendRaw(serverID int, connID int, payload []byte, inputMethod string) error {
+	server, err := models.FindServerOne(a.Db, serverID)
+	if err != nil {
+		return fmt.Errorf("获取服务器失败: %v", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	conn, exists := a.Conn[connID]
+	if !exists || conn.ServerID != serverID {
+		return fmt.Errorf("连接不存在: %d", connID)
+	}
+	if _, err := conn.Conn.Write(payload); err != nil {
+		return fmt.Errorf("发送消息失败: %v", err)
+	}
+	a.recordSent(serverID, connID, payload, inputMethod, server.Encoding)
+	return nil
+}
+
+// BroadcastMessage 向服务器的所有在线连接发送消息，filter 为逗号分隔的 IP/CIDR，为空时发送到全部连接
+func (a *FuncTcpServer) BroadcastMessage(serverID int, message string, inputMethod string, filter string) types.ConnectResult {
+	server, err := models.FindServerOne(a.Db, serverID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取服务器失败: %v", err),
+		}
+	}
+	payload, err := encodeOutgoing(fmt.Sprintf("tcp-server-broadcast:%d", serverID), message, inputMethod, server.Encoding, server.Checksum)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("数据格式错误: %v", err),
+		}
+	}
+	addrs, err := parseAddrFilter(filter)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+
+	// 先取出目标连接，写入时不持有锁
+	a.mu.Lock()
+	var targets []ServerConn
+	for _, conn := range a.Conn {
+		if conn.ServerID == serverID && addrs.match(net.ParseIP(conn.Host)) {
+			targets = append(targets, conn)
+		}
+	}
+	a.mu.Unlock()
+
+	results := make([]types.BroadcastResult, 0, len(targets))
+	for _, conn := range targets {
+		result := types.BroadcastResult{
+			ConnID: conn.ID,
+			Host:   conn.Host,
+			Port:   conn.Port,
+		}
+		conn.Conn.SetWriteDeadline(time.Now().Add(broadcastWriteTimeout))
+		_, err := conn.Conn.Write(payload)
+		conn.Conn.SetWriteDeadline(time.Time{})
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+			a.recordSent(serverID, conn.ID, payload, inputMethod, server.Encoding)
+		}
+		results = append(results, result)
+	}
+	return broadcastSummary(results)
+}
+
 // 检查连接状态
 func (a *FuncTcpServer) CheckConnectionStatus() {
 	a.mu.Lock()
@@ -597,7 +838,7 @@ func (a *FuncTcpServer) CheckConnectionStatus() {
 		serverIDMap[listener.Listener.Addr().String()] = id
 	}
 
-	for key, serverConn := range a.Conn {
+	for connID, serverConn := range a.Conn {
 		// 设置读取超时
 		serverConn.Conn.SetReadDeadline(time.Now().Add(1 * time.Second))
 		buffer := make([]byte, 1) // 创建一个小缓冲区
@@ -607,7 +848,7 @@ func (a *FuncTcpServer) CheckConnectionStatus() {
 			// 如果读取失败，连接可能已关闭
 			serverID, exists := serverIDMap[serverConn.Conn.RemoteAddr().String()]
 			if exists {
-				runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
+				emitEvent(a.Events, "server_event", types.ServerEvent{
 					Type:     "connection_status",
 					ServerId: serverID,
 					Message: &types.Message{
@@ -620,24 +861,125 @@ func (a *FuncTcpServer) CheckConnectionStatus() {
 						Encoding:      "utf-8",
 					},
 				})
-				delete(a.Conn, key) // 从连接列表中删除无效连接
+				delete(a.Conn, connID) // 从连接列表中删除无效连接
 			}
 		}
 	}
 }
 
-func (a *FuncTcpServer) DisconnectClient(serverID int, port int) types.ConnectResult {
+// 服务端断开连接方式
+const (
+	KickClose = "close" // 正常关闭 (FIN)
+	KickReset = "rst"   // SO_LINGER=0 后关闭，发送 RST
+	KickHalf  = "half"  // 半关闭，仅关闭写方向
+)
+
+// DisconnectClient 断开客户端连接
+func (a *FuncTcpServer) DisconnectClient(serverID int, connID int) types.ConnectResult {
+	return a.KickClient(serverID, connID, KickClose)
+}
 
-	_, err := models.FindServerConnOne(a.Db, serverID, port)
+// KickClient 从服务端断开客户端连接，mode 为 close/rst/half
+func (a *FuncTcpServer) KickClient(serverID int, connID int, mode string) types.ConnectResult {
+	a.mu.Lock()
+	serverConn, exists := a.Conn[connID]
+	a.mu.Unlock()
+	if !exists || serverConn.ServerID != serverID {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("连接不存在: %d", connID),
+		}
+	}
+
+	var reason string
+	var err error
+	switch mode {
+	case "", KickClose:
+		reason = "服务端关闭连接"
+		err = serverConn.Conn.Close()
+	case KickReset:
+		reason = "服务端重置连接 (RST)"
+		if tcpConn, ok := underlyingTCPConn(serverConn.Conn); ok {
+			tcpConn.SetLinger(0)
+		}
+		err = serverConn.Conn.Close()
+	case KickHalf:
+		reason = "服务端半关闭连接，停止发送"
+		switch c := serverConn.Conn.(type) {
+		case *tls.Conn:
+			err = c.CloseWrite()
+		case *net.TCPConn:
+			err = c.CloseWrite()
+		default:
+			err = errors.New("连接不支持半关闭")
+		}
+	default:
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("不支持的断开方式: %s", mode),
+		}
+	}
 	if err != nil {
 		return types.ConnectResult{
 			Success: false,
-			Message: fmt.Sprintf("获取连接失败: %v", err),
+			Message: fmt.Sprintf("断开连接失败: %v", err),
 		}
 	}
 
+	status := "disconnected"
+	if mode == KickHalf {
+		status = "half-closed"
+	}
+	models.UpdateServerConn(a.Db, serverID, connID, status)
+	emitEvent(a.Events, "server_event", types.ServerEvent{
+		Type:     "connection_closed",
+		ServerId: serverID,
+		Message: &types.Message{
+			ServerID:      int64(serverID),
+			ConnID:        strconv.Itoa(connID),
+			Content:       reason,
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "system",
+			InputMethod:   "tcp",
+			DisplayMethod: "text",
+			Encoding:      "utf-8",
+		},
+	})
+
 	return types.ConnectResult{
 		Success: true,
 		Message: "断开连接成功",
 	}
 }
+
+// underlyingTCPConn 返回连接底层的 TCP 连接，TLS 连接取其内部连接
+func underlyingTCPConn(conn net.Conn) (*net.TCPConn, bool) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	return tcpConn, ok
+}
+
+// recordSent 记录发出的消息并推送 data_sent 事件，charset 为载荷文本的字符编码
+func (a *FuncTcpServer) recordSent(serverID int, connID int, payload []byte, inputMethod string, charset string) {
+	charset = normalizeCharset(charset)
+	display := detectDisplayMethodCharset(payload, charset)
+	models.AddMessageServer(a.Db, serverID, connID, payload, inputMethod, display, charset, "outgoing")
+	emitEvent(a.Events, "server_event", types.ServerEvent{
+		Type:     "data_sent",
+		ServerId: serverID,
+		Message: &types.Message{
+			ServerID:      int64(serverID),
+			ConnID:        strconv.Itoa(connID),
+			Content:       renderPayloadCharset(payload, display, charset),
+			Payload:       payload,
+			Length:        len(payload),
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "outgoing",
+			InputMethod:   inputMethod,
+			DisplayMethod: display,
+			Encoding:      charset,
+		},
+	})
+}
@@ -59,7 +59,7 @@ func TestStartTCPServer(t *testing.T) {
 	serverStr := &FuncTcpServer{
 		Db:      initSqlite(),
 		Servers: make(map[int]NetListener),
-		Conn:    make(map[string]ServerConn),
+		Conn:    make(map[int]ServerConn),
 		Wg:      sync.WaitGroup{},
 		Ctx:     ctx,
 	}
@@ -77,3 +77,40 @@ func TestUpdateTCPServer(t *testing.T) {
 
 	fmt.Println(serverStr.UpdateTCPServer(types.Server{ID: 3, Host: "127.0.0.2", Port: 8088}))
 }
+
+func TestUpdateTCPServerConfigs(t *testing.T) {
+	serverStr := &FuncTcpServer{
+		Db:      openMessageDB(t),
+		Servers: make(map[int]NetListener),
+	}
+	if resp := serverStr.AddTCPServer(types.Server{Remark: "测试", Host: "127.0.0.1", Port: 8088, Type: "tcp"}); !resp.Success {
+		t.Fatal(resp.Message)
+	}
+	server := serverStr.GetAllTCPServers().Data.([]types.Server)[0]
+
+	server.Framer = types.FramerConfig{Mode: FrameDelimiter, Delimiter: "\\r\\n", DelimiterInput: "escape"}
+	server.Checksum = types.ChecksumConfig{Algorithm: ChecksumCRC16Modbus, Append: true}
+	server.Encoding = CharsetGBK
+	if resp := serverStr.UpdateTCPServer(server); !resp.Success {
+		t.Fatal(resp.Message)
+	}
+	updated := serverStr.GetAllTCPServers().Data.([]types.Server)[0]
+	if updated.Framer != server.Framer || updated.Checksum != server.Checksum || updated.Encoding != CharsetGBK {
+		t.Fatalf("updated = %+v", updated)
+	}
+
+	// 非法配置不会写入
+	invalid := updated
+	invalid.Checksum.Algorithm = "md5"
+	if resp := serverStr.UpdateTCPServer(invalid); resp.Success {
+		t.Fatal("非法校验算法应更新失败")
+	}
+	invalid = updated
+	invalid.Encoding = "ebcdic"
+	if resp := serverStr.UpdateTCPServer(invalid); resp.Success {
+		t.Fatal("非法字符编码应更新失败")
+	}
+	if current := serverStr.GetAllTCPServers().Data.([]types.Server)[0]; current.Checksum != server.Checksum || current.Encoding != CharsetGBK {
+		t.Fatalf("current = %+v", current)
+	}
+}
@@ -0,0 +1,206 @@
+package control
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// templatePlaceholder 载荷模板占位符，如 {{seq}}、{{random_hex:8}}、{{len:be16}}
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*([a-z0-9_]+)(?::([^{}]*))?\s*\}\}`)
+
+// templateContext 模板求值时使用的计数
+type templateContext struct {
+	Seq     int    // 发送目标的累计发送序号
+	Counter int    // 定时任务内的发送计数
+	Charset string // 文本输入的字符编码，为空时为 utf-8
+}
+
+// renderTemplate 渲染载荷模板。值占位符先按文本替换再按输入方式编码；
+// 字节占位符在编码后写入: {{len:be16}} 为其后剩余字节数，{{crc16_modbus}}、{{crc32:le}} 等校验算法占位符为其前全部字节的校验
+//
+// 值占位符:
+//
+//	{{seq}} {{seq:x4}}         发送序号，x4 表示补零到 4 位的十六进制
+//	{{counter}} {{counter:x2}} 定时任务内的发送计数
+//	{{timestamp_ms}}           Unix 毫秒时间戳
+//	{{random_hex:8}}           8 位随机十六进制字符
+//	{{uuid}}                   随机 UUID
+func renderTemplate(input string, inputMethod string, ctx templateContext) ([]byte, error) {
+	if !strings.Contains(input, "{{") {
+		return encodePayloadCharset(input, inputMethod, ctx.Charset)
+	}
+
+	var expandErr error
+	expanded := templatePlaceholder.ReplaceAllStringFunc(input, func(match string) string {
+		sub := templatePlaceholder.FindStringSubmatch(match)
+		if _, ok := fieldSize(sub[1], sub[2]); ok {
+			return match
+		}
+		value, err := expandValue(sub[1], sub[2], ctx)
+		if err != nil && expandErr == nil {
+			expandErr = err
+		}
+		return value
+	})
+	if expandErr != nil {
+		return nil, expandErr
+	}
+
+	type field struct {
+		name, arg    string
+		offset, size int
+	}
+	var out []byte
+	var fields []field
+	last := 0
+	for _, loc := range templatePlaceholder.FindAllStringSubmatchIndex(expanded, -1) {
+		literal, err := encodePayloadCharset(expanded[last:loc[0]], inputMethod, ctx.Charset)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, literal...)
+
+		f := field{name: expanded[loc[2]:loc[3]], offset: len(out)}
+		if loc[4] >= 0 {
+			f.arg = expanded[loc[4]:loc[5]]
+		}
+		size, ok := fieldSize(f.name, f.arg)
+		if !ok {
+			return nil, fmt.Errorf("不支持的占位符: %s", expanded[loc[0]:loc[1]])
+		}
+		f.size = size
+		out = append(out, make([]byte, size)...)
+		fields = append(fields, f)
+		last = loc[1]
+	}
+	tail, err := encodePayloadCharset(expanded[last:], inputMethod, ctx.Charset)
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, tail...)
+
+	// 先填长度字段，再从左到右计算校验，使校验覆盖已填好的长度
+	for _, f := range fields {
+		if f.name != "len" {
+			continue
+		}
+		n := len(out) - f.offset - f.size
+		if f.size < 8 && uint64(n) >= 1<<(8*f.size) {
+			return nil, fmt.Errorf("长度 %d 超出 {{len:%s}} 的范围", n, f.arg)
+		}
+		putUint(out[f.offset:f.offset+f.size], uint64(n), strings.HasPrefix(f.arg, "le"))
+	}
+	for _, f := range fields {
+		if f.name == "len" {
+			continue
+		}
+		sum, err := checksumBytes(f.name, f.arg, out[:f.offset])
+		if err != nil {
+			return nil, err
+		}
+		copy(out[f.offset:], sum)
+	}
+	return out, nil
+}
+
+// fieldSize 返回字节占位符的长度，非字节占位符返回 false
+func fieldSize(name string, arg string) (int, bool) {
+	if alg, ok := checksumAlgorithms[name]; ok {
+		return alg.size, true
+	}
+	switch name {
+	case "len":
+		switch arg {
+		case "u8":
+			return 1, true
+		case "be16", "le16":
+			return 2, true
+		case "be32", "le32":
+			return 4, true
+		}
+	}
+	return 0, false
+}
+
+func expandValue(name string, arg string, ctx templateContext) (string, error) {
+	switch name {
+	case "seq":
+		return formatCount(ctx.Seq, arg)
+	case "counter":
+		return formatCount(ctx.Counter, arg)
+	case "timestamp_ms":
+		return strconv.FormatInt(time.Now().UnixMilli(), 10), nil
+	case "random_hex":
+		n := 8
+		if arg != "" {
+			var err error
+			if n, err = strconv.Atoi(arg); err != nil || n <= 0 || n > 1024 {
+				return "", fmt.Errorf("{{random_hex:%s}} 长度无效", arg)
+			}
+		}
+		buf := make([]byte, (n+1)/2)
+		rand.Read(buf)
+		return strings.ToUpper(hex.EncodeToString(buf))[:n], nil
+	case "uuid":
+		var u [16]byte
+		rand.Read(u[:])
+		u[6] = u[6]&0x0f | 0x40
+		u[8] = u[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+	}
+	if arg != "" {
+		return "", fmt.Errorf("不支持的占位符: {{%s:%s}}", name, arg)
+	}
+	return "", fmt.Errorf("不支持的占位符: {{%s}}", name)
+}
+
+// formatCount 格式化计数，xN 表示补零到 N 位的十六进制，超出位数时取模回绕
+func formatCount(count int, arg string) (string, error) {
+	if arg == "" {
+		return strconv.Itoa(count), nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(arg, "x"))
+	if !strings.HasPrefix(arg, "x") || err != nil || n <= 0 || n > 16 {
+		return "", fmt.Errorf("计数格式无效: %s", arg)
+	}
+	s := fmt.Sprintf("%0*X", n, count)
+	return s[len(s)-n:], nil
+}
+
+func putUint(b []byte, v uint64, little bool) {
+	for i := range b {
+		shift := 8 * uint(i)
+		if little {
+			b[i] = byte(v >> shift)
+		} else {
+			b[len(b)-1-i] = byte(v >> shift)
+		}
+	}
+}
+
+// sendSeq 按发送目标累计发送序号，{{seq}} 从 1 开始
+type sendSeq struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+var payloadSeq = &sendSeq{counts: make(map[string]int)}
+
+func (s *sendSeq) next(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[key]++
+	return s.counts[key]
+}
+
+// renderPayload 渲染发送目标的下一条载荷，文本按 charset 编码
+func renderPayload(key string, message string, inputMethod string, charset string) ([]byte, error) {
+	seq := payloadSeq.next(key)
+	return renderTemplate(message, inputMethod, templateContext{Seq: seq, Counter: seq, Charset: charset})
+}
@@ -0,0 +1,86 @@
+package control
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestRenderTemplateFields(t *testing.T) {
+	// Modbus 读保持寄存器请求: 01 03 00 00 00 0A C5 CD
+	got, err := renderTemplate("01 03 00 00 00 0A {{crc16_modbus}}", InputHex, templateContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A, 0xC5, 0xCD}; !bytes.Equal(got, want) {
+		t.Fatalf("crc: % X", got)
+	}
+
+	// 长度字段覆盖其后的全部字节，包括校验
+	got, err = renderTemplate("AA {{len:be16}} {{seq:x2}} 01 02 {{crc16_modbus}}", InputHex, templateContext{Seq: 0x1ff})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got[:6], []byte{0xAA, 0x00, 0x05, 0xFF, 0x01, 0x02}) || len(got) != 8 {
+		t.Fatalf("len: % X", got)
+	}
+	crc := crc16Modbus(got[:6])
+	if got[6] != byte(crc) || got[7] != byte(crc>>8) {
+		t.Fatalf("crc: % X", got)
+	}
+
+	got, err = renderTemplate("{{len:le32}}abc", InputText, templateContext{})
+	if err != nil || !bytes.Equal(got, []byte{3, 0, 0, 0, 'a', 'b', 'c'}) {
+		t.Fatalf("le32: % X %v", got, err)
+	}
+
+	if _, err := renderTemplate("{{len:u8}}"+string(make([]byte, 256)), InputText, templateContext{}); err == nil {
+		t.Fatal("长度超出范围应报错")
+	}
+}
+
+func TestRenderTemplateValues(t *testing.T) {
+	got, err := renderTemplate("seq={{seq}} n={{counter:x4}} t={{timestamp_ms}}", InputText, templateContext{Seq: 7, Counter: 255})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^seq=7 n=00FF t=\d{13}$`).Match(got) {
+		t.Fatalf("got %q", got)
+	}
+
+	got, err = renderTemplate("{{random_hex:6}}|{{uuid}}", InputText, templateContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[0-9A-F]{6}\|[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).Match(got) {
+		t.Fatalf("got %q", got)
+	}
+
+	// 十六进制输入中的值占位符按十六进制解析
+	got, err = renderTemplate("{{uuid}}", InputHex, templateContext{})
+	if err != nil || len(got) != 16 {
+		t.Fatalf("uuid hex: % X %v", got, err)
+	}
+
+	for _, input := range []string{"{{unknown}}", "{{seq:d4}}", "{{len:be24}}", "{{random_hex:0}}"} {
+		if _, err := renderTemplate(input, InputText, templateContext{}); err == nil {
+			t.Fatalf("%s 应报错", input)
+		}
+	}
+}
+
+func TestRenderPayloadSeq(t *testing.T) {
+	for i := 1; i <= 3; i++ {
+		got, err := renderPayload("test-seq", "{{seq}}", InputText, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != strconv.Itoa(i) {
+			t.Fatalf("seq %d: %q", i, got)
+		}
+	}
+	if got, _ := renderPayload("test-seq-other", "{{seq}}", InputText, ""); string(got) != "1" {
+		t.Fatalf("不同目标的序号应独立: %q", got)
+	}
+}
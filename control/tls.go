@@ -0,0 +1,262 @@
+package control
+
+import (
+	"connectivity/types"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// FuncCert 证书管理
+type FuncCert struct {
+	Ctx context.Context
+}
+
+// CertInfo 证书摘要信息
+type CertInfo struct {
+	Subject   string   `json:"subject"`
+	Issuer    string   `json:"issuer"`
+	NotBefore string   `json:"not_before"`
+	NotAfter  string   `json:"not_after"`
+	DNSNames  []string `json:"dns_names"`
+	IPs       []string `json:"ips"`
+	IsCA      bool     `json:"is_ca"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	v, ok := tlsVersions[version]
+	if !ok {
+		return 0, fmt.Errorf("不支持的 TLS 版本: %s", version)
+	}
+	return v, nil
+}
+
+// applyTLSCommon 设置客户端与服务端共用的 TLS 参数
+func applyTLSCommon(cfg *tls.Config, config types.TLSConfig) error {
+	var err error
+	if cfg.MinVersion, err = parseTLSVersion(config.MinVersion); err != nil {
+		return err
+	}
+	if cfg.MaxVersion, err = parseTLSVersion(config.MaxVersion); err != nil {
+		return err
+	}
+	if cfg.MinVersion != 0 && cfg.MaxVersion != 0 && cfg.MinVersion > cfg.MaxVersion {
+		return errors.New("TLS 最低版本不能高于最高版本")
+	}
+	if config.CertPEM != "" || config.KeyPEM != "" {
+		cert, err := tls.X509KeyPair([]byte(config.CertPEM), []byte(config.KeyPEM))
+		if err != nil {
+			return fmt.Errorf("加载证书失败: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return nil
+}
+
+func loadCertPool(caPEM string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+		return nil, errors.New("加载 CA 证书失败")
+	}
+	return pool, nil
+}
+
+// buildClientTLSConfig 根据客户端配置生成 tls.Config
+func buildClientTLSConfig(config types.TLSConfig, host string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	if err := applyTLSCommon(cfg, config); err != nil {
+		return nil, err
+	}
+	if config.CAPEM != "" {
+		pool, err := loadCertPool(config.CAPEM)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// buildServerTLSConfig 根据服务端配置生成 tls.Config
+func buildServerTLSConfig(config types.TLSConfig) (*tls.Config, error) {
+	if config.CertPEM == "" || config.KeyPEM == "" {
+		return nil, errors.New("服务端 TLS 需要证书和私钥")
+	}
+	cfg := &tls.Config{}
+	if err := applyTLSCommon(cfg, config); err != nil {
+		return nil, err
+	}
+	if config.ClientAuth {
+		cfg.ClientAuth = tls.RequireAnyClientCert
+		if config.CAPEM != "" {
+			pool, err := loadCertPool(config.CAPEM)
+			if err != nil {
+				return nil, err
+			}
+			cfg.ClientCAs = pool
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return cfg, nil
+}
+
+// describeTLSState 描述握手结果：协商版本、加密套件以及对端证书链
+func describeTLSState(state tls.ConnectionState) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "TLS 握手成功: 版本=%s, 加密套件=%s", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	if state.ServerName != "" {
+		fmt.Fprintf(&b, ", SNI=%s", state.ServerName)
+	}
+	if state.NegotiatedProtocol != "" {
+		fmt.Fprintf(&b, ", ALPN=%s", state.NegotiatedProtocol)
+	}
+	for i, cert := range state.PeerCertificates {
+		fmt.Fprintf(&b, "\n[%d] subject=%s issuer=%s notAfter=%s", i, cert.Subject.String(), cert.Issuer.String(), cert.NotAfter.Format("2006-01-02 15:04:05"))
+	}
+	return b.String()
+}
+
+// GenerateSelfSignedCert 生成自签名证书，hosts 为逗号分隔的域名或 IP，返回 PEM 格式证书和私钥
+func (c *FuncCert) GenerateSelfSignedCert(commonName string, hosts string, validDays int) types.ConnectResult {
+	certPEM, keyPEM, err := generateSelfSignedCert(commonName, hosts, validDays)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("生成证书失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "生成证书成功",
+		Data: map[string]string{
+			"cert_pem": certPEM,
+			"key_pem":  keyPEM,
+		},
+	}
+}
+
+// ParseCertificate 解析 PEM 证书，返回证书摘要
+func (c *FuncCert) ParseCertificate(certPEM string) types.ConnectResult {
+	var infos []CertInfo
+	rest := []byte(certPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return types.ConnectResult{
+				Success: false,
+				Message: fmt.Sprintf("解析证书失败: %v", err),
+			}
+		}
+		info := CertInfo{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			NotBefore: cert.NotBefore.Format("2006-01-02 15:04:05"),
+			NotAfter:  cert.NotAfter.Format("2006-01-02 15:04:05"),
+			DNSNames:  cert.DNSNames,
+			IsCA:      cert.IsCA,
+		}
+		for _, ip := range cert.IPAddresses {
+			info.IPs = append(info.IPs, ip.String())
+		}
+		infos = append(infos, info)
+	}
+	if len(infos) == 0 {
+		return types.ConnectResult{
+			Success: false,
+			Message: "未找到证书",
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "解析证书成功",
+		Data:    infos,
+	}
+}
+
+func generateSelfSignedCert(commonName string, hosts string, validDays int) (string, string, error) {
+	if commonName == "" {
+		commonName = "localhost"
+	}
+	if validDays <= 0 {
+		validDays = 365
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+	notBefore := time.Now().Add(-time.Hour)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(time.Duration(validDays) * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	seen := make(map[string]bool)
+	for _, h := range strings.Split(hosts+","+commonName, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" || seen[h] {
+			continue
+		}
+		seen[h] = true
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM), nil
+}
@@ -0,0 +1,45 @@
+package control
+
+import (
+	"connectivity/types"
+	"crypto/tls"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSelfSignedCertHandshake(t *testing.T) {
+	certPEM, keyPEM, err := generateSelfSignedCert("localhost", "127.0.0.1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig, err := buildServerTLSConfig(types.TLSConfig{CertPEM: certPEM, KeyPEM: keyPEM, MinVersion: "1.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConfig, err := buildClientTLSConfig(types.TLSConfig{CAPEM: certPEM}, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c1, c2 := net.Pipe()
+	server := tls.Server(c1, serverConfig)
+	client := tls.Client(c2, clientConfig)
+	defer c1.Close()
+	defer c2.Close()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- server.Handshake() }()
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	desc := describeTLSState(client.ConnectionState())
+	if !strings.Contains(desc, "CN=localhost") {
+		t.Fatalf("握手描述缺少对端证书: %s", desc)
+	}
+}
@@ -1,19 +1,16 @@
 package control
 
 import (
-	"bytes"
 	"connectivity/models"
 	"connectivity/types"
 	"context"
 	"database/sql"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"sync"
 	"time"
-
-	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 type FuncUdpClient struct {
@@ -21,15 +18,16 @@ type FuncUdpClient struct {
 	Connections     map[int]net.Conn
 	ScheduledTasks  map[int]*ScheduledUdpTask
 	ClientReadTasks map[int]*ClientReadUdpTask
+	Reconnecting    map[int]chan struct{} // 正在重连的客户端，关闭通道可取消重连
 	Db              *sql.DB
 	Ctx             context.Context
+	Events          EventSink
 }
 
 // SendScheduledMessage 定时发送消息到 Udp 连接
 // 存储定时任务的map
 type ScheduledUdpTask struct {
-	ticker *time.Ticker
-	done   chan bool
+	done chan bool
 }
 
 // ClientReadTask 客户端读取任务
@@ -73,6 +71,13 @@ func (a *FuncUdpClient) UpdateUdpClient(config types.ServerClient) types.Connect
 			Message: "连接在线无法修改，请断线后再修改",
 		}
 	}
+	config, err := mergeStoredClient(a.Db, config)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端失败: %v", err),
+		}
+	}
 	if err := models.UpdateServerClient(a.Db, config); err != nil {
 		return types.ConnectResult{
 			Success: false,
@@ -123,95 +128,219 @@ func (a *FuncUdpClient) DeleteUdpClient(id int) types.ConnectResult {
 			Message: fmt.Sprintf("删除客户端失败: %v", err),
 		}
 	}
+	scripts.invalidate()
 	return types.ConnectResult{
 		Success: true,
 		Message: "删除客户端成功",
 	}
 }
 
-// handleUdpConnection 处理 Udp 客户端连接
-func (a *FuncUdpClient) handleUdpConnectionTask(clientID int) {
-
-	task, exists := a.ClientReadTasks[clientID]
+// handleUdpConnectionTask 处理带定时发送任务的 Udp 客户端连接
+func (a *FuncUdpClient) handleUdpConnectionTask(client types.ServerClient) {
+	a.mu.Lock()
+	task, exists := a.ClientReadTasks[client.ID]
+	a.mu.Unlock()
 	if !exists {
 		return
 	}
 
-	defer task.conn.Close()
+	a.handleUdpConnection(client, task.conn)
+}
 
+// handleUdpConnection 处理 Udp 客户端连接，读取出错后按重连策略重新拨号并替换连接
+func (a *FuncUdpClient) handleUdpConnection(client types.ServerClient, conn net.Conn) {
+	clientID := client.ID
+	script := a.newScript(client)
+	defer script.stop()
+	script.onConnect()
 	for {
-		select {
-		case <-task.done:
-			return
-		default:
-			// 创建一个固定大小的缓冲区
-			buffer := make([]byte, 1024)
-			n, err := task.conn.Read(buffer)
-			if err != nil {
-				if err == io.EOF {
-					runtime.LogError(a.Ctx, fmt.Sprintf("连接已断开: %v", err))
-					return
-				}
-				continue
-			}
+		err := a.readDatagrams(client, conn, script)
+		conn.Close()
 
-			// 只取实际读取的数据
-			data := string(buffer[:n])
+		// 连接已被 DisconnectUdpClient 移除，属于主动断开
+		stop, ok := a.beginReconnect(clientID, conn, shouldReconnect(client.Reconnect, err))
+		if !ok {
+			return
+		}
+		logError(a.Events, fmt.Sprintf("连接已断开: %v", err))
+		if stop == nil {
+			a.markOffline(clientID, fmt.Sprintf("连接已断开: %v", err))
+			return
+		}
 
-			if err := models.AddMessage(a.Db, clientID, data, "Udp", "text", "utf-8", "incoming"); err != nil {
-				runtime.LogError(a.Ctx, fmt.Sprintf("添加消息失败: %v", err))
+		newConn, _ := reconnect(client.Reconnect, stop, func() (net.Conn, error) {
+			return a.dial(client)
+		}, func(eventType string, content string) {
+			a.emitSystem(clientID, eventType, content)
+		})
+		swapped, cancelled := a.finishReconnect(clientID, newConn)
+		if !swapped {
+			if newConn != nil {
+				newConn.Close()
 			}
-			runtime.EventsEmit(a.Ctx, "client_event", types.ServerEvent{
-				Type:     "data_received",
-				ServerId: clientID,
-				Message: &types.Message{
-					ID:            clientID,
-					Content:       data,
-					Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-					Direction:     "incoming",
-					InputMethod:   "Udp",
-					DisplayMethod: "text",
-					Encoding:      "utf-8",
-				},
-			})
+			if !cancelled {
+				a.markOffline(clientID, "重连失败，连接已断开")
+			}
+			return
 		}
+		conn = newConn
+		script.onConnect()
 	}
 }
 
-func (a *FuncUdpClient) handleUdpConnection(clientID int, conn net.Conn) {
-	defer conn.Close()
+// newScript 创建客户端的脚本实例，重连期间跳过钩子
+func (a *FuncUdpClient) newScript(client types.ServerClient) *scriptSession {
+	clientID := client.ID
+	return newScriptSession(a.Db, ScriptClient, clientID, scriptHost{
+		send: func(data []byte) error {
+			return a.sendRaw(clientID, data, "script")
+		},
+		close: func() { go a.DisconnectUdpClient(clientID) },
+		log:   scriptLogger(a.Events, "client_event", clientID, 0),
+		alive: func() bool {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			_, exists := a.Connections[clientID]
+			return exists
+		},
+		charset: client.Encoding,
+	})
+}
 
+// readDatagrams 读取数据报直到连接关闭，未触发重连的读取错误（如 ICMP 端口不可达）会被忽略
+func (a *FuncUdpClient) readDatagrams(client types.ServerClient, conn net.Conn, script *scriptSession) error {
+	clientID := client.ID
+	buffer := make([]byte, 65535)
 	for {
-		// 创建一个固定大小的缓冲区
-		buffer := make([]byte, 1024)
 		n, err := conn.Read(buffer)
 		if err != nil {
-			if err == io.EOF {
-				runtime.LogError(a.Ctx, fmt.Sprintf("连接已断开: %v", err))
-				return
+			if errors.Is(err, io.EOF) || isClosedError(err) || shouldReconnect(client.Reconnect, err) {
+				return err
 			}
 			continue
 		}
 
 		// 只取实际读取的数据
-		data := string(buffer[:n])
-		if err := models.AddMessage(a.Db, clientID, data, "Udp", "text", "utf-8", "incoming"); err != nil {
-			runtime.LogError(a.Ctx, fmt.Sprintf("添加消息失败: %v", err))
+		data := append([]byte(nil), buffer[:n]...)
+		display := detectDisplayMethodCharset(data, client.Encoding)
+		verdict := verifyChecksum(data, client.Checksum)
+		if err := models.AddMessageWithChecksum(a.Db, clientID, data, "Udp", display, normalizeCharset(client.Encoding), "incoming", verdict); err != nil {
+			logError(a.Events, fmt.Sprintf("添加消息失败: %v", err))
 		}
-		runtime.EventsEmit(a.Ctx, "client_event", types.ServerEvent{
+		emitEvent(a.Events, "client_event", types.ServerEvent{
 			Type:     "data_received",
 			ServerId: clientID,
 			Message: &types.Message{
 				ID:            clientID,
-				Content:       data,
+				Content:       renderPayloadCharset(data, display, client.Encoding),
+				Payload:       data,
 				Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
 				Direction:     "incoming",
 				InputMethod:   "Udp",
-				DisplayMethod: "text",
-				Encoding:      "utf-8",
+				DisplayMethod: display,
+				Encoding:      normalizeCharset(client.Encoding),
+				Checksum:      verdict,
 			},
 		})
+		script.onData(data)
+	}
+}
+
+// beginReconnect 从连接表中移除已断开的连接，连接已被主动断开时返回 false；
+// 需要重连时登记并返回取消通道，否则返回 nil
+func (a *FuncUdpClient) beginReconnect(clientID int, conn net.Conn, reconnect bool) (chan struct{}, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if current, exists := a.Connections[clientID]; !exists || current != conn {
+		return nil, false
+	}
+	delete(a.Connections, clientID)
+	if !reconnect {
+		return nil, true
 	}
+	stop := make(chan struct{})
+	a.Reconnecting[clientID] = stop
+	return stop, true
+}
+
+// finishReconnect 重连结束后替换连接，重连期间被主动断开时 cancelled 为 true
+func (a *FuncUdpClient) finishReconnect(clientID int, conn net.Conn) (swapped bool, cancelled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, exists := a.Reconnecting[clientID]; !exists {
+		return false, true
+	}
+	delete(a.Reconnecting, clientID)
+	if conn == nil {
+		return false, false
+	}
+	a.Connections[clientID] = conn
+	if task, exists := a.ClientReadTasks[clientID]; exists {
+		task.conn = conn
+	}
+	return true, false
+}
+
+// markOffline 连接异常断开且不再重连时更新状态并停止定时发送
+func (a *FuncUdpClient) markOffline(clientID int, reason string) {
+	a.mu.Lock()
+	if task, exists := a.ScheduledTasks[clientID]; exists {
+		task.done <- true
+		delete(a.ScheduledTasks, clientID)
+	}
+	delete(a.ClientReadTasks, clientID)
+	a.mu.Unlock()
+
+	if client, err := models.GetServerClientData(a.Db, clientID); err == nil {
+		client.Status = "offline"
+		if err := models.UpdateServerClient(a.Db, client); err != nil {
+			logError(a.Events, fmt.Sprintf("更新客户端状态失败: %v", err))
+		}
+	}
+	a.emitSystem(clientID, "disconnected", reason)
+}
+
+// emitSystem 记录并推送系统消息
+func (a *FuncUdpClient) emitSystem(clientID int, eventType string, content string) {
+	if err := models.AddMessage(a.Db, clientID, []byte(content), "Udp", "text", "utf-8", "system"); err != nil {
+		logError(a.Events, fmt.Sprintf("添加消息失败: %v", err))
+	}
+	emitEvent(a.Events, "client_event", types.ServerEvent{
+		Type:     eventType,
+		ServerId: clientID,
+		Message: &types.Message{
+			ID:            clientID,
+			Content:       content,
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "system",
+			InputMethod:   "Udp",
+			DisplayMethod: "text",
+			Encoding:      "utf-8",
+		},
+	})
+}
+
+// dial 建立 Udp 连接并发送空数据包探测
+func (a *FuncUdpClient) dial(client types.ServerClient) (net.Conn, error) {
+	addr := fmt.Sprintf("%s:%d", client.Host, client.Port)
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接失败: %v", err)
+	}
+
+	conn, err := net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("连接失败: %v", err)
+	}
+
+	// 发送一个空的数据包以探测连接
+	if _, err := conn.Write([]byte{}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("连接探测失败: %v", err)
+	}
+	return conn, nil
 }
 
 // ConnectUdpClient 连接 Udp 客户端
@@ -254,47 +383,48 @@ func (a *FuncUdpClient) ConnectUdpClient(clientID int) types.ConnectResult {
 			Message: "主机地址不是有效的 IP 地址",
 		}
 	}
-
-	addr := fmt.Sprintf("%s:%d", client.Host, client.Port)
-	udpAddr, err := net.ResolveUDPAddr("udp", addr)
-	if err != nil {
+	if err := validateReconnectPolicy(client.Reconnect); err != nil {
 		return types.ConnectResult{
 			Success: false,
-			Message: fmt.Sprintf("连接失败: %v", err),
+			Message: fmt.Sprintf("重连配置错误: %v", err),
 		}
 	}
-
-	conn, err := net.DialUDP("udp", nil, udpAddr)
-	if err != nil {
+	if err := validateChecksumConfig(client.Checksum); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("校验配置错误: %v", err),
+		}
+	}
+	if err := validateCharset(client.Encoding); err != nil {
 		return types.ConnectResult{
 			Success: false,
-			Message: fmt.Sprintf("连接失败: %v", err),
+			Message: err.Error(),
 		}
 	}
 
-	// 发送一个空的数据包以探测连接
-	_, err = conn.Write([]byte{})
+	conn, err := a.dial(client)
 	if err != nil {
 		return types.ConnectResult{
 			Success: false,
-			Message: fmt.Sprintf("连接探测失败: %v", err),
+			Message: err.Error(),
 		}
 	}
 
 	a.mu.Lock()
 	a.Connections[client.ID] = conn
-	a.mu.Unlock()
-
 	if client.RepeatSend {
 		// 创建读取任务
 		a.ClientReadTasks[client.ID] = &ClientReadUdpTask{
 			conn: conn,
 			done: make(chan bool, 1),
 		}
-		go a.handleUdpConnectionTask(client.ID) // 启动处理连接的 goroutine
+	}
+	a.mu.Unlock()
 
+	if client.RepeatSend {
+		go a.handleUdpConnectionTask(client) // 启动处理连接的 goroutine
 	} else {
-		go a.handleUdpConnection(client.ID, conn) // 启动处理连接的 goroutine
+		go a.handleUdpConnection(client, conn) // 启动处理连接的 goroutine
 	}
 
 	return types.ConnectResult{
@@ -382,6 +512,15 @@ func (a *FuncUdpClient) DisconnectUdpClient(clientId int) types.ConnectResult {
 		}
 	}
 
+	if stop, exists := a.Reconnecting[clientId]; exists {
+		close(stop)
+		delete(a.Reconnecting, clientId)
+		return types.ConnectResult{
+			Success: true,
+			Message: "已停止重连",
+		}
+	}
+
 	conn, exists := a.Connections[clientId]
 	if !exists {
 		return types.ConnectResult{
@@ -418,14 +557,22 @@ func (a *FuncUdpClient) SendMessage(clientID int, message string, inputMethod st
 		}
 	}
 
-	buf := bytes.NewBuffer(nil)
-	if inputMethod == "hex" {
-		buf.WriteString(hex.EncodeToString([]byte(message)))
-	} else {
-		buf.WriteString(message)
+	client, err := models.GetServerClientData(a.Db, clientID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端数据失败: %v", err),
+		}
+	}
+	payload, err := encodeOutgoing(fmt.Sprintf("udp-client:%d", clientID), message, inputMethod, client.Encoding, client.Checksum)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("数据格式错误: %v", err),
+		}
 	}
 
-	_, err := conn.Write(buf.Bytes())
+	_, err = conn.Write(payload)
 	if err != nil {
 		return types.ConnectResult{
 			Success: false,
@@ -433,8 +580,8 @@ func (a *FuncUdpClient) SendMessage(clientID int, message string, inputMethod st
 		}
 	}
 
-	if err := models.AddMessage(a.Db, clientID, message, inputMethod, "text", "utf-8", "outgoing"); err != nil {
-		runtime.LogError(a.Ctx, fmt.Sprintf("添加消息失败: %v", err))
+	if err := models.AddMessage(a.Db, clientID, payload, inputMethod, detectDisplayMethodCharset(payload, client.Encoding), normalizeCharset(client.Encoding), "outgoing"); err != nil {
+		logError(a.Events, fmt.Sprintf("添加消息失败: %v", err))
 	}
 
 	return types.ConnectResult{
@@ -443,72 +590,93 @@ func (a *FuncUdpClient) SendMessage(clientID int, message string, inputMethod st
 	}
 }
 
-// SendScheduledMessage 定时发送消息到 Udp 连接
+// SendScheduledMessage 按毫秒间隔定时发送消息到 Udp 连接，内容中的 {{counter}} 替换为发送计数
 func (a *FuncUdpClient) SendScheduledMessage(clientID int, message string, inputMethod string, interval int) types.ConnectResult {
+	client, err := models.GetServerClientData(a.Db, clientID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端数据失败: %v", err),
+		}
+	}
+	steps, err := compileSequence(types.SendSequence{
+		Steps: []types.SequenceStep{{Content: message, InputMethod: inputMethod, DelayMs: interval}},
+	}, client.Encoding)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("数据格式错误: %v", err),
+		}
+	}
+	return a.startSchedule(client, steps, 0)
+}
+
+// SendScheduledSequence 保存客户端的发送序列并开始按序列定时发送
+func (a *FuncUdpClient) SendScheduledSequence(clientID int, sequence types.SendSequence) types.ConnectResult {
+	client, err := models.GetServerClientData(a.Db, clientID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端数据失败: %v", err),
+		}
+	}
+	steps, err := compileSequence(sequence, client.Encoding)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("发送序列错误: %v", err),
+		}
+	}
+
+	client.Sequence = sequence
+	if err := models.UpdateServerClient(a.Db, client); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("保存发送序列失败: %v", err),
+		}
+	}
+	return a.startSchedule(client, steps, sequence.Loop)
+}
+
+// startSchedule 启动定时发送任务，已有任务时先停止
+func (a *FuncUdpClient) startSchedule(client types.ServerClient, steps []sendStep, loop int) types.ConnectResult {
+	clientID := client.ID
 	a.mu.Lock()
-	_, exists := a.Connections[clientID]
-	if !exists {
+	if _, exists := a.Connections[clientID]; !exists {
 		a.mu.Unlock()
 		return types.ConnectResult{
 			Success: false,
 			Message: "连接不存在",
 		}
 	}
-	a.mu.Unlock()
-
-	// 创建定时器和停止通道
-	ticker := time.NewTicker(time.Duration(interval) * time.Second)
-	done := make(chan bool, 1)
-
-	// 保存定时任务
-	a.ScheduledTasks[clientID] = &ScheduledUdpTask{
-		ticker: ticker,
-		done:   done,
+	if task, exists := a.ScheduledTasks[clientID]; exists {
+		task.done <- true
 	}
+	task := &ScheduledUdpTask{done: make(chan bool, 1)}
+	a.ScheduledTasks[clientID] = task
+	a.mu.Unlock()
 
 	go func() {
-		for {
-			select {
-			case <-done:
-				ticker.Stop()
-				return
-			case <-ticker.C:
-				a.mu.Lock()
-				if conn, ok := a.Connections[clientID]; ok {
-					buf := bytes.NewBuffer(nil)
-					if inputMethod == "hex" {
-						buf.WriteString(hex.EncodeToString([]byte(message)))
-					} else {
-						buf.WriteString(message)
-					}
-					_, err := conn.Write(buf.Bytes())
-					if err != nil {
-						runtime.LogError(a.Ctx, fmt.Sprintf("发送消息失败: %v", err))
-						ticker.Stop()
-						delete(a.ScheduledTasks, clientID)
-					}
-					if err := models.AddMessage(a.Db, clientID, message, inputMethod, "text", "utf-8", "outgoing"); err != nil {
-						runtime.LogError(a.Ctx, fmt.Sprintf("添加消息失败: %v", err))
-					}
-					runtime.EventsEmit(a.Ctx, "client_event", types.ServerEvent{
-						Type:     "data_sent",
-						ServerId: clientID,
-						Message: &types.Message{
-							ID:            clientID,
-							Content:       message,
-							Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-							Direction:     "outgoing",
-							InputMethod:   inputMethod,
-							DisplayMethod: "text",
-							Encoding:      "utf-8",
-						},
-					})
-				} else {
-					ticker.Stop()
-					delete(a.ScheduledTasks, clientID)
-				}
-				a.mu.Unlock()
+		runSequence(steps, loop, fmt.Sprintf("udp-client:%d", clientID), task.done, func(payload []byte, inputMethod string) bool {
+			payload, err := appendChecksum(payload, client.Checksum)
+			if err != nil {
+				logError(a.Events, fmt.Sprintf("追加校验失败: %v", err))
+				return true
 			}
+			return a.sendScheduled(client, payload, inputMethod)
+		})
+
+		a.mu.Lock()
+		finished := a.ScheduledTasks[clientID] == task
+		if finished {
+			delete(a.ScheduledTasks, clientID)
+		}
+		a.mu.Unlock()
+		if finished {
+			emitEvent(a.Events, "client_event", types.ServerEvent{
+				Type:     "schedule_finished",
+				ServerId: clientID,
+			})
 		}
 	}()
 
@@ -518,6 +686,70 @@ func (a *FuncUdpClient) SendScheduledMessage(clientID int, message string, input
 	}
 }
 
+// sendScheduled 发送一条定时消息，连接已断开且不在重连时返回 false 结束任务
+func (a *FuncUdpClient) sendScheduled(client types.ServerClient, payload []byte, inputMethod string) bool {
+	clientID := client.ID
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	conn, ok := a.Connections[clientID]
+	if !ok {
+		_, reconnecting := a.Reconnecting[clientID]
+		return reconnecting
+	}
+	if _, err := conn.Write(payload); err != nil {
+		// 连接断开后由读取协程决定是否重连，重连期间暂停发送
+		logError(a.Events, fmt.Sprintf("发送消息失败: %v", err))
+		return true
+	}
+	a.recordSent(client, payload, inputMethod)
+	return true
+}
+
+// sendRaw 将已编码的字节发送到客户端连接，用于回放等不经过模板渲染的发送
+func (a *FuncUdpClient) sendRaw(clientID int, payload []byte, inputMethod string) error {
+	client, err := models.GetServerClientData(a.Db, clientID)
+	if err != nil {
+		return fmt.Errorf("获取客户端数据失败: %v", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	conn, ok := a.Connections[clientID]
+	if !ok {
+		return errors.New("连接不存在")
+	}
+	if _, err := conn.Write(payload); err != nil {
+		return fmt.Errorf("发送失败: %v", err)
+	}
+	a.recordSent(client, payload, inputMethod)
+	return nil
+}
+
+// recordSent 记录发出的消息并推送 data_sent 事件
+func (a *FuncUdpClient) recordSent(client types.ServerClient, payload []byte, inputMethod string) {
+	clientID := client.ID
+	display := detectDisplayMethodCharset(payload, client.Encoding)
+	encoding := normalizeCharset(client.Encoding)
+	if err := models.AddMessage(a.Db, clientID, payload, inputMethod, display, encoding, "outgoing"); err != nil {
+		logError(a.Events, fmt.Sprintf("添加消息失败: %v", err))
+	}
+	emitEvent(a.Events, "client_event", types.ServerEvent{
+		Type:     "data_sent",
+		ServerId: clientID,
+		Message: &types.Message{
+			ID:            clientID,
+			Content:       renderPayloadCharset(payload, display, encoding),
+			Payload:       payload,
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "outgoing",
+			InputMethod:   inputMethod,
+			DisplayMethod: display,
+			Encoding:      encoding,
+		},
+	})
+}
+
 // StopScheduledMessage 停止定时发送消息
 func (a *FuncUdpClient) StopScheduledMessage(clientID int) types.ConnectResult {
 	a.mu.Lock()
@@ -6,21 +6,19 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"io"
 	"net"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 type FuncUdpServer struct {
 	Mu      sync.Mutex
 	Servers map[int]NetListenerUdp
-	Conn    map[string]ServerConnUdp
+	Conn    map[int]ServerConnUdp // 以 server_conn.conn_id 为键
 	Ctx     context.Context
+	Events  EventSink
 	Db      *sql.DB
 	Wg      sync.WaitGroup
 }
@@ -33,7 +31,12 @@ type NetListenerUdp struct {
 }
 
 type ServerConnUdp struct {
-	Conn net.PacketConn
+	ID       int    // server_conn.conn_id
+	ServerID int    // 所属服务器
+	Host     string // 客户端 IP
+	Port     int    // 客户端端口
+	Conn     net.PacketConn
+	Addr     net.Addr // 客户端地址
 }
 
 func (a *FuncUdpServer) AddUdpServer(config types.Server) types.ConnectResult {
@@ -93,6 +96,19 @@ func (a *FuncUdpServer) UpdateUdpServer(config types.Server) types.ConnectResult
 			Message: fmt.Sprintf("获取服务器失败: %v", err),
 		}
 	} else {
+		if err := validateChecksumConfig(config.Checksum); err != nil {
+			return types.ConnectResult{
+				Success: false,
+				Message: fmt.Sprintf("校验配置错误: %v", err),
+			}
+		}
+		if err := validateCharset(config.Encoding); err != nil {
+			return types.ConnectResult{
+				Success: false,
+				Message: err.Error(),
+			}
+		}
+
 		if server.Host != config.Host || server.Port != config.Port {
 			// 检查是否有相同的 Host 和 Port 的服务器
 			servers, _ := models.GetAllServers(a.Db, "udp")
@@ -112,6 +128,8 @@ func (a *FuncUdpServer) UpdateUdpServer(config types.Server) types.ConnectResult
 		server.Remark = config.Remark
 		server.Host = config.Host
 		server.Port = config.Port
+		server.Checksum = config.Checksum
+		server.Encoding = config.Encoding
 		server.Status = "stopped"
 	}
 
@@ -148,6 +166,8 @@ func (a *FuncUdpServer) DeleteUdpServer(id int) types.ConnectResult {
 			Message: fmt.Sprintf("删除服务器失败: %v", err),
 		}
 	}
+	autoReplyRules.invalidate()
+	scripts.invalidate()
 	return types.ConnectResult{
 		Success: true,
 		Message: "删除服务器成功",
@@ -174,16 +194,7 @@ func (a *FuncUdpServer) StopUdpServer(serverID int) types.ConnectResult {
 			Message: fmt.Sprintf("停止服务器失败: %v", err),
 		}
 	}
-	// 取消并移除所有与该服务器相关的连接
-	for key, conn := range a.Conn {
-		// 假设连接的 key 包含 serverID，可以根据实际情况调整判断条件
-		if strings.HasPrefix(key, fmt.Sprintf("%d:", serverID)) {
-			conn.Conn.Close()
-			delete(a.Conn, key)
-		}
-	}
-
-	// 等待所有相关的 goroutine 完成
+	// 等待所有相关的 goroutine 完成，客户端会话在读取协程退出时移除
 	a.Wg.Wait()
 
 	// 从服务器列表中删除
@@ -228,6 +239,19 @@ func (a *FuncUdpServer) StartUdpServer(id int) types.ConnectResult {
 		}
 	}
 
+	if err := validateChecksumConfig(config.Checksum); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("校验配置错误: %v", err),
+		}
+	}
+	if err := validateCharset(config.Encoding); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+
 	addr := fmt.Sprintf("%s:%d", config.Host, config.Port)
 	listener, err := net.ListenPacket("udp", addr)
 	if err != nil {
@@ -281,7 +305,7 @@ func (a *FuncUdpServer) StartUdpServer(id int) types.ConnectResult {
 	}
 	a.Wg.Add(1)
 	// 优化：使用独立的函数处理连接，以提高代码可读性和可维护性
-	go a.handleUdpConnection(ctx, config.ID, listener)
+	go a.handleUdpConnection(ctx, config, listener)
 
 	return types.ConnectResult{
 		Success: true,
@@ -289,35 +313,54 @@ func (a *FuncUdpServer) StartUdpServer(id int) types.ConnectResult {
 	}
 }
 
-func (a *FuncUdpServer) handleUdpConnection(ctx context.Context, serverID int, conn net.PacketConn) {
+func (a *FuncUdpServer) handleUdpConnection(ctx context.Context, server types.Server, conn net.PacketConn) {
+	serverID := server.ID
 	defer func() {
 		conn.Close()
 		a.Wg.Done()
-		// 从连接映射中删除连接
+		// 监听关闭后该服务器的所有客户端会话均已失效
 		a.Mu.Lock()
-		connKey := fmt.Sprintf("%d:%d", serverID, conn.LocalAddr().(*net.UDPAddr).Port)
-		delete(a.Conn, connKey)
+		var closed []int
+		for connID, peer := range a.Conn {
+			if peer.ServerID == serverID {
+				closed = append(closed, connID)
+				delete(a.Conn, connID)
+			}
+		}
 		a.Mu.Unlock()
 
 		// 更新数据库中的连接状态
-		if err := models.UpdateServerConnStatus(a.Db, serverID, conn.LocalAddr().(*net.UDPAddr).Port, "disconnected"); err != nil {
-			runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
-				Type:     "error",
-				ServerId: serverID,
-				Message: &types.Message{
-					ID:            serverID,
-					Content:       fmt.Sprintf("更新连接状态失败: %v", err),
-					Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-					Direction:     "system",
-					InputMethod:   "udp",
-					DisplayMethod: "text",
-					Encoding:      "utf-8",
-				},
-			})
+		for _, connID := range closed {
+			if err := models.UpdateServerConn(a.Db, serverID, connID, "disconnected"); err != nil {
+				emitEvent(a.Events, "server_event", types.ServerEvent{
+					Type:     "error",
+					ServerId: serverID,
+					Message: &types.Message{
+						ID:            serverID,
+						Content:       fmt.Sprintf("更新连接状态失败: %v", err),
+						Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+						Direction:     "system",
+						InputMethod:   "udp",
+						DisplayMethod: "text",
+						Encoding:      "utf-8",
+					},
+				})
+			}
 		}
 	}()
 
-	buffer := make([]byte, 1024)
+	buffer := make([]byte, 65535)
+	// 客户端地址到 conn_id 的映射，UDP 无连接，以首个数据报作为连接建立
+	peers := make(map[string]int)
+	// 每个连接独立记录 once 规则的触发状态
+	sessions := make(map[int]*autoReplySession)
+	// 每个连接独立的脚本实例，同一地址重新建立连接时替换
+	scripts := make(map[int]*scriptSession)
+	defer func() {
+		for _, script := range scripts {
+			script.stop()
+		}
+	}()
 
 	for {
 		select {
@@ -326,85 +369,164 @@ func (a *FuncUdpServer) handleUdpConnection(ctx context.Context, serverID int, c
 		default:
 			n, clientAddr, err := conn.ReadFrom(buffer)
 			if err != nil {
-				if err == io.EOF {
-					// 客户端主动断开连接
-					models.UpdateServerConn(a.Db, serverID, clientAddr.(*net.UDPAddr).Port, "disconnected")
-					runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
-						Type:     "connection_closed",
+				if !isClosedError(err) {
+					emitEvent(a.Events, "server_event", types.ServerEvent{
+						Type:     "error",
 						ServerId: serverID,
 						Message: &types.Message{
 							ID:            serverID,
-							ConnID:        strconv.Itoa(clientAddr.(*net.UDPAddr).Port),
-							Content:       "客户端已断开连接",
+							Content:       fmt.Sprintf("读取数据错误: %v", err),
 							Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-							Direction:     "system",
+							Direction:     "incoming",
 							InputMethod:   "udp",
 							DisplayMethod: "text",
 							Encoding:      "utf-8",
 						},
 					})
-				} else {
-					runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
+				}
+				return
+			}
+
+			remote := clientAddr.(*net.UDPAddr)
+			a.Mu.Lock()
+			connID, known := peers[clientAddr.String()]
+			previous := connID
+			_, online := a.Conn[connID]
+			isNew := !known || !online
+			if isNew {
+				// 新的客户端地址或被断开过的地址，作为新连接记录
+				connID, err = models.InsertServerConn(a.Db, serverID, "connected", remote.IP.String(), remote.Port)
+				if err != nil {
+					a.Mu.Unlock()
+					emitEvent(a.Events, "server_event", types.ServerEvent{
 						Type:     "error",
 						ServerId: serverID,
 						Message: &types.Message{
 							ID:            serverID,
-							Content:       fmt.Sprintf("读取数据错误: %v", err),
+							Content:       fmt.Sprintf("记录连接失败: %v", err),
 							Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-							Direction:     "incoming",
+							Direction:     "system",
 							InputMethod:   "udp",
 							DisplayMethod: "text",
 							Encoding:      "utf-8",
 						},
 					})
+					continue
 				}
-				return
-			} else {
-				if _, ok := a.Conn[fmt.Sprintf("%d:%d", serverID, clientAddr.(*net.UDPAddr).Port)]; !ok {
-					// 插入新的连接信息
-					a.Mu.Lock()
-					a.Conn[fmt.Sprintf("%d:%d", serverID, clientAddr.(*net.UDPAddr).Port)] = ServerConnUdp{
-						Conn: conn,
-					}
-					if _, err := models.FindServerConnOne(a.Db, serverID, clientAddr.(*net.UDPAddr).Port); err != nil {
-						// 插入新的连接信息
-						models.InsertServerConn(a.Db, serverID, "connected", clientAddr.(*net.UDPAddr).IP.String(), clientAddr.(*net.UDPAddr).Port)
-						runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
-							Type:     "connection_status",
-							ServerId: serverID,
-							Message: &types.Message{
-								Content: "连接已建立",
-							},
-						})
-					}
-					a.Mu.Unlock()
+				peers[clientAddr.String()] = connID
+				a.Conn[connID] = ServerConnUdp{
+					ID:       connID,
+					ServerID: serverID,
+					Host:     remote.IP.String(),
+					Port:     remote.Port,
+					Conn:     conn,
+					Addr:     clientAddr,
 				}
+				sessions[connID] = newAutoReplySession(server)
+				emitEvent(a.Events, "server_event", types.ServerEvent{
+					Type:     "connection_status",
+					ServerId: serverID,
+					Message: &types.Message{
+						ServerID: int64(serverID),
+						ConnID:   strconv.Itoa(connID),
+						Content:  "连接已建立",
+					},
+				})
+			}
+			a.Mu.Unlock()
+			if isNew {
+				// 脚本钩子会获取 a.Mu，需在释放锁后创建和停止
+				if known {
+					scripts[previous].stop()
+					delete(scripts, previous)
+				}
+				scripts[connID] = a.newScript(serverID, connID, conn, clientAddr, server.Encoding)
+				scripts[connID].onConnect()
 			}
 
 			if n > 0 {
-				data := buffer[:n]
-				connID := fmt.Sprintf("%d:%d", serverID, clientAddr.(*net.UDPAddr).Port)
-				models.AddMessageServer(a.Db, serverID, connID, string(data), "tcp", "text", "utf-8", "incoming")
-				runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
+				data := append([]byte(nil), buffer[:n]...)
+				display := detectDisplayMethodCharset(data, server.Encoding)
+				verdict := verifyChecksum(data, server.Checksum)
+				models.AddMessageServerWithChecksum(a.Db, serverID, connID, data, "udp", display, normalizeCharset(server.Encoding), "incoming", verdict)
+				emitEvent(a.Events, "server_event", types.ServerEvent{
 					Type:     "data_received",
 					ServerId: serverID,
 					Message: &types.Message{
 						ServerID:      int64(serverID),
-						ConnID:        strconv.Itoa(clientAddr.(*net.UDPAddr).Port),
-						Content:       string(data),
+						ConnID:        strconv.Itoa(connID),
+						Content:       renderPayloadCharset(data, display, server.Encoding),
+						Payload:       data,
+						Length:        len(data),
 						Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
 						Direction:     "incoming",
 						InputMethod:   "udp",
-						DisplayMethod: "text",
-						Encoding:      "utf-8",
+						DisplayMethod: display,
+						Encoding:      normalizeCharset(server.Encoding),
+						Checksum:      verdict,
 					},
 				})
-				buffer = make([]byte, 1024)
+				a.autoReply(sessions[connID], serverID, connID, conn, clientAddr, data)
+				scripts[connID].onData(data)
 			}
 		}
 	}
 }
 
+// newScript 为客户端地址创建脚本实例，连接被断开后跳过钩子
+func (a *FuncUdpServer) newScript(serverID int, connID int, conn net.PacketConn, clientAddr net.Addr, charset string) *scriptSession {
+	return newScriptSession(a.Db, ScriptServer, serverID, scriptHost{
+		send: func(data []byte) error {
+			if _, err := conn.WriteTo(data, clientAddr); err != nil {
+				return err
+			}
+			a.recordSent(serverID, connID, data, "script", charset)
+			return nil
+		},
+		close: func() { go a.DisconnectClient(serverID, connID) },
+		log:   scriptLogger(a.Events, "server_event", serverID, connID),
+		alive: func() bool {
+			a.Mu.Lock()
+			defer a.Mu.Unlock()
+			_, online := a.Conn[connID]
+			return online
+		},
+		charset: charset,
+	})
+}
+
+// autoReply 匹配自动应答规则，命中时向客户端地址发送应答并记录为发出的消息
+func (a *FuncUdpServer) autoReply(session *autoReplySession, serverID int, connID int, conn net.PacketConn, clientAddr net.Addr, data []byte) {
+	rule, payload, err := session.match(a.Db, data)
+	if rule == nil {
+		return
+	}
+	scheduleAutoReply(rule, func() {
+		if err == nil {
+			_, err = conn.WriteTo(payload, clientAddr)
+		}
+		if err != nil {
+			emitEvent(a.Events, "server_event", types.ServerEvent{
+				Type:     "error",
+				ServerId: serverID,
+				Message: &types.Message{
+					ServerID:      int64(serverID),
+					ConnID:        strconv.Itoa(connID),
+					Content:       fmt.Sprintf("自动应答 [%s] 失败: %v", rule.Name, err),
+					Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+					Direction:     "system",
+					InputMethod:   "auto-reply",
+					DisplayMethod: "text",
+					Encoding:      "utf-8",
+				},
+			})
+			return
+		}
+
+		a.recordSent(serverID, connID, payload, "auto-reply", session.charset)
+	})
+}
+
 func (a *FuncUdpServer) GetUdpServerStatus(serverID int) types.ConnectResult {
 	a.Mu.Lock()
 	defer a.Mu.Unlock()
@@ -457,90 +579,60 @@ func (a *FuncUdpServer) GetUdpServerData(serverID int) types.ConnectResult {
 	}
 }
 
-// 修改 SendMessage 函数，发送消息到现有连接而非接受新连接
-func (a *FuncUdpServer) SendMessage(serverID int, port int, message string) types.ConnectResult {
+// SendMessage 以文本方式发送消息到现有连接，connID 为 server_conn.conn_id
+func (a *FuncUdpServer) SendMessage(serverID int, connID int, message string) types.ConnectResult {
+	return a.SendMessageEncoded(serverID, connID, message, InputText)
+}
+
+// SendMessageEncoded 按输入方式解析消息后发送到现有连接
+func (a *FuncUdpServer) SendMessageEncoded(serverID int, connID int, message string, inputMethod string) types.ConnectResult {
 	a.Mu.Lock()
 	defer a.Mu.Unlock()
 
-	client, err := models.FindServerConnOne(a.Db, serverID, port)
+	server, err := models.FindServerOne(a.Db, serverID)
 	if err != nil {
 		return types.ConnectResult{
 			Success: false,
-			Message: fmt.Sprintf("获取连接失败: %v", err),
+			Message: fmt.Sprintf("获取服务器失败: %v", err),
 		}
 	}
-
-	connID := fmt.Sprintf("%d:%d", serverID, port)
-	conn, exists := a.Conn[connID]
-	if !exists {
+	payload, err := encodeOutgoing(fmt.Sprintf("udp-server:%d", connID), message, inputMethod, server.Encoding, server.Checksum)
+	if err != nil {
 		return types.ConnectResult{
 			Success: false,
-			Message: fmt.Sprintf("连接不存在: %s", connID),
-		}
-	} else {
-		// 假设目标 IP 和端口是由变量 addr 传递进来
-		targetAddr := fmt.Sprintf("%s:%d", client.ConnHost, client.ConnPort) // conn.IP 和 conn.Port 是假设你已经在连接中获得目标信息
-		addr, err := net.ResolveUDPAddr("udp", targetAddr)
-		if err != nil {
-			runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
-				Type:     "error",
-				ServerId: serverID,
-				Message: &types.Message{
-					ServerID:      int64(serverID),
-					ConnID:        strconv.Itoa(port),
-					Content:       fmt.Sprintf("解析目标地址失败: %v", err),
-					Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-					Direction:     "outgoing",
-					InputMethod:   "tcp",
-					DisplayMethod: "text",
-					Encoding:      "utf-8",
-				},
-			})
-			return types.ConnectResult{
-				Success: false,
-				Message: fmt.Sprintf("解析目标地址失败: %v", err),
-			}
+			Message: fmt.Sprintf("数据格式错误: %v", err),
 		}
+	}
 
-		_, err = conn.Conn.WriteTo([]byte(message), addr)
-		if err != nil {
-			runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
-				Type:     "error",
-				ServerId: serverID,
-				Message: &types.Message{
-					ServerID:      int64(serverID),
-					ConnID:        strconv.Itoa(port),
-					Content:       fmt.Sprintf("发送消息错误: %v", err),
-					Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-					Direction:     "outgoing",
-					InputMethod:   "tcp",
-					DisplayMethod: "text",
-					Encoding:      "utf-8",
-				},
-			})
-			return types.ConnectResult{
-				Success: false,
-				Message: fmt.Sprintf("发送消息失败: %v", err),
-			}
-		} else {
-			connID := fmt.Sprintf("%d:%d", serverID, port)
-			models.AddMessageServer(a.Db, serverID, connID, message, "tcp", "text", "utf-8", "outgoing")
-			runtime.EventsEmit(a.Ctx, "server_event", types.ServerEvent{
-				Type:     "data_sent",
-				ServerId: serverID,
-				Message: &types.Message{
-					ServerID:      int64(serverID),
-					ConnID:        strconv.Itoa(port),
-					Content:       message,
-					Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
-					Direction:     "outgoing",
-					InputMethod:   "tcp",
-					DisplayMethod: "text",
-					Encoding:      "utf-8",
-				},
-			})
+	conn, exists := a.Conn[connID]
+	if !exists || conn.ServerID != serverID {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("连接不存在: %d", connID),
+		}
+	}
+
+	if _, err := conn.Conn.WriteTo(payload, conn.Addr); err != nil {
+		emitEvent(a.Events, "server_event", types.ServerEvent{
+			Type:     "error",
+			ServerId: serverID,
+			Message: &types.Message{
+				ServerID:      int64(serverID),
+				ConnID:        strconv.Itoa(connID),
+				Content:       fmt.Sprintf("发送消息错误: %v", err),
+				Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+				Direction:     "outgoing",
+				InputMethod:   "udp",
+				DisplayMethod: "text",
+				Encoding:      "utf-8",
+			},
+		})
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("发送消息失败: %v", err),
 		}
 	}
+	a.recordSent(serverID, connID, payload, inputMethod, server.Encoding)
 
 	return types.ConnectResult{
 		Success: true,
@@ -548,18 +640,133 @@ func (a *FuncUdpServer) SendMessage(serverID int, port int, message string) type
 	}
 }
 
-func (a *FuncUdpServer) DisconnectClient(serverID int, port int) types.ConnectResult {
+// sendRaw 将已编码的字节发送到已知客户端地址，用于回放等不经过模板渲染的发送
+func (a *FuncUdpServer) sendRaw(serverID int, connID int, payload []byte, inputMethod string) error {
+	server, err := models.FindServerOne(a.Db, serverID)
+	if err != nil {
+		return fmt.Errorf("获取服务器失败: %v", err)
+	}
 
-	_, err := models.FindServerConnOne(a.Db, serverID, port)
+	a.Mu.Lock()
+	defer a.Mu.Unlock()
+	conn, exists := a.Conn[connID]
+	if !exists || conn.ServerID != serverID {
+		return fmt.Errorf("连接不存在: %d", connID)
+	}
+	if _, err := conn.Conn.WriteTo(payload, conn.Addr); err != nil {
+		return fmt.Errorf("发送消息失败: %v", err)
+	}
+	a.recordSent(serverID, connID, payload, inputMethod, server.Encoding)
+	return nil
+}
+
+// BroadcastMessage 向服务器的所有已知客户端地址发送消息，filter 为逗号分隔的 IP/CIDR，为空时发送到全部地址
+func (a *FuncUdpServer) BroadcastMessage(serverID int, message string, inputMethod string, filter string) types.ConnectResult {
+	server, err := models.FindServerOne(a.Db, serverID)
 	if err != nil {
 		return types.ConnectResult{
 			Success: false,
-			Message: fmt.Sprintf("获取连接失败: %v", err),
+			Message: fmt.Sprintf("获取服务器失败: %v", err),
 		}
 	}
+	payload, err := encodeOutgoing(fmt.Sprintf("udp-server-broadcast:%d", serverID), message, inputMethod, server.Encoding, server.Checksum)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("数据格式错误: %v", err),
+		}
+	}
+	addrs, err := parseAddrFilter(filter)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+
+	a.Mu.Lock()
+	var targets []ServerConnUdp
+	for _, conn := range a.Conn {
+		if conn.ServerID == serverID && addrs.match(net.ParseIP(conn.Host)) {
+			targets = append(targets, conn)
+		}
+	}
+	a.Mu.Unlock()
+
+	results := make([]types.BroadcastResult, 0, len(targets))
+	for _, conn := range targets {
+		result := types.BroadcastResult{
+			ConnID: conn.ID,
+			Host:   conn.Host,
+			Port:   conn.Port,
+		}
+		if _, err := conn.Conn.WriteTo(payload, conn.Addr); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+			a.recordSent(serverID, conn.ID, payload, inputMethod, server.Encoding)
+		}
+		results = append(results, result)
+	}
+	return broadcastSummary(results)
+}
+
+// DisconnectClient 丢弃客户端会话，该地址下一个数据报将作为新连接处理
+func (a *FuncUdpServer) DisconnectClient(serverID int, connID int) types.ConnectResult {
+	a.Mu.Lock()
+	conn, exists := a.Conn[connID]
+	if exists && conn.ServerID == serverID {
+		delete(a.Conn, connID)
+	}
+	a.Mu.Unlock()
+	if !exists || conn.ServerID != serverID {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("连接不存在: %d", connID),
+		}
+	}
+
+	models.UpdateServerConn(a.Db, serverID, connID, "disconnected")
+	emitEvent(a.Events, "server_event", types.ServerEvent{
+		Type:     "connection_closed",
+		ServerId: serverID,
+		Message: &types.Message{
+			ServerID:      int64(serverID),
+			ConnID:        strconv.Itoa(connID),
+			Content:       "服务端已丢弃客户端会话",
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "system",
+			InputMethod:   "udp",
+			DisplayMethod: "text",
+			Encoding:      "utf-8",
+		},
+	})
 
 	return types.ConnectResult{
 		Success: true,
 		Message: "断开连接成功",
 	}
 }
+
+// recordSent 记录发出的消息并推送 data_sent 事件，charset 为载荷文本的字符编码
+func (a *FuncUdpServer) recordSent(serverID int, connID int, payload []byte, inputMethod string, charset string) {
+	charset = normalizeCharset(charset)
+	display := detectDisplayMethodCharset(payload, charset)
+	models.AddMessageServer(a.Db, serverID, connID, payload, inputMethod, display, charset, "outgoing")
+	emitEvent(a.Events, "server_event", types.ServerEvent{
+		Type:     "data_sent",
+		ServerId: serverID,
+		Message: &types.Message{
+			ServerID:      int64(serverID),
+			ConnID:        strconv.Itoa(connID),
+			Content:       renderPayloadCharset(payload, display, charset),
+			Payload:       payload,
+			Length:        len(payload),
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "outgoing",
+			InputMethod:   inputMethod,
+			DisplayMethod: display,
+			Encoding:      charset,
+		},
+	})
+}
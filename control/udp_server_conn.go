@@ -12,9 +12,9 @@ type UdpServerConn struct {
 	Db  *sql.DB
 }
 
-func (t *UdpServerConn) GetUDPServerConn(serverID int, port int) *types.ConnectResult {
+func (t *UdpServerConn) GetUDPServerConn(serverID int, connID int) *types.ConnectResult {
 	resp := &types.ConnectResult{}
-	conn, err := models.FindServerConnOne(t.Db, serverID, port)
+	conn, err := models.FindServerConnOne(t.Db, serverID, connID)
 	if err != nil {
 		resp.Success = false
 		resp.Message = err.Error()
@@ -1,6 +1,7 @@
 package control
 
 import (
+	"connectivity/types"
 	"fmt"
 	"testing"
 )
@@ -22,3 +23,30 @@ func TestGetAllUdpServer(t *testing.T) {
 
 	fmt.Println(clientStr.GetAllUdpServers())
 }
+
+func TestUpdateUdpServerConfigs(t *testing.T) {
+	serverStr := &FuncUdpServer{
+		Db:      openMessageDB(t),
+		Servers: make(map[int]NetListenerUdp),
+	}
+	if resp := serverStr.AddUdpServer(types.Server{Remark: "测试", Host: "127.0.0.1", Port: 8089, Type: "udp"}); !resp.Success {
+		t.Fatal(resp.Message)
+	}
+	server := serverStr.GetAllUdpServers().Data.([]types.Server)[0]
+
+	server.Checksum = types.ChecksumConfig{Algorithm: ChecksumXor, Verify: true}
+	server.Encoding = CharsetGB18030
+	if resp := serverStr.UpdateUdpServer(server); !resp.Success {
+		t.Fatal(resp.Message)
+	}
+	updated := serverStr.GetAllUdpServers().Data.([]types.Server)[0]
+	if updated.Checksum != server.Checksum || updated.Encoding != CharsetGB18030 {
+		t.Fatalf("updated = %+v", updated)
+	}
+
+	invalid := updated
+	invalid.Checksum.Algorithm = "md5"
+	if resp := serverStr.UpdateUdpServer(invalid); resp.Success {
+		t.Fatal("非法校验算法应更新失败")
+	}
+}
@@ -0,0 +1,539 @@
+package control
+
+import (
+	"connectivity/models"
+	"connectivity/types"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type FuncWsClient struct {
+	mu          sync.Mutex
+	Connections map[int]*WsConn
+	Db          *sql.DB
+	Ctx         context.Context
+	Events      EventSink
+}
+
+// WsConn WebSocket 连接，gorilla/websocket 同一时间只允许一个写入者
+type WsConn struct {
+	Conn        *websocket.Conn
+	MessageType int
+	ServerID    int    // 服务端连接所属服务器，客户端连接为 0
+	Encoding    string // 文本收发使用的字符编码
+	writeMu     sync.Mutex
+}
+
+// WriteMessage 串行写入数据帧
+func (c *WsConn) WriteMessage(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// wsMessageType 将配置中的帧类型转换为 websocket 帧类型
+func wsMessageType(messageType string) int {
+	if messageType == "binary" {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
+
+// wsFrameName 返回帧类型名称，用作消息显示方式
+func wsFrameName(messageType int) string {
+	switch messageType {
+	case websocket.BinaryMessage:
+		return "binary"
+	case websocket.PingMessage:
+		return "ping"
+	case websocket.PongMessage:
+		return "pong"
+	case websocket.CloseMessage:
+		return "close"
+	default:
+		return "text"
+	}
+}
+
+// wsClientURL 生成客户端连接地址
+func wsClientURL(client types.ServerClient) string {
+	if client.WS.URL != "" {
+		return client.WS.URL
+	}
+	scheme := "ws"
+	if client.TLS.Enabled {
+		scheme = "wss"
+	}
+	u := url.URL{
+		Scheme: scheme,
+		Host:   net.JoinHostPort(client.Host, strconv.Itoa(client.Port)),
+		Path:   client.WS.Path,
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+// AddWsClient 添加 WebSocket 客户端
+func (a *FuncWsClient) AddWsClient(config types.ServerClient) types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	config.Type = "ws"
+	if err := models.AddServerClient(a.Db, config); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("添加客户端失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "添加客户端成功",
+	}
+}
+
+// UpdateWsClient 更新 WebSocket 客户端
+func (a *FuncWsClient) UpdateWsClient(config types.ServerClient) types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, exists := a.Connections[config.ID]; exists {
+		return types.ConnectResult{
+			Success: false,
+			Message: "连接在线无法修改，请断线后再修改",
+		}
+	}
+	config.Type = "ws"
+	config, err := mergeStoredClient(a.Db, config)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端失败: %v", err),
+		}
+	}
+	if err := models.UpdateServerClient(a.Db, config); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("更新客户端失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "更新客户端成功",
+	}
+}
+
+// GetAllWsClients 获取所有 WebSocket 客户端
+func (a *FuncWsClient) GetAllWsClients() types.ConnectResult {
+	result, err := models.GetAllServerClients(a.Db, "ws")
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端失败: %v", err),
+		}
+	}
+
+	a.mu.Lock()
+	for _, client := range result {
+		if _, exists := a.Connections[client.ID]; exists {
+			client.Status = "online"
+		} else {
+			client.Status = "offline"
+		}
+	}
+	a.mu.Unlock()
+	return types.ConnectResult{
+		Success: true,
+		Message: "获取客户端成功",
+		Data:    result,
+	}
+}
+
+// DeleteWsClient 删除 WebSocket 客户端
+func (a *FuncWsClient) DeleteWsClient(id int) types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if conn, exists := a.Connections[id]; exists {
+		conn.Conn.Close()
+		delete(a.Connections, id)
+	}
+
+	if err := models.DeleteServerClient(a.Db, id); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("删除客户端失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "删除客户端成功",
+	}
+}
+
+func (a *FuncWsClient) GetWsClientData(clientID int) types.ConnectResult {
+	data, err := models.GetServerClientData(a.Db, clientID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端数据失败: %v", err),
+		}
+	}
+
+	return types.ConnectResult{
+		Success: true,
+		Message: "获取客户端数据成功",
+		Data:    data,
+	}
+}
+
+func (a *FuncWsClient) GetWsClientStatus(clientID int) types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	client, err := models.GetServerClientData(a.Db, clientID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端数据失败: %v", err),
+			Data:    client,
+		}
+	}
+	if _, exists := a.Connections[clientID]; exists {
+		return types.ConnectResult{
+			Success: true,
+			Message: "连接在线",
+			Data:    client,
+		}
+	}
+	client.Status = "offline"
+	if err := models.UpdateServerClient(a.Db, client); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("更新客户端状态失败: %v", err),
+			Data:    client,
+		}
+	}
+	return types.ConnectResult{
+		Success: false,
+		Message: "连接不在线",
+		Data:    client,
+	}
+}
+
+// ConnectWsClient 连接 WebSocket 服务端
+func (a *FuncWsClient) ConnectWsClient(clientID int) types.ConnectResult {
+	client, err := models.GetServerClientData(a.Db, clientID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端数据失败: %v", err),
+		}
+	}
+
+	a.mu.Lock()
+	_, exists := a.Connections[clientID]
+	a.mu.Unlock()
+	if exists {
+		return types.ConnectResult{
+			Success: false,
+			Message: "连接已存在",
+		}
+	}
+
+	if err := validateCharset(client.Encoding); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+
+	target := wsClientURL(client)
+	u, err := url.Parse(target)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("地址格式错误: %v", err),
+		}
+	}
+
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 5 * time.Second,
+		Subprotocols:     client.WS.Subprotocols,
+	}
+	if u.Scheme == "wss" {
+		tlsConfig, err := buildClientTLSConfig(client.TLS, u.Hostname())
+		if err != nil {
+			return types.ConnectResult{
+				Success: false,
+				Message: fmt.Sprintf("TLS 配置错误: %v", err),
+			}
+		}
+		dialer.TLSClientConfig = tlsConfig
+	}
+
+	header := http.Header{}
+	for key, value := range client.WS.Headers {
+		header.Set(key, value)
+	}
+
+	ws, resp, err := dialer.Dial(target, header)
+	if err != nil {
+		if resp != nil {
+			err = fmt.Errorf("%v (HTTP %s)", err, resp.Status)
+		}
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("连接失败: %v", err),
+		}
+	}
+
+	conn := &WsConn{
+		Conn:        ws,
+		MessageType: wsMessageType(client.WS.MessageType),
+		Encoding:    client.Encoding,
+	}
+	// 握手期间可能有并发的连接请求先完成，此时关闭本次建立的连接
+	a.mu.Lock()
+	if _, exists := a.Connections[client.ID]; exists {
+		a.mu.Unlock()
+		ws.Close()
+		return types.ConnectResult{
+			Success: false,
+			Message: "连接已存在",
+		}
+	}
+	a.Connections[client.ID] = conn
+	a.mu.Unlock()
+
+	client.Status = "online"
+	if err := models.UpdateServerClient(a.Db, client); err != nil {
+		logError(a.Events, fmt.Sprintf("更新客户端状态失败: %v", err))
+	}
+
+	handshake := fmt.Sprintf("WebSocket 握手成功: %s, HTTP %s", target, resp.Status)
+	if protocol := ws.Subprotocol(); protocol != "" {
+		handshake += fmt.Sprintf(", 子协议=%s", protocol)
+	}
+	if tlsConn, ok := ws.UnderlyingConn().(*tls.Conn); ok {
+		handshake += "\n" + describeTLSState(tlsConn.ConnectionState())
+	}
+	a.emitSystem(client.ID, "ws_handshake", handshake)
+
+	ws.SetPingHandler(func(appData string) error {
+		a.emitSystem(client.ID, "ping", fmt.Sprintf("收到 Ping: %s", appData))
+		err := ws.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+	ws.SetPongHandler(func(appData string) error {
+		a.emitSystem(client.ID, "pong", fmt.Sprintf("收到 Pong: %s", appData))
+		return nil
+	})
+
+	go a.handleWsConnection(client.ID, conn)
+
+	return types.ConnectResult{
+		Success: true,
+		Message: "连接成功",
+	}
+}
+
+func (a *FuncWsClient) handleWsConnection(clientID int, conn *WsConn) {
+	defer func() {
+		conn.Conn.Close()
+		a.mu.Lock()
+		current, ok := a.Connections[clientID]
+		closedByPeer := ok && current == conn
+		if closedByPeer {
+			delete(a.Connections, clientID)
+		}
+		a.mu.Unlock()
+
+		// 对端关闭或连接异常断开时更新状态，主动断开时已由 DisconnectWsClient 更新
+		if closedByPeer {
+			if client, err := models.GetServerClientData(a.Db, clientID); err == nil {
+				client.Status = "offline"
+				if err := models.UpdateServerClient(a.Db, client); err != nil {
+					logError(a.Events, fmt.Sprintf("更新客户端状态失败: %v", err))
+				}
+			}
+		}
+	}()
+
+	for {
+		messageType, data, err := conn.Conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				a.emitSystem(clientID, "connection_closed", fmt.Sprintf("连接已关闭: code=%d, reason=%s", closeErr.Code, closeErr.Text))
+			} else if !isClosedError(err) {
+				a.emitSystem(clientID, "connection_closed", fmt.Sprintf("连接已断开: %v", err))
+			}
+			return
+		}
+
+		frame := "ws-" + wsFrameName(messageType)
+		display := detectDisplayMethodCharset(data, conn.Encoding)
+		if err := models.AddMessage(a.Db, clientID, data, frame, display, normalizeCharset(conn.Encoding), "incoming"); err != nil {
+			logError(a.Events, fmt.Sprintf("添加消息失败: %v", err))
+		}
+		emitEvent(a.Events, "client_event", types.ServerEvent{
+			Type:     "data_received",
+			ServerId: clientID,
+			Message: &types.Message{
+				ID:            clientID,
+				Content:       renderPayloadCharset(data, display, conn.Encoding),
+				Payload:       data,
+				Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+				Direction:     "incoming",
+				InputMethod:   frame,
+				DisplayMethod: display,
+				Encoding:      normalizeCharset(conn.Encoding),
+			},
+		})
+	}
+}
+
+// emitSystem 记录并推送系统消息（握手、ping/pong、关闭）
+func (a *FuncWsClient) emitSystem(clientID int, eventType string, content string) {
+	if err := models.AddMessage(a.Db, clientID, []byte(content), "ws", "text", "utf-8", "system"); err != nil {
+		logError(a.Events, fmt.Sprintf("添加消息失败: %v", err))
+	}
+	emitEvent(a.Events, "client_event", types.ServerEvent{
+		Type:     eventType,
+		ServerId: clientID,
+		Message: &types.Message{
+			ID:            clientID,
+			Content:       content,
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "system",
+			InputMethod:   "ws",
+			DisplayMethod: "text",
+			Encoding:      "utf-8",
+		},
+	})
+}
+
+// DisconnectWsClient 发送关闭帧并断开连接，code 为 0 时使用 1000 正常关闭
+func (a *FuncWsClient) DisconnectWsClient(clientID int, code int, reason string) types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	client, err := models.GetServerClientData(a.Db, clientID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取客户端数据失败: %v", err),
+		}
+	}
+	client.Status = "offline"
+	if err := models.UpdateServerClient(a.Db, client); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("更新客户端状态失败: %v", err),
+		}
+	}
+
+	conn, exists := a.Connections[clientID]
+	if !exists {
+		return types.ConnectResult{
+			Success: false,
+			Message: "连接不存在",
+		}
+	}
+	delete(a.Connections, clientID)
+
+	if code == 0 {
+		code = websocket.CloseNormalClosure
+	}
+	closeMsg := websocket.FormatCloseMessage(code, reason)
+	conn.Conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+	if err := conn.Conn.Close(); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("断开连接失败: %v", err),
+		}
+	}
+
+	return types.ConnectResult{
+		Success: true,
+		Message: "已断开连接",
+	}
+}
+
+// SendMessage 按客户端配置的帧类型发送消息
+func (a *FuncWsClient) SendMessage(clientID int, message string, inputMethod string) types.ConnectResult {
+	a.mu.Lock()
+	conn, exists := a.Connections[clientID]
+	a.mu.Unlock()
+	if !exists {
+		return types.ConnectResult{
+			Success: false,
+			Message: "连接不存在",
+		}
+	}
+
+	payload, err := renderPayload(fmt.Sprintf("ws-client:%d", clientID), message, inputMethod, conn.Encoding)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("数据格式错误: %v", err),
+		}
+	}
+
+	if err := conn.WriteMessage(conn.MessageType, payload); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("发送失败: %v", err),
+		}
+	}
+
+	if err := models.AddMessage(a.Db, clientID, payload, inputMethod, detectDisplayMethodCharset(payload, conn.Encoding), normalizeCharset(conn.Encoding), "outgoing"); err != nil {
+		logError(a.Events, fmt.Sprintf("添加消息失败: %v", err))
+	}
+
+	return types.ConnectResult{
+		Success: true,
+		Message: "消息发送成功",
+	}
+}
+
+// SendPing 发送 Ping 控制帧
+func (a *FuncWsClient) SendPing(clientID int, payload string) types.ConnectResult {
+	a.mu.Lock()
+	conn, exists := a.Connections[clientID]
+	a.mu.Unlock()
+	if !exists {
+		return types.ConnectResult{
+			Success: false,
+			Message: "连接不存在",
+		}
+	}
+
+	if err := conn.Conn.WriteControl(websocket.PingMessage, []byte(payload), time.Now().Add(time.Second)); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("发送 Ping 失败: %v", err),
+		}
+	}
+	a.emitSystem(clientID, "ping_sent", fmt.Sprintf("发送 Ping: %s", payload))
+
+	return types.ConnectResult{
+		Success: true,
+		Message: "Ping 已发送",
+	}
+}
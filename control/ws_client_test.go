@@ -0,0 +1,74 @@
+package control
+
+import (
+	"connectivity/models"
+	"connectivity/types"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConnectWsClient(t *testing.T) {
+	a := &FuncWsClient{
+		Connections: make(map[int]*WsConn),
+		Db:          openMessageDB(t),
+	}
+	// 服务端握手后等待关闭信号再断开，模拟对端主动关闭
+	closePeer := make(chan struct{})
+	upgrader := &websocket.Upgrader{}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond) // 让并发的连接请求都进入握手
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		<-closePeer
+		ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye"), time.Now().Add(time.Second))
+	}))
+	defer httpServer.Close()
+	url := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/"
+	if err := models.AddServerClient(a.Db, types.ServerClient{Host: "127.0.0.1", Port: 1, Type: "ws", Status: "offline", WS: types.WsConfig{URL: url}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 并发连接只有一个成功，失败的一方不会覆盖已登记的连接
+	var wg sync.WaitGroup
+	results := make([]types.ConnectResult, 2)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = a.ConnectWsClient(1)
+		}(i)
+	}
+	wg.Wait()
+	if results[0].Success == results[1].Success {
+		t.Fatalf("results = %+v", results)
+	}
+	if client, _ := models.GetServerClientData(a.Db, 1); client.Status != "online" {
+		t.Fatalf("status = %s", client.Status)
+	}
+
+	// 对端关闭后状态恢复为 offline
+	close(closePeer)
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		client, _ := models.GetServerClientData(a.Db, 1)
+		a.mu.Lock()
+		conns := len(a.Connections)
+		a.mu.Unlock()
+		if client.Status == "offline" && conns == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %s, conns = %d", client.Status, conns)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
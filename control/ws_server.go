@@ -0,0 +1,619 @@
+package control
+
+import (
+	"connectivity/models"
+	"connectivity/types"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type FuncWsServer struct {
+	mu      sync.Mutex
+	Servers map[int]WsListener
+	Conn    map[int]*WsConn // 以 server_conn.conn_id 为键
+	Ctx     context.Context
+	Events  EventSink
+	Db      *sql.DB
+}
+
+type WsListener struct {
+	ID     int
+	Server *http.Server
+	Wg     *sync.WaitGroup // 该服务器上的连接处理协程
+}
+
+func (a *FuncWsServer) AddWsServer(config types.Server) types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// 检查是否有相同的 Host 和 Port 的服务器
+	servers, _ := models.GetAllServers(a.Db, "ws")
+	for _, server := range servers {
+		if server.Host == config.Host && server.Port == config.Port {
+			return types.ConnectResult{
+				Success: false,
+				Message: "服务器已存在",
+			}
+		}
+	}
+
+	config.Type = "ws"
+	config.Status = "stopped"
+
+	if err := models.AddServer(a.Db, config); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("添加服务器失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "添加服务器成功",
+	}
+}
+
+func (a *FuncWsServer) GetAllWsServers() types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	servers, err := models.GetAllServers(a.Db, "ws")
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取服务器失败: %v", err),
+		}
+	}
+
+	return types.ConnectResult{
+		Success: true,
+		Message: "获取服务器成功",
+		Data:    servers,
+	}
+}
+
+func (a *FuncWsServer) UpdateWsServer(config types.Server) types.ConnectResult {
+	server, err := models.FindServerOne(a.Db, config.ID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取服务器失败: %v", err),
+		}
+	}
+	if err := validateCharset(config.Encoding); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+	if server.Host != config.Host || server.Port != config.Port {
+		// 检查是否有相同的 Host 和 Port 的服务器
+		servers, _ := models.GetAllServers(a.Db, "ws")
+		for _, other := range servers {
+			if other.Host == config.Host && other.Port == config.Port {
+				return types.ConnectResult{
+					Success: false,
+					Message: "服务器已存在",
+				}
+			}
+		}
+	}
+
+	a.mu.Lock()
+	_, running := a.Servers[server.ID]
+	a.mu.Unlock()
+	if running {
+		a.StopWsServer(server.ID)
+	}
+
+	server.Remark = config.Remark
+	server.Host = config.Host
+	server.Port = config.Port
+	server.TLS = config.TLS
+	server.WS = config.WS
+	server.Encoding = config.Encoding
+	server.Status = "stopped"
+
+	if err := models.UpdateServer(a.Db, server); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("更新服务器失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "更新服务器成功",
+	}
+}
+
+func (a *FuncWsServer) DeleteWsServer(id int) types.ConnectResult {
+	a.mu.Lock()
+	_, running := a.Servers[id]
+	a.mu.Unlock()
+	if running {
+		a.StopWsServer(id)
+	}
+
+	// 删除所有与该服务器相关的连接
+	models.DeleteServerConnByServerID(a.Db, id)
+
+	models.DeleteMessageByServerID(a.Db, id, 0)
+
+	if err := models.DeleteServer(a.Db, id); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("删除服务器失败: %v", err),
+		}
+	}
+	return types.ConnectResult{
+		Success: true,
+		Message: "删除服务器成功",
+	}
+}
+
+// StartWsServer 启动 WebSocket 服务器，启用 TLS 时为 wss
+func (a *FuncWsServer) StartWsServer(id int) types.ConnectResult {
+	config, err := models.FindServerOne(a.Db, id)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取服务器失败: %v", err),
+		}
+	}
+
+	a.mu.Lock()
+	_, running := a.Servers[config.ID]
+	a.mu.Unlock()
+	if running {
+		return types.ConnectResult{
+			Success: false,
+			Message: "服务器已运行",
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if config.TLS.Enabled {
+		tlsConfig, err = buildServerTLSConfig(config.TLS)
+		if err != nil {
+			return types.ConnectResult{
+				Success: false,
+				Message: fmt.Sprintf("TLS 配置错误: %v", err),
+			}
+		}
+	}
+	if err := validateCharset(config.Encoding); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: err.Error(),
+		}
+	}
+
+	addr := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		if strings.Contains(err.Error(), "address already in use") {
+			return types.ConnectResult{
+				Success: false,
+				Message: "服务器已运行",
+			}
+		}
+		if strings.Contains(err.Error(), "permission denied") {
+			return types.ConnectResult{
+				Success: false,
+				Message: "权限不足",
+			}
+		}
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("启动失败: %v", err),
+		}
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	path := config.WS.Path
+	if path == "" {
+		path = "/"
+	}
+	upgrader := &websocket.Upgrader{
+		HandshakeTimeout: 10 * time.Second,
+		Subprotocols:     config.WS.Subprotocols,
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
+	server := &http.Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		a.handleUpgrade(config, server, upgrader, w, r)
+	})
+	server.Handler = mux
+
+	a.mu.Lock()
+	a.Servers[config.ID] = WsListener{
+		ID:     config.ID,
+		Server: server,
+		Wg:     &sync.WaitGroup{},
+	}
+	a.mu.Unlock()
+
+	config.Status = "running"
+	if err := models.UpdateServer(a.Db, config); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("更新服务器失败: %v", err),
+		}
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			a.emitSystem(config.ID, 0, "error", fmt.Sprintf("服务运行错误: %v", err))
+		}
+	}()
+
+	return types.ConnectResult{
+		Success: true,
+		Message: "服务器启动成功",
+	}
+}
+
+func (a *FuncWsServer) handleUpgrade(config types.Server, server *http.Server, upgrader *websocket.Upgrader, w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		a.emitSystem(config.ID, 0, "error", fmt.Sprintf("WebSocket 握手失败: %v", err))
+		return
+	}
+
+	remote, ok := ws.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		ws.Close()
+		return
+	}
+	connID, err := models.InsertServerConn(a.Db, config.ID, "connected", remote.IP.String(), remote.Port)
+	if err != nil {
+		ws.Close()
+		return
+	}
+	conn := &WsConn{
+		Conn:        ws,
+		MessageType: wsMessageType(config.WS.MessageType),
+		ServerID:    config.ID,
+		Encoding:    config.Encoding,
+	}
+
+	// 在锁内确认服务器仍在运行后再登记连接，StopWsServer 先在锁内移除服务器再等待，
+	// 因此停止开始后不会再有新的 Wg.Add
+	a.mu.Lock()
+	listener, running := a.Servers[config.ID]
+	if !running || listener.Server != server {
+		a.mu.Unlock()
+		ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server stopped"), time.Now().Add(time.Second))
+		ws.Close()
+		models.UpdateServerConn(a.Db, config.ID, connID, "disconnected")
+		return
+	}
+	a.Conn[connID] = conn
+	listener.Wg.Add(1)
+	a.mu.Unlock()
+
+	handshake := fmt.Sprintf("WebSocket 握手成功: %s %s, User-Agent=%s", r.Method, r.URL.RequestURI(), r.UserAgent())
+	if protocol := ws.Subprotocol(); protocol != "" {
+		handshake += fmt.Sprintf(", 子协议=%s", protocol)
+	}
+	if r.TLS != nil {
+		handshake += "\n" + describeTLSState(*r.TLS)
+	}
+	a.emitSystem(config.ID, connID, "connection_status", handshake)
+
+	ws.SetPingHandler(func(appData string) error {
+		a.emitSystem(config.ID, connID, "ping", fmt.Sprintf("收到 Ping: %s", appData))
+		err := ws.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+	ws.SetPongHandler(func(appData string) error {
+		a.emitSystem(config.ID, connID, "pong", fmt.Sprintf("收到 Pong: %s", appData))
+		return nil
+	})
+
+	a.handleWsConnection(config.ID, connID, conn, listener.Wg)
+}
+
+func (a *FuncWsServer) handleWsConnection(serverID int, connID int, conn *WsConn, wg *sync.WaitGroup) {
+	defer func() {
+		conn.Conn.Close()
+		wg.Done()
+		a.mu.Lock()
+		delete(a.Conn, connID)
+		a.mu.Unlock()
+
+		// 更新数据库中的连接状态
+		if err := models.UpdateServerConn(a.Db, serverID, connID, "disconnected"); err != nil {
+			a.emitSystem(serverID, connID, "error", fmt.Sprintf("更新连接状态失败: %v", err))
+		}
+	}()
+
+	for {
+		messageType, data, err := conn.Conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				a.emitSystem(serverID, connID, "connection_closed", fmt.Sprintf("客户端已断开连接: code=%d, reason=%s", closeErr.Code, closeErr.Text))
+			} else if !isClosedError(err) {
+				a.emitSystem(serverID, connID, "connection_closed", fmt.Sprintf("客户端已断开连接: %v", err))
+			}
+			return
+		}
+
+		frame := "ws-" + wsFrameName(messageType)
+		display := detectDisplayMethodCharset(data, conn.Encoding)
+		models.AddMessageServer(a.Db, serverID, connID, data, frame, display, normalizeCharset(conn.Encoding), "incoming")
+		emitEvent(a.Events, "server_event", types.ServerEvent{
+			Type:     "data_received",
+			ServerId: serverID,
+			Message: &types.Message{
+				ServerID:      int64(serverID),
+				ConnID:        strconv.Itoa(connID),
+				Content:       renderPayloadCharset(data, display, conn.Encoding),
+				Payload:       data,
+				Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+				Direction:     "incoming",
+				InputMethod:   frame,
+				DisplayMethod: display,
+				Encoding:      normalizeCharset(conn.Encoding),
+			},
+		})
+	}
+}
+
+// emitSystem 推送系统事件，connID 非 0 时同时记录到对应连接的消息中
+func (a *FuncWsServer) emitSystem(serverID int, connID int, eventType string, content string) {
+	var conn string
+	if connID != 0 {
+		conn = strconv.Itoa(connID)
+		models.AddMessageServer(a.Db, serverID, connID, []byte(content), "ws", "text", "utf-8", "system")
+	}
+	emitEvent(a.Events, "server_event", types.ServerEvent{
+		Type:     eventType,
+		ServerId: serverID,
+		Message: &types.Message{
+			ServerID:      int64(serverID),
+			ConnID:        conn,
+			Content:       content,
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "system",
+			InputMethod:   "ws",
+			DisplayMethod: "text",
+			Encoding:      "utf-8",
+		},
+	})
+}
+
+// StopWsServer 停止 WebSocket 服务器并关闭所有连接
+func (a *FuncWsServer) StopWsServer(serverID int) types.ConnectResult {
+	a.mu.Lock()
+	server, exists := a.Servers[serverID]
+	if !exists {
+		a.mu.Unlock()
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("服务器未运行: %d", serverID),
+		}
+	}
+	delete(a.Servers, serverID)
+
+	for connID, conn := range a.Conn {
+		if conn.ServerID == serverID {
+			conn.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server stopped"), time.Now().Add(time.Second))
+			conn.Conn.Close()
+			delete(a.Conn, connID)
+		}
+	}
+	a.mu.Unlock()
+
+	if err := server.Server.Close(); err != nil && !isClosedError(err) {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("停止服务器失败: %v", err),
+		}
+	}
+
+	// 等待该服务器的连接处理协程完成
+	server.Wg.Wait()
+
+	serverData, err := models.FindServerOne(a.Db, serverID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取服务器失败: %v", err),
+		}
+	}
+	serverData.Status = "stopped"
+	if err := models.UpdateServer(a.Db, serverData); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("更新服务器状态失败: %v", err),
+		}
+	}
+
+	a.emitSystem(serverID, 0, "server_stopped", "服务器已停止")
+
+	return types.ConnectResult{
+		Success: true,
+		Message: "停止服务器成功",
+	}
+}
+
+func (a *FuncWsServer) GetWsServerStatus(serverID int) types.ConnectResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	server, err := models.FindServerOne(a.Db, serverID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取服务器数据失败: %v", err),
+			Data:    server,
+		}
+	}
+	if _, exists := a.Servers[serverID]; exists {
+		return types.ConnectResult{
+			Success: true,
+			Message: "连接在线",
+			Data:    server,
+		}
+	}
+	server.Status = "stopped"
+	if err := models.UpdateServer(a.Db, server); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("更新服务器状态失败: %v", err),
+			Data:    server,
+		}
+	}
+	return types.ConnectResult{
+		Success: false,
+		Message: "连接不在线",
+		Data:    server,
+	}
+}
+
+func (a *FuncWsServer) GetWsServerData(serverID int) types.ConnectResult {
+	data, err := models.FindServerOne(a.Db, serverID)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("获取服务器数据失败: %v", err),
+		}
+	}
+
+	return types.ConnectResult{
+		Success: true,
+		Message: "获取服务器数据成功",
+		Data:    data,
+	}
+}
+
+// SendMessage 以文本方式向指定连接发送消息，connID 为 server_conn.conn_id
+func (a *FuncWsServer) SendMessage(serverID int, connID int, message string) types.ConnectResult {
+	return a.SendMessageEncoded(serverID, connID, message, InputText)
+}
+
+// SendMessageEncoded 按输入方式解析消息后向指定连接发送
+func (a *FuncWsServer) SendMessageEncoded(serverID int, connID int, message string, inputMethod string) types.ConnectResult {
+	conn, exists := a.serverConn(serverID, connID)
+	if !exists {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("连接不存在: %d", connID),
+		}
+	}
+
+	payload, err := renderPayload(fmt.Sprintf("ws-server:%d", connID), message, inputMethod, conn.Encoding)
+	if err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("数据格式错误: %v", err),
+		}
+	}
+
+	if err := conn.WriteMessage(conn.MessageType, payload); err != nil {
+		a.emitSystem(serverID, connID, "error", fmt.Sprintf("发送消息错误: %v", err))
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("发送消息失败: %v", err),
+		}
+	}
+
+	display := detectDisplayMethodCharset(payload, conn.Encoding)
+	models.AddMessageServer(a.Db, serverID, connID, payload, inputMethod, display, normalizeCharset(conn.Encoding), "outgoing")
+	emitEvent(a.Events, "server_event", types.ServerEvent{
+		Type:     "data_sent",
+		ServerId: serverID,
+		Message: &types.Message{
+			ServerID:      int64(serverID),
+			ConnID:        strconv.Itoa(connID),
+			Content:       renderPayloadCharset(payload, display, conn.Encoding),
+			Payload:       payload,
+			Timestamp:     time.Now().Format("2006-01-02 15:04:05"),
+			Direction:     "outgoing",
+			InputMethod:   inputMethod,
+			DisplayMethod: display,
+			Encoding:      normalizeCharset(conn.Encoding),
+		},
+	})
+
+	return types.ConnectResult{
+		Success: true,
+		Message: "发送消息成功",
+	}
+}
+
+// SendPing 向指定连接发送 Ping 控制帧
+func (a *FuncWsServer) SendPing(serverID int, connID int, payload string) types.ConnectResult {
+	conn, exists := a.serverConn(serverID, connID)
+	if !exists {
+		return types.ConnectResult{
+			Success: false,
+			Message: "连接不存在",
+		}
+	}
+
+	if err := conn.Conn.WriteControl(websocket.PingMessage, []byte(payload), time.Now().Add(time.Second)); err != nil {
+		return types.ConnectResult{
+			Success: false,
+			Message: fmt.Sprintf("发送 Ping 失败: %v", err),
+		}
+	}
+	a.emitSystem(serverID, connID, "ping_sent", fmt.Sprintf("发送 Ping: %s", payload))
+
+	return types.ConnectResult{
+		Success: true,
+		Message: "Ping 已发送",
+	}
+}
+
+// DisconnectClient 发送关闭帧断开指定连接，code 为 0 时使用 1000 正常关闭
+func (a *FuncWsServer) DisconnectClient(serverID int, connID int, code int, reason string) types.ConnectResult {
+	conn, exists := a.serverConn(serverID, connID)
+	if !exists {
+		return types.ConnectResult{
+			Success: false,
+			Message: "连接不存在",
+		}
+	}
+
+	if code == 0 {
+		code = websocket.CloseNormalClosure
+	}
+	conn.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	conn.Conn.Close()
+
+	return types.ConnectResult{
+		Success: true,
+		Message: "断开连接成功",
+	}
+}
+
+// serverConn 获取属于指定服务器的连接
+func (a *FuncWsServer) serverConn(serverID int, connID int) (*WsConn, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	conn, exists := a.Conn[connID]
+	if !exists || conn.ServerID != serverID {
+		return nil, false
+	}
+	return conn, true
+}
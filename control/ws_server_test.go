@@ -0,0 +1,104 @@
+package control
+
+import (
+	"connectivity/models"
+	"connectivity/types"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWsServerRejectsAfterStop(t *testing.T) {
+	a := &FuncWsServer{
+		Servers: make(map[int]WsListener),
+		Conn:    make(map[int]*WsConn),
+		Db:      openMessageDB(t),
+	}
+	// 模拟停止后仍在处理中的握手: 服务器已从 Servers 中移除
+	stopped := &http.Server{}
+	config := types.Server{ID: 1, Type: "ws"}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.handleUpgrade(config, stopped, &websocket.Upgrader{}, w, r)
+	}))
+	defer httpServer.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(3 * time.Second))
+	var closeErr *websocket.CloseError
+	if _, _, err := ws.ReadMessage(); !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Fatalf("read: %v", err)
+	}
+
+	a.mu.Lock()
+	conns := len(a.Conn)
+	a.mu.Unlock()
+	if conns != 0 {
+		t.Fatalf("停止后仍登记了 %d 个连接", conns)
+	}
+}
+
+func TestStopWsServerWaitsOnlyOwnConnections(t *testing.T) {
+	a := &FuncWsServer{
+		Servers: make(map[int]WsListener),
+		Conn:    make(map[int]*WsConn),
+		Db:      openMessageDB(t),
+	}
+	var ports []int
+	for i := 0; i < 2; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ports = append(ports, listener.Addr().(*net.TCPAddr).Port)
+		listener.Close()
+		if err := models.AddServer(a.Db, types.Server{Host: "127.0.0.1", Port: ports[i], Status: "stopped", Type: "ws"}); err != nil {
+			t.Fatal(err)
+		}
+		if resp := a.StartWsServer(i + 1); !resp.Success {
+			t.Fatal(resp.Message)
+		}
+	}
+	defer a.StopWsServer(2)
+
+	// 服务器 2 上保持一个连接，停止服务器 1 不应等待它
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+net.JoinHostPort("127.0.0.1", strconv.Itoa(ports[1]))+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		a.mu.Lock()
+		conns := len(a.Conn)
+		a.mu.Unlock()
+		if conns == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("连接未登记")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		a.StopWsServer(1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("停止服务器 1 被服务器 2 的连接阻塞")
+	}
+}
@@ -16,8 +16,12 @@ export function GetTCPServerData(arg1:number):Promise<types.ConnectResult>;
 
 export function GetTCPServerStatus(arg1:number):Promise<types.ConnectResult>;
 
+export function KickClient(arg1:number,arg2:number,arg3:string):Promise<types.ConnectResult>;
+
 export function SendMessage(arg1:number,arg2:number,arg3:string):Promise<types.ConnectResult>;
 
+export function SendMessageEncoded(arg1:number,arg2:number,arg3:string,arg4:string):Promise<types.ConnectResult>;
+
 export function StartTCPServer(arg1:number):Promise<types.ConnectResult>;
 
 export function StopTCPServer(arg1:number):Promise<types.ConnectResult>;
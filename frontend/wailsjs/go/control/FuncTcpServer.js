@@ -30,10 +30,18 @@ export function GetTCPServerStatus(arg1) {
   return window['go']['control']['FuncTcpServer']['GetTCPServerStatus'](arg1);
 }
 
+export function KickClient(arg1, arg2, arg3) {
+  return window['go']['control']['FuncTcpServer']['KickClient'](arg1, arg2, arg3);
+}
+
 export function SendMessage(arg1, arg2, arg3) {
   return window['go']['control']['FuncTcpServer']['SendMessage'](arg1, arg2, arg3);
 }
 
+export function SendMessageEncoded(arg1, arg2, arg3, arg4) {
+  return window['go']['control']['FuncTcpServer']['SendMessageEncoded'](arg1, arg2, arg3, arg4);
+}
+
 export function StartTCPServer(arg1) {
   return window['go']['control']['FuncTcpServer']['StartTCPServer'](arg1);
 }
@@ -16,6 +16,8 @@ export function GetUdpServerStatus(arg1:number):Promise<types.ConnectResult>;
 
 export function SendMessage(arg1:number,arg2:number,arg3:string):Promise<types.ConnectResult>;
 
+export function SendMessageEncoded(arg1:number,arg2:number,arg3:string,arg4:string):Promise<types.ConnectResult>;
+
 export function StartUdpServer(arg1:number):Promise<types.ConnectResult>;
 
 export function StopUdpServer(arg1:number):Promise<types.ConnectResult>;
@@ -30,6 +30,10 @@ export function SendMessage(arg1, arg2, arg3) {
   return window['go']['control']['FuncUdpServer']['SendMessage'](arg1, arg2, arg3);
 }
 
+export function SendMessageEncoded(arg1, arg2, arg3, arg4) {
+  return window['go']['control']['FuncUdpServer']['SendMessageEncoded'](arg1, arg2, arg3, arg4);
+}
+
 export function StartUdpServer(arg1) {
   return window['go']['control']['FuncUdpServer']['StartUdpServer'](arg1);
 }
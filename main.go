@@ -2,6 +2,7 @@ package main
 
 import (
 	"embed"
+	"os"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/wailsapp/wails/v2"
@@ -14,6 +15,11 @@ import (
 var assets embed.FS
 
 func main() {
+	// 带子命令启动时以命令行模式运行，不打开窗口
+	if len(os.Args) > 1 && isCLICommand(os.Args[1]) {
+		os.Exit(runCLI(os.Args[1:]))
+	}
+
 	app := NewApp()
 	err := wails.Run(&options.App{
 		Title:  "网络调试工具",
@@ -34,6 +40,14 @@ func main() {
 			app.UdpClient,
 			app.UdpServer,
 			app.UdpServerConn,
+			app.WsServer,
+			app.WsClient,
+			app.Cert,
+			app.AutoReply,
+			app.Replay,
+			app.Automation,
+			app.Scenario,
+			app.Script,
 		},
 	})
 
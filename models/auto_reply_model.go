@@ -0,0 +1,59 @@
+package models
+
+import (
+	"connectivity/types"
+	"database/sql"
+)
+
+const autoReplyRuleColumns = `id, server_id, name, match_type, pattern, pattern_input, response, response_input, delay_ms, mode, priority, enabled`
+
+func scanAutoReplyRule(row rowScanner) (types.AutoReplyRule, error) {
+	var rule types.AutoReplyRule
+	var name, patternInput, responseInput, mode sql.NullString
+	err := row.Scan(&rule.ID, &rule.ServerID, &name, &rule.MatchType, &rule.Pattern, &patternInput, &rule.Response, &responseInput, &rule.DelayMs, &mode, &rule.Priority, &rule.Enabled)
+	rule.Name = name.String
+	rule.PatternInput = patternInput.String
+	rule.ResponseInput = responseInput.String
+	rule.Mode = mode.String
+	return rule, err
+}
+
+func AddAutoReplyRule(db *sql.DB, rule types.AutoReplyRule) error {
+	_, err := db.Exec(`INSERT INTO auto_reply_rule (server_id, name, match_type, pattern, pattern_input, response, response_input, delay_ms, mode, priority, enabled) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rule.ServerID, rule.Name, rule.MatchType, rule.Pattern, rule.PatternInput, rule.Response, rule.ResponseInput, rule.DelayMs, rule.Mode, rule.Priority, rule.Enabled)
+	return err
+}
+
+func UpdateAutoReplyRule(db *sql.DB, rule types.AutoReplyRule) error {
+	_, err := db.Exec(`UPDATE auto_reply_rule SET server_id=?, name=?, match_type=?, pattern=?, pattern_input=?, response=?, response_input=?, delay_ms=?, mode=?, priority=?, enabled=? WHERE id=?`,
+		rule.ServerID, rule.Name, rule.MatchType, rule.Pattern, rule.PatternInput, rule.Response, rule.ResponseInput, rule.DelayMs, rule.Mode, rule.Priority, rule.Enabled, rule.ID)
+	return err
+}
+
+func DeleteAutoReplyRule(db *sql.DB, id int) error {
+	_, err := db.Exec(`DELETE FROM auto_reply_rule WHERE id=?`, id)
+	return err
+}
+
+func FindAutoReplyRuleOne(db *sql.DB, id int) (types.AutoReplyRule, error) {
+	return scanAutoReplyRule(db.QueryRow(`SELECT `+autoReplyRuleColumns+` FROM auto_reply_rule WHERE id=?`, id))
+}
+
+// GetAutoReplyRules 获取服务端的应答规则，按优先级排序
+func GetAutoReplyRules(db *sql.DB, serverID int) ([]types.AutoReplyRule, error) {
+	rows, err := db.Query(`SELECT `+autoReplyRuleColumns+` FROM auto_reply_rule WHERE server_id=? ORDER BY priority, id`, serverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []types.AutoReplyRule
+	for rows.Next() {
+		rule, err := scanAutoReplyRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
@@ -3,24 +3,87 @@ package models
 import (
 	"connectivity/types"
 	"database/sql"
+	"encoding/json"
 )
 
+const serverClientColumns = `id, remark, host, port, status, type, COALESCE(encoding, ''), repeat_send, repeat_interval, send_content, tls_config, ws_config, framer_config, reconnect_config, send_sequence, checksum_config`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanServerClient(row rowScanner) (*types.ServerClient, error) {
+	client := &types.ServerClient{}
+	var tlsConfig, wsConfig, framerConfig, reconnectConfig, sendSequence, checksumConfig sql.NullString
+	if err := row.Scan(&client.ID, &client.Remark, &client.Host, &client.Port, &client.Status, &client.Type, &client.Encoding, &client.RepeatSend, &client.RepeatInterval, &client.SendContent, &tlsConfig, &wsConfig, &framerConfig, &reconnectConfig, &sendSequence, &checksumConfig); err != nil {
+		return nil, err
+	}
+	if err := unmarshalConfigs([]sql.NullString{tlsConfig, wsConfig, framerConfig, reconnectConfig, sendSequence, checksumConfig}, &client.TLS, &client.WS, &client.Framer, &client.Reconnect, &client.Sequence, &client.Checksum); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// marshalConfig 将配置序列化为 JSON 字符串存储
+func marshalConfig(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// marshalConfigs 依次序列化多个配置，结果可直接作为 SQL 参数
+func marshalConfigs(configs ...interface{}) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(configs))
+	for _, config := range configs {
+		value, err := marshalConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// unmarshalConfigs 依次解析多个 JSON 配置列
+func unmarshalConfigs(values []sql.NullString, targets ...interface{}) error {
+	for i, value := range values {
+		if err := unmarshalConfig(value, targets[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshalConfig 解析 JSON 配置列，空值保持默认配置
+func unmarshalConfig(value sql.NullString, v interface{}) error {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(value.String), v)
+}
+
 func AddServerClient(db *sql.DB, client types.ServerClient) error {
-	_, err := db.Exec(`INSERT INTO server_client (remark, host, port, status, type, repeat_send, repeat_interval, send_content) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-		client.Remark, client.Host, client.Port, client.Status, client.Type, client.RepeatSend, client.RepeatInterval, client.SendContent)
+	configs, err := marshalConfigs(client.TLS, client.WS, client.Framer, client.Reconnect, client.Sequence, client.Checksum)
+	if err != nil {
+		return err
+	}
+	args := append([]interface{}{client.Remark, client.Host, client.Port, client.Status, client.Type, client.Encoding, client.RepeatSend, client.RepeatInterval, client.SendContent}, configs...)
+	_, err = db.Exec(`INSERT INTO server_client (remark, host, port, status, type, encoding, repeat_send, repeat_interval, send_content, tls_config, ws_config, framer_config, reconnect_config, send_sequence, checksum_config) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, args...)
 	return err
 }
 
 func GetAllServerClients(db *sql.DB, typer string) ([]*types.ServerClient, error) {
-	rows, err := db.Query(`SELECT id, remark, host, port, status, type, repeat_send, repeat_interval, send_content FROM server_client WHERE type='` + typer + `'`)
+	rows, err := db.Query(`SELECT `+serverClientColumns+` FROM server_client WHERE type=?`, typer)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var clients []*types.ServerClient
 	for rows.Next() {
-		client := &types.ServerClient{}
-		if err := rows.Scan(&client.ID, &client.Remark, &client.Host, &client.Port, &client.Status, &client.Type, &client.RepeatSend, &client.RepeatInterval, &client.SendContent); err != nil {
+		client, err := scanServerClient(rows)
+		if err != nil {
 			return nil, err
 		}
 
@@ -30,24 +93,46 @@ func GetAllServerClients(db *sql.DB, typer string) ([]*types.ServerClient, error
 }
 
 func UpdateServerClient(db *sql.DB, client types.ServerClient) error {
-	_, err := db.Exec(`UPDATE server_client SET remark=?, host=?, port=?, status=?, type=?, repeat_send=?, repeat_interval=?, send_content=? WHERE id=?`,
-		client.Remark, client.Host, client.Port, client.Status, client.Type, client.RepeatSend, client.RepeatInterval, client.SendContent, client.ID)
+	configs, err := marshalConfigs(client.TLS, client.WS, client.Framer, client.Reconnect, client.Sequence, client.Checksum)
+	if err != nil {
+		return err
+	}
+	args := append([]interface{}{client.Remark, client.Host, client.Port, client.Status, client.Type, client.Encoding, client.RepeatSend, client.RepeatInterval, client.SendContent}, configs...)
+	_, err = db.Exec(`UPDATE server_client SET remark=?, host=?, port=?, status=?, type=?, encoding=?, repeat_send=?, repeat_interval=?, send_content=?, tls_config=?, ws_config=?, framer_config=?, reconnect_config=?, send_sequence=?, checksum_config=? WHERE id=?`, append(args, client.ID)...)
 	return err
 }
 
 func DeleteServerClient(db *sql.DB, id int) error {
-	_, err := db.Exec(`DELETE FROM server_client WHERE id=?`, id)
-	return err
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM script WHERE target_type='client' AND target_id=?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM server_client WHERE id=?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func FindServerClientOne(db *sql.DB, id int) (types.ServerClient, error) {
-	var client types.ServerClient
-	err := db.QueryRow(`SELECT id, remark, host, port, status, type, repeat_send, repeat_interval, send_content FROM server_client WHERE id=?`, id).Scan(&client.ID, &client.Remark, &client.Host, &client.Port, &client.Status, &client.Type, &client.RepeatSend, &client.RepeatInterval, &client.SendContent)
-	return client, err
+	client, err := scanServerClient(db.QueryRow(`SELECT `+serverClientColumns+` FROM server_client WHERE id=?`, id))
+	if err != nil {
+		return types.ServerClient{}, err
+	}
+	return *client, nil
 }
 
 func GetServerClientData(db *sql.DB, id int) (types.ServerClient, error) {
-	var client types.ServerClient
-	err := db.QueryRow(`SELECT id, remark, host, port, status, type, repeat_send, repeat_interval, send_content FROM server_client WHERE id=?`, id).Scan(&client.ID, &client.Remark, &client.Host, &client.Port, &client.Status, &client.Type, &client.RepeatSend, &client.RepeatInterval, &client.SendContent)
-	return client, err
+	return FindServerClientOne(db, id)
+}
+
+// FindServerClientByAddr 返回指定类型、地址和端口的客户端中最新添加的一个的 id，不存在时返回 0
+func FindServerClientByAddr(db *sql.DB, typer string, host string, port int) (int, error) {
+	var id int
+	err := db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM server_client WHERE type=? AND host=? AND port=?`, typer, host, port).Scan(&id)
+	return id, err
 }
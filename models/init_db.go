@@ -3,9 +3,23 @@ package models
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 )
 
+// dbExecutor *sql.DB 与 *sql.Tx 的公共方法，迁移在事务中执行
+type dbExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// InitDB 初始化数据库，执行全部迁移
 func InitDB(db *sql.DB) error {
+	return Migrate(db, "")
+}
+
+// migrateInitialSchema 初始表结构
+func migrateInitialSchema(db dbExecutor) error {
 	// 检查并创建 tcp_client 表
 	if err := createTableIfNotExists(db, `CREATE TABLE IF NOT EXISTS server_client (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -32,7 +46,7 @@ func InitDB(db *sql.DB) error {
 		content TEXT NOT NULL,
 		direction TEXT NOT NULL,
 		input_method TEXT NOT NULL,
-		display_method TEXT NOT NULL, 
+		display_method TEXT NOT NULL,
 		encoding TEXT NOT NULL,
 		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (client_id) REFERENCES tcp_client(id),
@@ -73,7 +87,7 @@ func InitDB(db *sql.DB) error {
 }
 
 // 辅助函数：创建表
-func createTableIfNotExists(db *sql.DB, createTableSQL string) error {
+func createTableIfNotExists(db dbExecutor, createTableSQL string) error {
 	// 获取表名
 	var tableName string
 	// 解析 SQL 语句以获取表名
@@ -97,3 +111,64 @@ func createTableIfNotExists(db *sql.DB, createTableSQL string) error {
 
 	return nil
 }
+
+// columnExists 检查表中是否存在指定列
+func columnExists(db dbExecutor, table string, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// addColumnIfNotExists 列不存在时追加列
+func addColumnIfNotExists(db dbExecutor, table string, column string, definition string) error {
+	exists, err := columnExists(db, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// tableSQL 返回建表语句，用于判断约束是否需要重建
+func tableSQL(db dbExecutor, table string) (string, error) {
+	var createSQL string
+	err := db.QueryRow(`SELECT sql FROM sqlite_master WHERE type='table' AND name=?`, table).Scan(&createSQL)
+	return createSQL, err
+}
+
+// rebuildTable 按新的建表语句重建表并复制指定列的数据，SQLite 不支持直接修改约束
+func rebuildTable(db dbExecutor, table string, createSQL string, columns []string) error {
+	tmp := table + "_new"
+	cols := strings.Join(columns, ", ")
+	statements := []string{
+		fmt.Sprintf(createSQL, tmp),
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", tmp, cols, cols, table),
+		fmt.Sprintf("DROP TABLE %s", table),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", tmp, table),
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
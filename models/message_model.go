@@ -3,26 +3,57 @@ package models
 import (
 	"connectivity/types"
 	"database/sql"
-	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
-// 添加消息
-func AddMessage(db *sql.DB, clientID int, content string, inputMethod string, displayMethod string, encoding string, direction string) error {
-	_, err := db.Exec(`INSERT INTO message (client_id, content, input_method, display_method, encoding, direction, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?)`, clientID, content, inputMethod, displayMethod, encoding, direction, time.Now().Format("2006-01-02 15:04:05"))
+// TimestampLayout 消息时间的存储格式，精确到毫秒，按字符串比较即为时间先后。
+// 查询时以 CAST(timestamp AS TEXT) 读取原始文本，避免驱动按 DATETIME 列解析为 UTC 时间
+const TimestampLayout = "2006-01-02 15:04:05.000"
+
+// 添加消息，payload 为原始字节
+func AddMessage(db *sql.DB, clientID int, payload []byte, inputMethod string, displayMethod string, encoding string, direction string) error {
+	return AddMessageWithChecksum(db, clientID, payload, inputMethod, displayMethod, encoding, direction, "")
+}
+
+// AddMessageWithChecksum 添加消息并记录接收校验结果
+func AddMessageWithChecksum(db *sql.DB, clientID int, payload []byte, inputMethod string, displayMethod string, encoding string, direction string, checksum string) error {
+	_, err := db.Exec(`INSERT INTO message (client_id, payload, payload_len, input_method, display_method, encoding, direction, timestamp, checksum) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, clientID, nonNilPayload(payload), len(payload), inputMethod, displayMethod, encoding, direction, time.Now().Format(TimestampLayout), nullableString(checksum))
 	return err
 }
 
-func AddMessageServer(db *sql.DB, serverID int, connID string, content string, inputMethod string, displayMethod string, encoding string, direction string) error {
-	_, err := db.Exec(`INSERT INTO message (server_id, conn_id, content, input_method, display_method, encoding, direction, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, serverID, connID, content, inputMethod, displayMethod, encoding, direction, time.Now().Format("2006-01-02 15:04:05"))
+// AddMessageServer 添加服务端连接消息，connID 为 server_conn.conn_id
+func AddMessageServer(db *sql.DB, serverID int, connID int, payload []byte, inputMethod string, displayMethod string, encoding string, direction string) error {
+	return AddMessageServerWithChecksum(db, serverID, connID, payload, inputMethod, displayMethod, encoding, direction, "")
+}
+
+// AddMessageServerWithChecksum 添加服务端连接消息并记录接收校验结果
+func AddMessageServerWithChecksum(db *sql.DB, serverID int, connID int, payload []byte, inputMethod string, displayMethod string, encoding string, direction string, checksum string) error {
+	_, err := db.Exec(`INSERT INTO message (server_id, conn_id, payload, payload_len, input_method, display_method, encoding, direction, timestamp, checksum) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, serverID, strconv.Itoa(connID), nonNilPayload(payload), len(payload), inputMethod, displayMethod, encoding, direction, time.Now().Format(TimestampLayout), nullableString(checksum))
 
 	return err
 }
 
+// nonNilPayload 空消息存储为零长度 BLOB 而不是 NULL
+func nonNilPayload(payload []byte) []byte {
+	if payload == nil {
+		return []byte{}
+	}
+	return payload
+}
+
+// nullableString 空字符串存储为 NULL
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 // 获取所有消息
 func GetAllMessages(db *sql.DB, clientID int) ([]types.Message, error) {
-	rows, err := db.Query(`SELECT id, client_id, content, input_method, display_method, encoding, direction, timestamp FROM message WHERE client_id=?`, clientID)
+	rows, err := db.Query(`SELECT id, client_id, payload, payload_len, input_method, display_method, encoding, direction, CAST(timestamp AS TEXT), COALESCE(checksum, '') FROM message WHERE client_id=? ORDER BY id`, clientID)
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +62,7 @@ func GetAllMessages(db *sql.DB, clientID int) ([]types.Message, error) {
 	var messages []types.Message
 	for rows.Next() {
 		var message types.Message
-		if err := rows.Scan(&message.ID, &message.ClientID, &message.Content, &message.InputMethod, &message.DisplayMethod, &message.Encoding, &message.Direction, &message.Timestamp); err != nil {
+		if err := rows.Scan(&message.ID, &message.ClientID, &message.Payload, &message.Length, &message.InputMethod, &message.DisplayMethod, &message.Encoding, &message.Direction, &message.Timestamp, &message.Checksum); err != nil {
 			return nil, err
 		}
 		messages = append(messages, message)
@@ -39,8 +70,9 @@ func GetAllMessages(db *sql.DB, clientID int) ([]types.Message, error) {
 	return messages, nil
 }
 
+// GetServerAllMessages 获取服务端连接最近的 100 条消息，按时间先后排列，更多历史使用 QueryMessages 分页获取
 func GetServerAllMessages(db *sql.DB, serverID int, connID int) ([]*types.Message, error) {
-	rows, err := db.Query(`SELECT id, server_id, conn_id, content, input_method, display_method, encoding, direction, timestamp FROM message WHERE conn_id='` + fmt.Sprintf("%d:%d", serverID, connID) + `' limit 100`)
+	rows, err := db.Query(`SELECT id, server_id, conn_id, payload, payload_len, input_method, display_method, encoding, direction, CAST(timestamp AS TEXT), COALESCE(checksum, '') FROM message WHERE server_id=? AND conn_id=? ORDER BY id DESC LIMIT 100`, serverID, strconv.Itoa(connID))
 	if err != nil {
 		return nil, err
 	}
@@ -48,12 +80,15 @@ func GetServerAllMessages(db *sql.DB, serverID int, connID int) ([]*types.Messag
 	var messages []*types.Message
 	for rows.Next() {
 		message := &types.Message{}
-		if err := rows.Scan(&message.ID, &message.ServerID, &message.ConnID, &message.Content, &message.InputMethod, &message.DisplayMethod, &message.Encoding, &message.Direction, &message.Timestamp); err != nil {
+		if err := rows.Scan(&message.ID, &message.ServerID, &message.ConnID, &message.Payload, &message.Length, &message.InputMethod, &message.DisplayMethod, &message.Encoding, &message.Direction, &message.Timestamp, &message.Checksum); err != nil {
 			return nil, err
 		}
 		messages = append(messages, message)
 	}
-	return messages, nil
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, rows.Err()
 }
 
 func DeleteMessageByServerID(db *sql.DB, serverID int, connID int) error {
@@ -61,7 +96,7 @@ func DeleteMessageByServerID(db *sql.DB, serverID int, connID int) error {
 		_, err := db.Exec(`DELETE FROM message WHERE server_id=` + strconv.Itoa(serverID))
 		return err
 	}
-	_, err := db.Exec(`DELETE FROM message WHERE server_id=` + strconv.Itoa(serverID) + ` AND conn_id='` + fmt.Sprintf("%d:%d", serverID, connID) + `'`)
+	_, err := db.Exec(`DELETE FROM message WHERE server_id=? AND conn_id=?`, serverID, strconv.Itoa(connID))
 	return err
 }
 
@@ -70,3 +105,97 @@ func DeleteMessage(db *sql.DB, clientID int) error {
 	_, err := db.Exec(`DELETE FROM message WHERE client_id=?`, clientID)
 	return err
 }
+
+// MessageFilter 消息查询条件，ClientID 与 ServerID 二选一，零值字段不参与过滤
+type MessageFilter struct {
+	ClientID  int
+	ServerID  int
+	ConnID    int
+	Direction string
+	Since     string // 起始时间（含）
+	Until     string // 结束时间（不含）
+	AfterID   int    // 只返回 id 大于 AfterID 的消息
+	BeforeID  int    // 只返回 id 小于 BeforeID 的消息
+	Contains  []byte // 原始字节中包含的内容
+	Desc      bool   // 按 id 倒序
+	Limit     int
+	// Match 无法用 SQL 表达的过滤条件（如正则），逐条在内存中判断
+	Match func(message *types.Message) bool
+}
+
+// QueryMessages 按条件查询消息，最多返回 Limit 条，more 表示是否还有更多满足条件的消息
+func QueryMessages(db *sql.DB, filter MessageFilter) (messages []*types.Message, more bool, err error) {
+	var where []string
+	var args []interface{}
+	if filter.ClientID != 0 {
+		where = append(where, "client_id = ?")
+		args = append(args, filter.ClientID)
+	}
+	if filter.ServerID != 0 {
+		where = append(where, "server_id = ?")
+		args = append(args, filter.ServerID)
+	}
+	if filter.ConnID != 0 {
+		where = append(where, "conn_id = ?")
+		args = append(args, strconv.Itoa(filter.ConnID))
+	}
+	if filter.Direction != "" {
+		where = append(where, "direction = ?")
+		args = append(args, filter.Direction)
+	}
+	if filter.Since != "" {
+		where = append(where, "timestamp >= ?")
+		args = append(args, filter.Since)
+	}
+	if filter.Until != "" {
+		where = append(where, "timestamp < ?")
+		args = append(args, filter.Until)
+	}
+	if filter.AfterID != 0 {
+		where = append(where, "id > ?")
+		args = append(args, filter.AfterID)
+	}
+	if filter.BeforeID != 0 {
+		where = append(where, "id < ?")
+		args = append(args, filter.BeforeID)
+	}
+	if len(filter.Contains) > 0 {
+		where = append(where, "instr(payload, ?) > 0")
+		args = append(args, filter.Contains)
+	}
+
+	query := `SELECT id, COALESCE(client_id, 0), COALESCE(server_id, 0), COALESCE(conn_id, ''), payload, payload_len, input_method, display_method, encoding, direction, CAST(timestamp AS TEXT), COALESCE(checksum, '') FROM message`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if filter.Desc {
+		query += " ORDER BY id DESC"
+	} else {
+		query += " ORDER BY id"
+	}
+	// 多取一条用于判断是否还有下一页，内存过滤时无法预知条数，逐行读取到足够为止
+	if filter.Match == nil {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit+1)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		message := &types.Message{}
+		if err := rows.Scan(&message.ID, &message.ClientID, &message.ServerID, &message.ConnID, &message.Payload, &message.Length, &message.InputMethod, &message.DisplayMethod, &message.Encoding, &message.Direction, &message.Timestamp, &message.Checksum); err != nil {
+			return nil, false, err
+		}
+		if filter.Match != nil && !filter.Match(message) {
+			continue
+		}
+		if len(messages) == filter.Limit {
+			return messages, true, nil
+		}
+		messages = append(messages, message)
+	}
+	return messages, false, rows.Err()
+}
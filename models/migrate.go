@@ -0,0 +1,327 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// migration 数据库迁移，按版本号顺序执行，每个迁移在独立事务中运行
+type migration struct {
+	version     int
+	description string
+	up          func(tx dbExecutor) error
+}
+
+// migrations 迁移列表，新增表结构变更时在末尾追加，已发布的迁移不可修改
+var migrations = []migration{
+	{1, "初始表结构", migrateInitialSchema},
+	{2, "客户端与服务端 TLS 配置", migrateTLSConfig},
+	{3, "WebSocket 类型与配置", migrateWebSocket},
+	{4, "消息原始字节存储", migrateMessagePayload},
+	{5, "流式传输分帧配置", migrateFramerConfig},
+	{6, "服务端自动应答规则", migrateAutoReplyRule},
+	{7, "服务端消息使用 server_conn.conn_id 标识连接", migrateMessageConnID},
+	{8, "客户端断线重连策略", migrateReconnectConfig},
+	{9, "定时发送序列，发送间隔改为毫秒", migrateSendSequence},
+	{10, "校验配置与接收校验结果", migrateChecksum},
+	{11, "客户端与服务端字符编码", migrateEncoding},
+	{12, "消息查询索引", migrateMessageIndexes},
+	{13, "测试场景运行记录", migrateScenarioRun},
+	{14, "客户端与服务端脚本", migrateScript},
+}
+
+// Migrate 执行未应用的迁移，dbPath 非空且数据库已有数据时，升级前先备份数据库文件
+func Migrate(db *sql.DB, dbPath string) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`); err != nil {
+		return err
+	}
+
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	var pending []migration
+	for _, m := range migrations {
+		if m.version > current {
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if dbPath != "" {
+		if err := backupDatabase(db, dbPath, current); err != nil {
+			return fmt.Errorf("备份数据库失败: %v", err)
+		}
+	}
+
+	for _, m := range pending {
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("迁移 %d (%s) 失败: %v", m.version, m.description, err)
+		}
+		log.Printf("数据库迁移 %d 完成: %s", m.version, m.description)
+	}
+	return nil
+}
+
+// SchemaVersion 返回当前数据库版本，未执行过迁移时为 0
+func SchemaVersion(db *sql.DB) (int, error) {
+	var version sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, description) VALUES (?, ?)`, m.version, m.description); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// backupDatabase 使用 VACUUM INTO 生成一致的数据库副本，新建的空数据库无需备份
+func backupDatabase(db *sql.DB, dbPath string, version int) error {
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='server_client'`).Scan(&tables); err != nil {
+		return err
+	}
+	if tables == 0 {
+		return nil
+	}
+	backupPath := fmt.Sprintf("%s.v%d.%s.bak", dbPath, version, time.Now().Format("20060102150405"))
+	if _, err := db.Exec(`VACUUM INTO ?`, backupPath); err != nil {
+		return err
+	}
+	log.Printf("数据库已备份到 %s", backupPath)
+	return nil
+}
+
+func migrateTLSConfig(tx dbExecutor) error {
+	if err := addColumnIfNotExists(tx, "server_client", "tls_config", "TEXT"); err != nil {
+		return err
+	}
+	return addColumnIfNotExists(tx, "server", "tls_config", "TEXT")
+}
+
+func migrateWebSocket(tx dbExecutor) error {
+	if err := addColumnIfNotExists(tx, "server_client", "ws_config", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists(tx, "server", "ws_config", "TEXT"); err != nil {
+		return err
+	}
+
+	// 放宽 type 的 CHECK 约束以允许 ws
+	clientSQL, err := tableSQL(tx, "server_client")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(clientSQL, "'ws'") {
+		if err := rebuildTable(tx, "server_client", `CREATE TABLE %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		remark TEXT,
+		host TEXT NOT NULL,
+		port INTEGER NOT NULL,
+		status TEXT,
+		create_time DATETIME DEFAULT CURRENT_TIMESTAMP,
+		update_time DATETIME DEFAULT CURRENT_TIMESTAMP,
+		type TEXT CHECK(type IN ('tcp', 'udp', 'ws')) NOT NULL,
+		repeat_send INTEGER DEFAULT 0,
+		repeat_interval REAL DEFAULT 1000.0,
+		send_content TEXT,
+		tls_config TEXT,
+		ws_config TEXT
+	);`, []string{"id", "remark", "host", "port", "status", "create_time", "update_time", "type", "repeat_send", "repeat_interval", "send_content", "tls_config", "ws_config"}); err != nil {
+			return err
+		}
+	}
+
+	serverSQL, err := tableSQL(tx, "server")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(serverSQL, "'ws'") {
+		if err := rebuildTable(tx, "server", `CREATE TABLE %s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		remark TEXT,
+		host TEXT NOT NULL,
+		port INTEGER NOT NULL,
+		status TEXT,
+		type TEXT CHECK(type IN ('tcp', 'udp', 'ws')) NOT NULL,
+		create_time DATETIME DEFAULT CURRENT_TIMESTAMP,
+		update_time DATETIME DEFAULT CURRENT_TIMESTAMP,
+		tls_config TEXT,
+		ws_config TEXT
+	);`, []string{"id", "remark", "host", "port", "status", "type", "create_time", "update_time", "tls_config", "ws_config"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateMessagePayload 将 TEXT content 列转换为 BLOB payload 列和字节长度
+func migrateMessagePayload(tx dbExecutor) error {
+	hasContent, err := columnExists(tx, "message", "content")
+	if err != nil || !hasContent {
+		return err
+	}
+
+	statements := []string{
+		`CREATE TABLE message_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		client_id INTEGER,
+		server_id INTEGER,
+		conn_id TEXT,
+		payload BLOB NOT NULL,
+		payload_len INTEGER NOT NULL DEFAULT 0,
+		direction TEXT NOT NULL,
+		input_method TEXT NOT NULL,
+		display_method TEXT NOT NULL,
+		encoding TEXT NOT NULL,
+		timestamp DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (client_id) REFERENCES tcp_client(id),
+		FOREIGN KEY (server_id) REFERENCES tcp_server(id)
+	);`,
+		`INSERT INTO message_new (id, client_id, server_id, conn_id, payload, payload_len, direction, input_method, display_method, encoding, timestamp)
+		SELECT id, client_id, server_id, conn_id, CAST(content AS BLOB), length(CAST(content AS BLOB)), direction, input_method, display_method, encoding, timestamp FROM message;`,
+		`DROP TABLE message;`,
+		`ALTER TABLE message_new RENAME TO message;`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateFramerConfig(tx dbExecutor) error {
+	if err := addColumnIfNotExists(tx, "server_client", "framer_config", "TEXT"); err != nil {
+		return err
+	}
+	return addColumnIfNotExists(tx, "server", "framer_config", "TEXT")
+}
+
+func migrateAutoReplyRule(tx dbExecutor) error {
+	return createTableIfNotExists(tx, `CREATE TABLE IF NOT EXISTS auto_reply_rule (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		server_id INTEGER NOT NULL,
+		name TEXT,
+		match_type TEXT CHECK(match_type IN ('exact', 'prefix', 'regex', 'hex')) NOT NULL,
+		pattern TEXT NOT NULL,
+		pattern_input TEXT,
+		response TEXT NOT NULL,
+		response_input TEXT,
+		delay_ms INTEGER DEFAULT 0,
+		mode TEXT DEFAULT 'always',
+		priority INTEGER DEFAULT 0,
+		enabled INTEGER DEFAULT 1,
+		create_time DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (server_id) REFERENCES server(id)
+	);`)
+}
+
+// migrateMessageConnID 将旧的 "serverID:port" 连接标识转换为对应的 server_conn.conn_id，
+// 同一端口有多条连接记录时无法区分，归入最近的一条
+func migrateMessageConnID(tx dbExecutor) error {
+	_, err := tx.Exec(`UPDATE message SET conn_id = (
+		SELECT CAST(sc.conn_id AS TEXT) FROM server_conn sc
+		WHERE sc.server_id = message.server_id AND message.conn_id = sc.server_id || ':' || sc.conn_port
+		ORDER BY sc.conn_id DESC LIMIT 1
+	) WHERE server_id IS NOT NULL AND conn_id LIKE '%:%' AND EXISTS (
+		SELECT 1 FROM server_conn sc
+		WHERE sc.server_id = message.server_id AND message.conn_id = sc.server_id || ':' || sc.conn_port
+	)`)
+	return err
+}
+
+func migrateReconnectConfig(tx dbExecutor) error {
+	return addColumnIfNotExists(tx, "server_client", "reconnect_config", "TEXT")
+}
+
+// migrateSendSequence 新增发送序列列，并将以秒保存的 repeat_interval 转换为毫秒
+func migrateSendSequence(tx dbExecutor) error {
+	if err := addColumnIfNotExists(tx, "server_client", "send_sequence", "TEXT"); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE server_client SET repeat_interval = repeat_interval * 1000`)
+	return err
+}
+
+func migrateChecksum(tx dbExecutor) error {
+	if err := addColumnIfNotExists(tx, "server_client", "checksum_config", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists(tx, "server", "checksum_config", "TEXT"); err != nil {
+		return err
+	}
+	return addColumnIfNotExists(tx, "message", "checksum", "TEXT")
+}
+
+func migrateEncoding(tx dbExecutor) error {
+	if err := addColumnIfNotExists(tx, "server_client", "encoding", "TEXT DEFAULT 'utf-8'"); err != nil {
+		return err
+	}
+	return addColumnIfNotExists(tx, "server", "encoding", "TEXT DEFAULT 'utf-8'")
+}
+
+// migrateMessageIndexes 为按客户端、服务端连接和时间查询消息建立索引，索引包含 id 以支持游标分页
+func migrateMessageIndexes(tx dbExecutor) error {
+	statements := []string{
+		`CREATE INDEX IF NOT EXISTS idx_message_client ON message (client_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_server_conn ON message (server_id, conn_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_timestamp ON message (timestamp)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateScenarioRun 测试场景运行记录，完整报告以 JSON 保存
+func migrateScenarioRun(tx dbExecutor) error {
+	return createTableIfNotExists(tx, `CREATE TABLE IF NOT EXISTS scenario_run (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT,
+		target_type TEXT NOT NULL,
+		target_id INTEGER NOT NULL,
+		passed INTEGER NOT NULL,
+		started_at TEXT NOT NULL,
+		duration_ms INTEGER NOT NULL,
+		report TEXT NOT NULL
+	);`)
+}
+
+// migrateScript 客户端与服务端脚本，每个目标最多一个
+func migrateScript(tx dbExecutor) error {
+	return createTableIfNotExists(tx, `CREATE TABLE IF NOT EXISTS script (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		target_type TEXT CHECK(target_type IN ('client', 'server')) NOT NULL,
+		target_id INTEGER NOT NULL,
+		source TEXT NOT NULL,
+		enabled INTEGER DEFAULT 1,
+		update_time DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (target_type, target_id)
+	);`)
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"connectivity/types"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openTestDB(t *testing.T) (*sql.DB, string) {
+	dbPath := filepath.Join(t.TempDir(), "data.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, dbPath
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	db, dbPath := openTestDB(t)
+	if err := Migrate(db, dbPath); err != nil {
+		t.Fatal(err)
+	}
+	version, err := SchemaVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != migrations[len(migrations)-1].version {
+		t.Fatalf("version = %d", version)
+	}
+	if matches, _ := filepath.Glob(dbPath + ".*.bak"); len(matches) != 0 {
+		t.Fatalf("新数据库不应备份: %v", matches)
+	}
+
+	// 重复执行不应出错
+	if err := Migrate(db, dbPath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	db, dbPath := openTestDB(t)
+	if err := migrateInitialSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO server_client (remark, host, port, status, type, repeat_send, repeat_interval, send_content) VALUES ('old', '127.0.0.1', 8080, 'offline', 'tcp', 0, 1000, '')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO message (client_id, content, direction, input_method, display_method, encoding) VALUES (1, ?, 'incoming', 'tcp', 'text', 'utf-8')`, "a\x00\xffb"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO server_conn (server_id, conn_status, conn_host, conn_port) VALUES (2, 'disconnected', '10.0.0.1', 5000)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO message (server_id, conn_id, content, direction, input_method, display_method, encoding) VALUES (2, '2:5000', 'x', 'incoming', 'tcp', 'text', 'utf-8')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(db, dbPath); err != nil {
+		t.Fatal(err)
+	}
+	if matches, _ := filepath.Glob(dbPath + ".v0.*.bak"); len(matches) != 1 {
+		t.Fatalf("升级前应备份数据库: %v", matches)
+	}
+
+	client, err := FindServerClientOne(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Remark != "old" || client.RepeatInterval != 1000000 {
+		t.Fatalf("client = %+v", client)
+	}
+	if err := AddServerClient(db, types.ServerClient{Host: "127.0.0.1", Port: 80, Type: "ws"}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := GetAllMessages(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || string(messages[0].Payload) != "a\x00\xffb" || messages[0].Length != 4 {
+		t.Fatalf("messages = %+v", messages)
+	}
+
+	serverMessages, err := GetServerAllMessages(db, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serverMessages) != 1 || serverMessages[0].ConnID != "1" {
+		t.Fatalf("旧连接标识应转换为 conn_id: %+v", serverMessages)
+	}
+}
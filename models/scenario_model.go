@@ -0,0 +1,59 @@
+package models
+
+import (
+	"connectivity/types"
+	"database/sql"
+	"encoding/json"
+)
+
+// AddScenarioRun 保存场景运行报告，返回运行记录标识
+func AddScenarioRun(db *sql.DB, report types.ScenarioReport) (int, error) {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return 0, err
+	}
+	result, err := db.Exec(`INSERT INTO scenario_run (name, target_type, target_id, passed, started_at, duration_ms, report) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		report.Name, report.Target.Type, report.Target.ID, report.Passed, report.StartedAt, report.DurationMs, string(data))
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// GetScenarioRuns 获取最近的运行记录，按时间倒序，不含步骤明细
+func GetScenarioRuns(db *sql.DB, limit int) ([]types.ScenarioReport, error) {
+	rows, err := db.Query(`SELECT id, COALESCE(name, ''), target_type, target_id, passed, started_at, duration_ms FROM scenario_run ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []types.ScenarioReport{}
+	for rows.Next() {
+		var run types.ScenarioReport
+		if err := rows.Scan(&run.RunID, &run.Name, &run.Target.Type, &run.Target.ID, &run.Passed, &run.StartedAt, &run.DurationMs); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// FindScenarioRunOne 获取运行记录的完整报告
+func FindScenarioRunOne(db *sql.DB, id int) (types.ScenarioReport, error) {
+	var data string
+	if err := db.QueryRow(`SELECT report FROM scenario_run WHERE id=?`, id).Scan(&data); err != nil {
+		return types.ScenarioReport{}, err
+	}
+	var report types.ScenarioReport
+	err := json.Unmarshal([]byte(data), &report)
+	report.RunID = id
+	return report, err
+}
+
+// DeleteScenarioRun 删除运行记录
+func DeleteScenarioRun(db *sql.DB, id int) error {
+	_, err := db.Exec(`DELETE FROM scenario_run WHERE id=?`, id)
+	return err
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"connectivity/types"
+	"database/sql"
+)
+
+// FindScript 获取客户端或服务端的脚本，没有时返回 sql.ErrNoRows
+func FindScript(db *sql.DB, targetType string, targetID int) (types.Script, error) {
+	var script types.Script
+	err := db.QueryRow(`SELECT id, target_type, target_id, source, enabled FROM script WHERE target_type=? AND target_id=?`, targetType, targetID).
+		Scan(&script.ID, &script.TargetType, &script.TargetID, &script.Source, &script.Enabled)
+	return script, err
+}
+
+// SaveScript 保存脚本，目标已有脚本时覆盖
+func SaveScript(db *sql.DB, script types.Script) error {
+	_, err := db.Exec(`INSERT INTO script (target_type, target_id, source, enabled) VALUES (?, ?, ?, ?)
+		ON CONFLICT (target_type, target_id) DO UPDATE SET source=excluded.source, enabled=excluded.enabled, update_time=CURRENT_TIMESTAMP`,
+		script.TargetType, script.TargetID, script.Source, script.Enabled)
+	return err
+}
+
+func DeleteScript(db *sql.DB, targetType string, targetID int) error {
+	_, err := db.Exec(`DELETE FROM script WHERE target_type=? AND target_id=?`, targetType, targetID)
+	return err
+}
@@ -5,17 +5,19 @@ import (
 	"database/sql"
 )
 
-func InsertServerConn(db *sql.DB, serverID int, connStatus string, connHost string, connPort int) error {
+// InsertServerConn 记录新连接，返回连接唯一标识 conn_id
+func InsertServerConn(db *sql.DB, serverID int, connStatus string, connHost string, connPort int) (int, error) {
 	stmt, err := db.Prepare("INSERT INTO server_conn (server_id, conn_status, conn_host, conn_port, conn_create_time) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)")
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer stmt.Close()
-	_, err = stmt.Exec(serverID, connStatus, connHost, connPort)
+	result, err := stmt.Exec(serverID, connStatus, connHost, connPort)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	id, err := result.LastInsertId()
+	return int(id), err
 }
 
 func UpdateServerConn(db *sql.DB, serverID int, id int, connStatus string) error {
@@ -96,13 +98,14 @@ func GetServerConn(db *sql.DB, serverID int) ([]*types.ServerConn, error) {
 	return conns, nil
 }
 
-func FindServerConnOne(db *sql.DB, serverID int, connPort int) (*types.ServerConn, error) {
-	stmt, err := db.Prepare("SELECT conn_id, server_id, conn_status, conn_host, conn_port, conn_create_time, conn_update_time FROM server_conn WHERE server_id = ? AND conn_port = ?")
+// FindServerConnOne 按 conn_id 查找连接
+func FindServerConnOne(db *sql.DB, serverID int, connID int) (*types.ServerConn, error) {
+	stmt, err := db.Prepare("SELECT conn_id, server_id, conn_status, conn_host, conn_port, conn_create_time, conn_update_time FROM server_conn WHERE server_id = ? AND conn_id = ?")
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
-	row := stmt.QueryRow(serverID, connPort)
+	row := stmt.QueryRow(serverID, connID)
 	conn := &types.ServerConn{}
 	err = row.Scan(&conn.ID, &conn.ServerID, &conn.ConnStatus, &conn.ConnHost, &conn.ConnPort, &conn.ConnCreateTime, &conn.ConnUpdateTime)
 	if err != nil {
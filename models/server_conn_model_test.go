@@ -0,0 +1,69 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServerConnSamePortDifferentHosts(t *testing.T) {
+	db, _ := openTestDB(t)
+	if err := InitDB(db); err != nil {
+		t.Fatal(err)
+	}
+	first, err := InsertServerConn(db, 1, "connected", "10.0.0.1", 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := InsertServerConn(db, 1, "connected", "10.0.0.2", 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("同端口不同主机应得到不同的 conn_id: %d", first)
+	}
+
+	if err := UpdateServerConn(db, 1, first, "disconnected"); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := FindServerConnOne(db, 1, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.ConnHost != "10.0.0.2" || conn.ConnStatus != "connected" {
+		t.Fatalf("conn = %+v", conn)
+	}
+
+	AddMessageServer(db, 1, first, []byte("a"), "tcp", "text", "utf-8", "incoming")
+	AddMessageServer(db, 1, second, []byte("b"), "tcp", "text", "utf-8", "incoming")
+	messages, err := GetServerAllMessages(db, 1, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || string(messages[0].Payload) != "b" {
+		t.Fatalf("messages = %+v", messages)
+	}
+}
+
+func TestMessageTimestampAndDelete(t *testing.T) {
+	db, _ := openTestDB(t)
+	if err := InitDB(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddMessage(db, 3, []byte("a"), "tcp", "text", "utf-8", "incoming"); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := GetAllMessages(db, 3)
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("messages = %+v, %v", messages, err)
+	}
+	// 读取存储的本地时间文本，而不是驱动转换后的 UTC 时间
+	if _, err := time.ParseInLocation(TimestampLayout, messages[0].Timestamp, time.Local); err != nil {
+		t.Fatalf("timestamp = %s", messages[0].Timestamp)
+	}
+	if err := DeleteMessage(db, 3); err != nil {
+		t.Fatal(err)
+	}
+	if messages, _ := GetAllMessages(db, 3); len(messages) != 0 {
+		t.Fatalf("删除后仍有 %d 条消息", len(messages))
+	}
+}
@@ -5,15 +5,31 @@ import (
 	"database/sql"
 )
 
+const serverColumns = `id, remark, host, port, status, type, COALESCE(encoding, ''), tls_config, ws_config, framer_config, checksum_config`
+
+func scanServer(row rowScanner) (types.Server, error) {
+	var server types.Server
+	var tlsConfig, wsConfig, framerConfig, checksumConfig sql.NullString
+	if err := row.Scan(&server.ID, &server.Remark, &server.Host, &server.Port, &server.Status, &server.Type, &server.Encoding, &tlsConfig, &wsConfig, &framerConfig, &checksumConfig); err != nil {
+		return server, err
+	}
+	err := unmarshalConfigs([]sql.NullString{tlsConfig, wsConfig, framerConfig, checksumConfig}, &server.TLS, &server.WS, &server.Framer, &server.Checksum)
+	return server, err
+}
+
 // 添加 TCP 服务器
 func AddServer(db *sql.DB, server types.Server) error {
-	_, err := db.Exec(`INSERT INTO server (remark, host, port, status, type) VALUES (?, ?, ?, ?, ?)`,
-		server.Remark, server.Host, server.Port, server.Status, server.Type)
+	configs, err := marshalConfigs(server.TLS, server.WS, server.Framer, server.Checksum)
+	if err != nil {
+		return err
+	}
+	args := append([]interface{}{server.Remark, server.Host, server.Port, server.Status, server.Type, server.Encoding}, configs...)
+	_, err = db.Exec(`INSERT INTO server (remark, host, port, status, type, encoding, tls_config, ws_config, framer_config, checksum_config) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, args...)
 	return err
 }
 
 func GetAllServers(db *sql.DB, typer string) ([]types.Server, error) {
-	rows, err := db.Query(`SELECT id, remark, host, port, status, type FROM server WHERE type = '` + typer + `' order by id`)
+	rows, err := db.Query(`SELECT `+serverColumns+` FROM server WHERE type = ? order by id`, typer)
 	if err != nil {
 		return nil, err
 	}
@@ -22,8 +38,8 @@ func GetAllServers(db *sql.DB, typer string) ([]types.Server, error) {
 
 	var servers []types.Server
 	for rows.Next() {
-		var server types.Server
-		if err := rows.Scan(&server.ID, &server.Remark, &server.Host, &server.Port, &server.Status, &server.Type); err != nil {
+		server, err := scanServer(rows)
+		if err != nil {
 			return nil, err
 		}
 		servers = append(servers, server)
@@ -33,19 +49,42 @@ func GetAllServers(db *sql.DB, typer string) ([]types.Server, error) {
 
 // 更新 TCP 服务器
 func UpdateServer(db *sql.DB, server types.Server) error {
-	_, err := db.Exec(`UPDATE server SET remark=?, host=?, port=?, status=?, type=? WHERE id=?`,
-		server.Remark, server.Host, server.Port, server.Status, server.Type, server.ID)
+	configs, err := marshalConfigs(server.TLS, server.WS, server.Framer, server.Checksum)
+	if err != nil {
+		return err
+	}
+	args := append([]interface{}{server.Remark, server.Host, server.Port, server.Status, server.Type, server.Encoding}, configs...)
+	_, err = db.Exec(`UPDATE server SET remark=?, host=?, port=?, status=?, type=?, encoding=?, tls_config=?, ws_config=?, framer_config=?, checksum_config=? WHERE id=?`, append(args, server.ID)...)
 	return err
 }
 
 // 删除 TCP 服务器
 func DeleteServer(db *sql.DB, id int) error {
-	_, err := db.Exec(`DELETE FROM server WHERE id=?`, id)
-	return err
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM auto_reply_rule WHERE server_id=?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM script WHERE target_type='server' AND target_id=?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM server WHERE id=?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func FindServerOne(db *sql.DB, id int) (types.Server, error) {
-	var server types.Server
-	err := db.QueryRow(`SELECT id, remark, host, port, status, type FROM server WHERE id=?`, id).Scan(&server.ID, &server.Remark, &server.Host, &server.Port, &server.Status, &server.Type)
-	return server, err
+	return scanServer(db.QueryRow(`SELECT `+serverColumns+` FROM server WHERE id=?`, id))
+}
+
+// FindServerByAddr 返回指定类型、监听地址和端口的服务端中最新添加的一个的 id，不存在时返回 0
+func FindServerByAddr(db *sql.DB, typer string, host string, port int) (int, error) {
+	var id int
+	err := db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM server WHERE type=? AND host=? AND port=?`, typer, host, port).Scan(&id)
+	return id, err
 }
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"connectivity/types"
+	"database/sql"
+	"testing"
+)
+
+func TestDeleteServerRemovesRulesAndScript(t *testing.T) {
+	db, _ := openTestDB(t)
+	if err := InitDB(db); err != nil {
+		t.Fatal(err)
+	}
+	for _, port := range []int{7001, 7002} {
+		if err := AddServer(db, types.Server{Host: "127.0.0.1", Port: port, Type: "tcp", Status: "stopped"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, serverID := range []int{1, 2} {
+		if err := AddAutoReplyRule(db, types.AutoReplyRule{ServerID: serverID, MatchType: "exact", Pattern: "a", Response: "b", Enabled: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveScript(db, types.Script{TargetType: "server", TargetID: serverID, Source: "", Enabled: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 同号客户端的脚本不受影响
+	if err := SaveScript(db, types.Script{TargetType: "client", TargetID: 1, Source: "", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteServer(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	if rules, err := GetAutoReplyRules(db, 1); err != nil || len(rules) != 0 {
+		t.Fatalf("rules = %v, %v", rules, err)
+	}
+	if rules, err := GetAutoReplyRules(db, 2); err != nil || len(rules) != 1 {
+		t.Fatalf("其他服务器的规则不应删除: %v, %v", rules, err)
+	}
+	if _, err := FindScript(db, "server", 1); err != sql.ErrNoRows {
+		t.Fatalf("服务器脚本未删除: %v", err)
+	}
+	if _, err := FindScript(db, "server", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FindScript(db, "client", 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteServerClientRemovesScript(t *testing.T) {
+	db, _ := openTestDB(t)
+	if err := InitDB(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddServerClient(db, types.ServerClient{Host: "127.0.0.1", Port: 7001, Type: "tcp", Status: "offline"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveScript(db, types.Script{TargetType: "client", TargetID: 1, Source: "", Enabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteServerClient(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FindScript(db, "client", 1); err != sql.ErrNoRows {
+		t.Fatalf("客户端脚本未删除: %v", err)
+	}
+}
@@ -20,15 +20,93 @@ type ConnectResult struct {
 
 // TCPClient 结构体
 type ServerClient struct {
-	ID             int     `json:"id"`             // 唯一标识
-	Remark         string  `json:"remark"`         // 备注
-	Host           string  `json:"host"`           // 地址
-	Port           int     `json:"port"`           // 端口
-	Status         string  `json:"status"`         // 状态
-	Type           string  `json:"type"`           // 连接类型
-	RepeatSend     bool    `json:"repeatSend"`     // 是否重复发送
-	RepeatInterval float64 `json:"repeatInterval"` // 重复发送间隔
-	SendContent    string  `json:"sendContent"`    // 发送内容
+	ID             int             `json:"id"`             // 唯一标识
+	Remark         string          `json:"remark"`         // 备注
+	Host           string          `json:"host"`           // 地址
+	Port           int             `json:"port"`           // 端口
+	Status         string          `json:"status"`         // 状态
+	Type           string          `json:"type"`           // 连接类型
+	Encoding       string          `json:"encoding"`       // 字符编码: utf-8/gbk/gb18030/utf-16le/utf-16be/latin1
+	RepeatSend     bool            `json:"repeatSend"`     // 是否重复发送
+	RepeatInterval float64         `json:"repeatInterval"` // 重复发送间隔（毫秒）
+	SendContent    string          `json:"sendContent"`    // 发送内容
+	TLS            TLSConfig       `json:"tls"`            // TLS 配置
+	WS             WsConfig        `json:"ws"`             // WebSocket 配置
+	Framer         FramerConfig    `json:"framer"`         // 分帧配置
+	Reconnect      ReconnectPolicy `json:"reconnect"`      // 断线重连策略
+	Sequence       SendSequence    `json:"sequence"`       // 定时发送序列
+	Checksum       ChecksumConfig  `json:"checksum"`       // 校验配置
+}
+
+// ChecksumConfig 校验配置，发送时在末尾追加校验值，接收时校验帧末尾的校验值
+type ChecksumConfig struct {
+	Algorithm string `json:"algorithm"` // 算法: sum8/xor/lrc/crc8/crc16_modbus/crc16_ccitt/crc16_xmodem/crc32/adler32
+	Endian    string `json:"endian"`    // 字节序: big/little，为空时使用算法默认值
+	Offset    int    `json:"offset"`    // 校验范围起始偏移，用于跳过帧头
+	Append    bool   `json:"append"`    // 发送时自动追加
+	Verify    bool   `json:"verify"`    // 接收时校验
+}
+
+// SendSequence 定时发送序列，按顺序发送各步骤，内容中的 {{counter}} 替换为发送计数
+type SendSequence struct {
+	Loop  int            `json:"loop"`  // 循环次数，0 表示无限循环
+	Steps []SequenceStep `json:"steps"` // 发送步骤
+}
+
+// SequenceStep 发送序列中的单个步骤
+type SequenceStep struct {
+	Content     string `json:"content"`      // 发送内容
+	InputMethod string `json:"input_method"` // 输入方式: text/hex/base64/escape
+	DelayMs     int    `json:"delay_ms"`     // 距上一步的延迟（毫秒）
+}
+
+// ReconnectPolicy 客户端断线重连策略
+type ReconnectPolicy struct {
+	Enabled        bool    `json:"enabled"`          // 是否启用自动重连
+	Backoff        string  `json:"backoff"`          // 退避方式: fixed/exponential
+	InitialDelayMs int     `json:"initial_delay_ms"` // 首次重连延迟（毫秒），默认 1000
+	MaxDelayMs     int     `json:"max_delay_ms"`     // 最大延迟（毫秒），默认 30000
+	Multiplier     float64 `json:"multiplier"`       // 指数退避倍数，默认 2
+	Jitter         float64 `json:"jitter"`           // 随机抖动比例 0~1
+	MaxAttempts    int     `json:"max_attempts"`     // 最大重连次数，0 表示不限
+	Trigger        string  `json:"trigger"`          // 触发条件: 空或 all/eof/error
+}
+
+// FramerConfig 流式传输分帧配置，长度字段模式下帧总长 = 偏移 + 字段长度 + 字段值 + 长度修正
+type FramerConfig struct {
+	Mode           string `json:"mode"`            // 分帧模式: 空/delimiter/fixed/length/idle
+	Delimiter      string `json:"delimiter"`       // 分隔符，如 \r\n 或 7E
+	DelimiterInput string `json:"delimiter_input"` // 分隔符输入方式: text/hex/escape
+	KeepDelimiter  bool   `json:"keep_delimiter"`  // 消息中是否保留分隔符
+	FixedLength    int    `json:"fixed_length"`    // 固定帧长度
+	LengthSize     int    `json:"length_size"`     // 长度字段字节数: 1/2/4
+	LengthOffset   int    `json:"length_offset"`   // 长度字段在帧头中的偏移
+	LengthAdjust   int    `json:"length_adjust"`   // 长度修正
+	Endian         string `json:"endian"`          // 字节序: big/little
+	IdleTimeoutMs  int    `json:"idle_timeout_ms"` // 空闲超时（毫秒），超时后输出缓冲中的数据
+	MaxFrameSize   int    `json:"max_frame_size"`  // 最大帧长度，默认 64KB
+}
+
+// WsConfig WebSocket 配置
+type WsConfig struct {
+	URL          string            `json:"url"`          // 客户端连接地址 ws:// 或 wss://，为空时由 host/port/path 生成
+	Path         string            `json:"path"`         // 路径，服务端监听路径
+	Headers      map[string]string `json:"headers"`      // 客户端握手附加请求头
+	Subprotocols []string          `json:"subprotocols"` // 子协议
+	MessageType  string            `json:"message_type"` // 发送帧类型: text/binary
+}
+
+// TLSConfig TLS 配置，证书与密钥均以 PEM 文本保存
+type TLSConfig struct {
+	Enabled            bool   `json:"enabled"`              // 是否启用 TLS
+	CertPEM            string `json:"cert_pem"`             // 证书（服务端证书或 mTLS 客户端证书）
+	KeyPEM             string `json:"key_pem"`              // 私钥
+	CAPEM              string `json:"ca_pem"`               // CA 证书链
+	ClientAuth         bool   `json:"client_auth"`          // 服务端是否要求客户端证书 (mTLS)
+	ServerName         string `json:"server_name"`          // SNI，为空时使用主机地址
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` // 跳过证书校验
+	MinVersion         string `json:"min_version"`          // 最低版本: 1.0/1.1/1.2/1.3
+	MaxVersion         string `json:"max_version"`          // 最高版本: 1.0/1.1/1.2/1.3
 }
 
 // Message 结构体
@@ -37,22 +115,215 @@ type Message struct {
 	ClientID      int64  `json:"client_id"`      // 客户端唯一标识
 	ServerID      int64  `json:"server_id"`      // 服务端唯一标识
 	ConnID        string `json:"conn_id"`        // 连接唯一标识
-	Content       string `json:"content"`        // 内容
+	Content       string `json:"content"`        // 内容（按显示方式渲染）
+	Payload       []byte `json:"payload"`        // 原始字节
+	Length        int    `json:"length"`         // 字节长度
 	Direction     string `json:"direction"`      // "outgoing" 或 "incoming"
 	InputMethod   string `json:"input_method"`   // 输入方法
 	DisplayMethod string `json:"display_method"` // 显示方法
 	Encoding      string `json:"encoding"`       // 编码
 	Timestamp     string `json:"timestamp"`      // 时间
+	Checksum      string `json:"checksum"`       // 接收校验结果: ok/mismatch，未校验时为空
+}
+
+// MessageQuery 消息查询条件，ClientID 与 ServerID 二选一
+type MessageQuery struct {
+	ClientID   int    `json:"client_id"`   // 客户端唯一标识
+	ServerID   int    `json:"server_id"`   // 服务端唯一标识
+	ConnID     int    `json:"conn_id"`     // 服务端连接 server_conn.conn_id，为 0 时不限连接
+	Direction  string `json:"direction"`   // "outgoing" 或 "incoming"，为空时不限
+	Since      string `json:"since"`       // 起始时间（含），格式 2006-01-02 15:04:05，可带毫秒
+	Until      string `json:"until"`       // 结束时间（不含），格式同上
+	Search     string `json:"search"`      // 搜索内容
+	SearchMode string `json:"search_mode"` // 搜索方式: text/hex/regex，默认为 text
+	Cursor     int    `json:"cursor"`      // 上一页返回的 next_cursor，首页为 0
+	Order      string `json:"order"`       // 排序: asc（由旧到新，默认）或 desc
+	Limit      int    `json:"limit"`       // 每页条数，默认 100，最大 1000
+	Display    string `json:"display"`     // 显示方式，为空时使用消息记录的显示方式
+}
+
+// MessageExport 消息导出参数，ClientID 与 ServerID 二选一，ConnID 非 0 时只导出该连接
+type MessageExport struct {
+	ClientID        int    `json:"client_id"`
+	ServerID        int    `json:"server_id"`
+	ConnID          int    `json:"conn_id"`
+	Format          string `json:"format"`           // 导出格式: csv/jsonl/text/pcapng
+	PayloadEncoding string `json:"payload_encoding"` // jsonl 载荷编码: base64（默认）或 hex
+	Path            string `json:"path"`             // 导出文件路径，为空时弹出保存对话框
+}
+
+// MessagePage 分页查询结果
+type MessagePage struct {
+	Messages   []*Message `json:"messages"`
+	NextCursor int        `json:"next_cursor"` // 下一页游标，没有更多时为 0
+	HasMore    bool       `json:"has_more"`
+}
+
+// ReplayTarget 回放目标，ConnID 仅用于服务端，为 server_conn.conn_id
+type ReplayTarget struct {
+	Type   string `json:"type"`    // tcp-client/udp-client/tcp-server/udp-server
+	ID     int    `json:"id"`      // 客户端或服务端唯一标识
+	ConnID int    `json:"conn_id"` // 服务端连接
+}
+
+// PcapCapture 已加载的抓包文件
+type PcapCapture struct {
+	ID    int        `json:"id"`
+	Path  string     `json:"path"`
+	Flows []PcapFlow `json:"flows"`
+}
+
+// PcapFlow 抓包中的一条 TCP/UDP 会话，A 端为发起方
+type PcapFlow struct {
+	ID         int    `json:"id"`
+	Protocol   string `json:"protocol"`    // tcp 或 udp
+	AddrA      string `json:"addr_a"`      // A 端地址 ip:port
+	AddrB      string `json:"addr_b"`      // B 端地址 ip:port
+	PacketsA   int    `json:"packets_a"`   // A 端发出的载荷报文数
+	PacketsB   int    `json:"packets_b"`   // B 端发出的载荷报文数
+	BytesA     int    `json:"bytes_a"`     // A 端发出的载荷字节数
+	BytesB     int    `json:"bytes_b"`     // B 端发出的载荷字节数
+	Start      string `json:"start"`       // 首个载荷报文的时间
+	DurationMs int64  `json:"duration_ms"` // 首末载荷报文的时间间隔
+}
+
+// PcapReplay 抓包回放参数，将会话中一端的载荷通过现有连接发出
+type PcapReplay struct {
+	CaptureID int          `json:"capture_id"` // OpenPcap 返回的抓包标识
+	FlowID    int          `json:"flow_id"`    // 会话标识
+	Side      string       `json:"side"`       // 模拟的一端: a 或 b
+	Timing    string       `json:"timing"`     // 发送节奏: original（原始间隔，默认）/fast（尽快发送）
+	Speed     float64      `json:"speed"`      // original 节奏下的速度倍数，默认 1
+	Target    ReplayTarget `json:"target"`     // 回放目标
+}
+
+// LogReplay 消息记录回放参数，将来源客户端或服务端连接记录中的发出消息重新发送到回放目标
+type LogReplay struct {
+	ClientID       int          `json:"client_id"`        // 来源客户端，与 ServerID 二选一
+	ServerID       int          `json:"server_id"`        // 来源服务端
+	ConnID         int          `json:"conn_id"`          // 来源服务端连接，为 0 时不限连接
+	Since          string       `json:"since"`            // 起始时间（含），为空时不限
+	Until          string       `json:"until"`            // 结束时间（不含），为空时不限
+	Timing         string       `json:"timing"`           // 发送节奏: original（原始间隔，默认）/interval（固定间隔）/fast（尽快发送）
+	Speed          float64      `json:"speed"`            // original 节奏下的速度倍数，默认 1
+	IntervalMs     int          `json:"interval_ms"`      // interval 节奏下的发送间隔（毫秒）
+	WaitReply      bool         `json:"wait_reply"`       // 每次发送后等待目标收到一条消息再继续
+	ReplyTimeoutMs int          `json:"reply_timeout_ms"` // 等待回复的超时（毫秒），默认 5000
+	Target         ReplayTarget `json:"target"`           // 回放目标
+}
+
+// ReplayEvent 回放进度事件
+type ReplayEvent struct {
+	ReplayID int    `json:"replay_id"`
+	Type     string `json:"type"`    // started/progress/finished/stopped/error
+	Sent     int    `json:"sent"`    // 已发送报文数
+	Total    int    `json:"total"`   // 报文总数
+	Message  string `json:"message"` // 错误或结束说明
+}
+
+// Scenario 测试场景，按顺序对目标执行步骤，任一步骤失败即停止
+type Scenario struct {
+	Name   string         `json:"name"`
+	Target ReplayTarget   `json:"target"` // 执行目标，与回放目标相同；服务端目标的 conn_id 为 0 时由 connect 步骤等待新连接
+	Steps  []ScenarioStep `json:"steps"`
+}
+
+// ScenarioStep 场景步骤
+type ScenarioStep struct {
+	Action     string         `json:"action"`      // connect/send/expect/sleep/loop/disconnect
+	Name       string         `json:"name"`        // 步骤名称，用于报告
+	Data       string         `json:"data"`        // send 的发送内容，expect 的期望内容
+	Input      string         `json:"input"`       // data 的输入方式: text/hex/base64/escape，expect 的 regex/hex 模式不使用
+	Match      string         `json:"match"`       // expect 的匹配方式: exact（默认）/prefix/regex/hex，hex 模式中 ?? 匹配任意字节
+	TimeoutMs  int            `json:"timeout_ms"`  // expect 与服务端 connect 的超时（毫秒），默认 1000
+	DurationMs int            `json:"duration_ms"` // sleep 的时长（毫秒）
+	Count      int            `json:"count"`       // loop 的循环次数
+	Steps      []ScenarioStep `json:"steps"`       // loop 的循环体
+}
+
+// ScenarioStepResult 单个步骤的执行结果，循环体中的步骤每次迭代各有一条
+type ScenarioStepResult struct {
+	Path       string `json:"path"`      // 步骤位置，如 3 或 3.2，从 1 开始
+	Iteration  int    `json:"iteration"` // 所在循环的迭代次数，从 1 开始，不在循环中时为 0
+	Action     string `json:"action"`
+	Name       string `json:"name"`
+	Passed     bool   `json:"passed"`
+	DurationMs int64  `json:"duration_ms"`
+	Message    string `json:"message"` // 执行说明或失败原因
+}
+
+// ScenarioReport 场景执行报告
+type ScenarioReport struct {
+	RunID      int                  `json:"run_id"` // 运行记录标识，未保存时为 0
+	Name       string               `json:"name"`
+	Target     ReplayTarget         `json:"target"`
+	Passed     bool                 `json:"passed"`
+	StartedAt  string               `json:"started_at"`
+	DurationMs int64                `json:"duration_ms"`
+	Steps      []ScenarioStepResult `json:"steps"`
+}
+
+// AutomationConfig 本地自动化接口的启动参数
+type AutomationConfig struct {
+	Port  int    `json:"port"`  // 监听端口，仅绑定 127.0.0.1，为 0 时使用默认端口
+	Token string `json:"token"` // 访问令牌，为空时随机生成
+}
+
+// AutomationStatus 本地自动化接口的运行状态
+type AutomationStatus struct {
+	Running bool   `json:"running"`
+	Addr    string `json:"addr"`  // 监听地址，如 127.0.0.1:17890
+	Token   string `json:"token"` // 请求需在 Authorization: Bearer 头或 token 查询参数中携带
 }
 
 // TCPServer 结构体
 type Server struct {
-	ID     int    `json:"id"`
-	Remark string `json:"remark"`
-	Host   string `json:"host"`
-	Port   int    `json:"port"`
-	Status string `json:"status"`
-	Type   string `json:"type"`
+	ID       int            `json:"id"`
+	Remark   string         `json:"remark"`
+	Host     string         `json:"host"`
+	Port     int            `json:"port"`
+	Status   string         `json:"status"`
+	Type     string         `json:"type"`
+	Encoding string         `json:"encoding"`
+	TLS      TLSConfig      `json:"tls"`
+	WS       WsConfig       `json:"ws"`
+	Framer   FramerConfig   `json:"framer"`
+	Checksum ChecksumConfig `json:"checksum"`
+}
+
+// AutoReplyRule 服务端自动应答规则
+type AutoReplyRule struct {
+	ID            int    `json:"id"`
+	ServerID      int    `json:"server_id"`
+	Name          string `json:"name"`           // 规则名称
+	MatchType     string `json:"match_type"`     // 匹配方式: exact/prefix/regex/hex
+	Pattern       string `json:"pattern"`        // 匹配内容，hex 模式下 ?? 匹配任意字节
+	PatternInput  string `json:"pattern_input"`  // exact/prefix 匹配内容的输入方式: text/hex/escape/base64
+	Response      string `json:"response"`       // 应答模板，regex 匹配时可使用 $1、${name} 引用分组
+	ResponseInput string `json:"response_input"` // 应答内容的输入方式: text/hex/escape/base64
+	DelayMs       int    `json:"delay_ms"`       // 应答延迟（毫秒）
+	Mode          string `json:"mode"`           // 触发方式: always/once，once 每个连接只触发一次
+	Priority      int    `json:"priority"`       // 优先级，数值小的先匹配
+	Enabled       bool   `json:"enabled"`        // 是否启用
+}
+
+// Script 客户端或服务端的 JavaScript 脚本，每个连接运行独立的实例，
+// 可定义 onConnect()、onData(data)、onTimer() 钩子
+type Script struct {
+	ID         int    `json:"id"`
+	TargetType string `json:"target_type"` // client/server
+	TargetID   int    `json:"target_id"`   // 客户端或服务端标识
+	Source     string `json:"source"`      // 脚本内容
+	Enabled    bool   `json:"enabled"`     // 是否启用
+}
+
+// BroadcastResult 广播发送到单个连接的结果
+type BroadcastResult struct {
+	ConnID  int    `json:"conn_id"`
+	Host    string `json:"host"`
+	Port    int    `json:"port"`
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
 }
 
 type ServerEvent struct {